@@ -0,0 +1,198 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package bloom implements a fixed-size Bloom filter that can be saved and loaded back,
+// e.g. to remember programs executed over many runs.
+//
+// The file starts with the header line
+// "syzbloom1 bits=M hashes=K items=N fp=P\n" followed by the M bits
+// as little-endian 64-bit words. P is the estimated false positive rate
+// at the time the filter was written, it's informational only.
+package bloom
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+)
+
+const magic = "syzbloom1"
+
+// Filter is a Bloom filter. It's not safe for concurrent use.
+type Filter struct {
+	bits   []uint64
+	m      uint64 // number of bits
+	k      int    // number of hash functions
+	items  uint64 // number of distinct added keys, see Items
+	hashes []uint64
+}
+
+// New returns a filter sized for n keys with false positive rate fp.
+func New(n uint64, fp float64) (*Filter, error) {
+	if n == 0 || fp <= 0 || fp >= 1 {
+		return nil, fmt.Errorf("bad bloom filter parameters: %v keys, false positive rate %v", n, fp)
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return newFilter(m, k), nil
+}
+
+func newFilter(m uint64, k int) *Filter {
+	m = (m + 63) &^ 63
+	return &Filter{
+		bits:   make([]uint64, m/64),
+		m:      m,
+		k:      k,
+		hashes: make([]uint64, k),
+	}
+}
+
+// positions computes bit positions of key with double hashing.
+func (f *Filter) positions(key []byte) []uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	h1 := mix(h.Sum64())
+	h2 := mix(h1) | 1
+	for i := range f.hashes {
+		f.hashes[i] = (h1 + uint64(i)*h2) % f.m
+	}
+	return f.hashes
+}
+
+// mix is the splitmix64 finalizer, FNV alone distributes short keys poorly.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Test returns true if key was possibly added, and false if it was definitely not.
+func (f *Filter) Test(key []byte) bool {
+	for _, pos := range f.positions(key) {
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// TestAndAdd adds key and returns what Test returned before that.
+func (f *Filter) TestAndAdd(key []byte) bool {
+	present := true
+	for _, pos := range f.positions(key) {
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			present = false
+			f.bits[pos/64] |= 1 << (pos % 64)
+		}
+	}
+	if !present {
+		f.items++
+	}
+	return present
+}
+
+// Add adds key to the filter.
+func (f *Filter) Add(key []byte) {
+	f.TestAndAdd(key)
+}
+
+// Items returns the number of distinct keys added to the filter.
+// Keys that were false positives when added are not counted.
+func (f *Filter) Items() uint64 {
+	return f.items
+}
+
+// FalsePositiveRate returns the estimated false positive rate for the current number of items.
+func (f *Filter) FalsePositiveRate() float64 {
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.items)/float64(f.m)), float64(f.k))
+}
+
+// Write writes the filter to w.
+func (f *Filter) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%v bits=%v hashes=%v items=%v fp=%v\n", magic, f.m, f.k, f.items, f.FalsePositiveRate())
+	var buf [8]byte
+	for _, word := range f.bits {
+		binary.LittleEndian.PutUint64(buf[:], word)
+		bw.Write(buf[:])
+	}
+	return bw.Flush()
+}
+
+// Read reads a filter written by Write.
+func Read(r io.Reader) (*Filter, error) {
+	br := bufio.NewReader(r)
+	hdr, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("not a bloom filter file")
+	}
+	var m, items uint64
+	var k int
+	var fp float64
+	if _, err := fmt.Sscanf(hdr, magic+" bits=%d hashes=%d items=%d fp=%g\n", &m, &k, &items, &fp); err != nil {
+		return nil, fmt.Errorf("not a bloom filter file: %v", err)
+	}
+	if m == 0 || m%64 != 0 || k < 1 || k > 64 {
+		return nil, fmt.Errorf("bad bloom filter header %q", hdr)
+	}
+	f := &Filter{
+		m:      m,
+		k:      k,
+		items:  items,
+		hashes: make([]uint64, k),
+	}
+	// The bits are appended as they are read, so that a corrupted header
+	// does not make us allocate a huge filter.
+	words := m / 64
+	var buf [8]byte
+	for i := uint64(0); i < words; i++ {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return nil, fmt.Errorf("failed to read bloom filter word %v/%v: %v", i, words, err)
+		}
+		f.bits = append(f.bits, binary.LittleEndian.Uint64(buf[:]))
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("trailing data after %v bloom filter words", words)
+	}
+	return f, nil
+}
+
+// ReadFile reads a filter from file.
+func ReadFile(file string) (*Filter, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// WriteFile writes the filter into file atomically: it's written into a temporary file
+// that is then renamed over file, so a crash never leaves a truncated filter.
+func (f *Filter) WriteFile(file string) error {
+	tmp := file + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := f.Write(out); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package bloom
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func key(i int) []byte {
+	return []byte(fmt.Sprintf("key%v", i))
+}
+
+func TestAddTest(t *testing.T) {
+	const n = 1000
+	f, err := New(n, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Test(key(0)) || f.Items() != 0 {
+		t.Fatalf("empty filter contains a key or has %v items", f.Items())
+	}
+	for i := 0; i < n; i++ {
+		f.Add(key(i))
+	}
+	for i := 0; i < n; i++ {
+		if !f.Test(key(i)) {
+			t.Fatalf("added key %v is not found", i)
+		}
+		if !f.TestAndAdd(key(i)) {
+			t.Fatalf("added key %v is added again", i)
+		}
+	}
+	// Keys that were false positives are not counted, so there can be slightly fewer items.
+	if items := f.Items(); items > n || items < n*99/100 {
+		t.Fatalf("got %v items, added %v keys", items, n)
+	}
+}
+
+func TestFalsePositiveBound(t *testing.T) {
+	for _, fp := range []float64{0.1, 0.01, 0.001} {
+		const n, probes = 10000, 100000
+		f, err := New(n, fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < n; i++ {
+			f.Add(key(i))
+		}
+		if est := f.FalsePositiveRate(); est > 1.5*fp || est < fp/1.5 {
+			t.Errorf("fp %v: estimated false positive rate %v", fp, est)
+		}
+		positives := 0
+		for i := n; i < n+probes; i++ {
+			if f.Test(key(i)) {
+				positives++
+			}
+		}
+		if rate := float64(positives) / probes; rate > 1.5*fp {
+			t.Errorf("fp %v: measured false positive rate %v", fp, rate)
+		}
+	}
+}
+
+func TestNewBadParams(t *testing.T) {
+	for _, test := range []struct {
+		n  uint64
+		fp float64
+	}{{0, 0.01}, {10, 0}, {10, 1}, {10, -0.5}} {
+		if _, err := New(test.n, test.fp); err == nil {
+			t.Errorf("New(%v, %v) succeeded", test.n, test.fp)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	f, err := New(500, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		f.Add(key(i))
+	}
+	buf := new(bytes.Buffer)
+	if err := f.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	f1, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, f, f1)
+
+	dir, err := ioutil.TempDir("", "bloom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "filter")
+	if err := f.WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file is left behind: %v", err)
+	}
+	f2, err := ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkEqual(t, f, f2)
+}
+
+func checkEqual(t *testing.T, f, f1 *Filter) {
+	if f1.m != f.m || f1.k != f.k || f1.Items() != f.Items() || !reflect.DeepEqual(f1.bits, f.bits) {
+		t.Fatalf("loaded filter differs: %v bits, %v hashes, %v items", f1.m, f1.k, f1.Items())
+	}
+	for i := 0; i < 2000; i++ {
+		if f.Test(key(i)) != f1.Test(key(i)) {
+			t.Fatalf("loaded filter answers differently for key %v", i)
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	f, err := New(100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Add(key(0))
+	buf := new(bytes.Buffer)
+	if err := f.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+	hdrLen := bytes.IndexByte(valid, '\n') + 1
+	bits := valid[hdrLen:]
+	tests := map[string][]byte{
+		"empty":        nil,
+		"bad magic":    append([]byte("syzbloom2"), valid[len(magic):]...),
+		"no header":    bits,
+		"zero bits":    append([]byte(magic+" bits=0 hashes=7 items=1 fp=0\n"), bits...),
+		"odd bits":     append([]byte(magic+" bits=100 hashes=7 items=1 fp=0\n"), bits...),
+		"zero hashes":  append([]byte(fmt.Sprintf("%v bits=%v hashes=0 items=1 fp=0\n", magic, f.m)), bits...),
+		"many hashes":  append([]byte(fmt.Sprintf("%v bits=%v hashes=65 items=1 fp=0\n", magic, f.m)), bits...),
+		"huge filter":  append([]byte(magic+" bits=1152921504606846976 hashes=7 items=1 fp=0\n"), bits...),
+		"trailing":     append(append([]byte{}, valid...), 0),
+		"bad fp":       append([]byte(fmt.Sprintf("%v bits=%v hashes=7 items=1 fp=x\n", magic, f.m)), bits...),
+		"bad items":    append([]byte(fmt.Sprintf("%v bits=%v hashes=7 items=-1 fp=0\n", magic, f.m)), bits...),
+		"short header": valid[:hdrLen-1],
+	}
+	for n := hdrLen; n < len(valid); n += 3 {
+		tests[fmt.Sprintf("truncated to %v", n)] = valid[:n]
+	}
+	for name, data := range tests {
+		if _, err := Read(bytes.NewReader(data)); err == nil {
+			t.Errorf("%v: reading succeeded", name)
+		}
+	}
+	if _, err := Read(bytes.NewReader(valid)); err != nil {
+		t.Fatalf("failed to read the valid filter: %v", err)
+	}
+	if _, err := ReadFile(filepath.Join(os.TempDir(), "bloom-no-such-file")); err == nil ||
+		!strings.Contains(err.Error(), "no such file") {
+		t.Fatalf("reading a missing file: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package constants reports distributions of scalar argument values in a corpus.
+//
+// The report is used to audit descriptions: an argument that has the same value
+// in almost all corpus programs is either never varied by mutation or
+// over-constrained by its description.
+package constants
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/google/syzkaller/prog"
+)
+
+const (
+	// An argument is flagged if more than Threshold of the programs that use it
+	// use a single value only.
+	Threshold = 0.95
+	// Arguments used by fewer programs are never flagged.
+	MinPrograms = 10
+)
+
+// Arg is the value distribution of a single argument of a syscall.
+type Arg struct {
+	Call string
+	// Path names the argument within the call, e.g. "addr.sa_family" or "msg.iov[*].len".
+	// Unions are named by the selected variant, so each variant is reported separately.
+	Path string
+	// Values maps every observed value to the number of its occurrences.
+	Values map[uint64]int
+	// Programs is the number of corpus programs that use the argument.
+	Programs int
+	// Top is the value that most programs use exclusively,
+	// TopPrograms is the number of such programs.
+	Top         uint64
+	TopPrograms int
+	// Constant is set if the argument looks constant (see Threshold).
+	Constant bool
+
+	single map[uint64]int
+}
+
+// Report holds distributions of all arguments sorted by call and path.
+type Report struct {
+	Args []*Arg
+}
+
+// Analyze collects values of all scalar arguments of corpus programs.
+// Arguments that can't be varied (const and len types) and output arguments are skipped.
+func Analyze(corpus []*prog.Prog) *Report {
+	args := make(map[string]*Arg)
+	for _, p := range corpus {
+		// Values of every argument in this program.
+		seen := make(map[*Arg]map[uint64]bool)
+		for _, c := range p.Calls {
+			for _, arg := range c.Args {
+				collect(c.Meta.Name, argName(arg), arg, func(call, path string, val uint64) {
+					key := call + " " + path
+					a := args[key]
+					if a == nil {
+						a = &Arg{Call: call, Path: path, Values: make(map[uint64]int), single: make(map[uint64]int)}
+						args[key] = a
+					}
+					a.Values[val]++
+					if seen[a] == nil {
+						seen[a] = make(map[uint64]bool)
+					}
+					seen[a][val] = true
+				})
+			}
+		}
+		for a, vals := range seen {
+			a.Programs++
+			if len(vals) != 1 {
+				continue
+			}
+			for val := range vals {
+				a.single[val]++
+			}
+		}
+	}
+	rep := new(Report)
+	for _, a := range args {
+		for val, n := range a.single {
+			if n > a.TopPrograms || n == a.TopPrograms && val < a.Top {
+				a.Top, a.TopPrograms = val, n
+			}
+		}
+		a.single = nil
+		a.Constant = a.Programs >= MinPrograms && float64(a.TopPrograms) > Threshold*float64(a.Programs)
+		rep.Args = append(rep.Args, a)
+	}
+	sort.Slice(rep.Args, func(i, j int) bool {
+		if rep.Args[i].Call != rep.Args[j].Call {
+			return rep.Args[i].Call < rep.Args[j].Call
+		}
+		return rep.Args[i].Path < rep.Args[j].Path
+	})
+	return rep
+}
+
+func collect(call, path string, arg prog.Arg, f func(call, path string, val uint64)) {
+	if arg == nil {
+		return
+	}
+	switch a := arg.(type) {
+	case *prog.ConstArg:
+		switch a.Type().(type) {
+		case *prog.ConstType, *prog.LenType:
+			return
+		}
+		if a.Type().Dir() != prog.DirOut {
+			f(call, path, a.Val)
+		}
+	case *prog.PointerArg:
+		collect(call, path, a.Res, f)
+	case *prog.UnionArg:
+		collect(call, path+"."+argName(a.Option), a.Option, f)
+	case *prog.GroupArg:
+		if _, ok := a.Type().(*prog.ArrayType); ok {
+			for _, inner := range a.Inner {
+				collect(call, path+"[*]", inner, f)
+			}
+			return
+		}
+		for _, inner := range a.Inner {
+			collect(call, path+"."+argName(inner), inner, f)
+		}
+	}
+}
+
+func argName(arg prog.Arg) string {
+	if name := arg.Type().FieldName(); name != "" {
+		return name
+	}
+	return arg.Type().Name()
+}
+
+// Number of most frequent values listed per argument in CSV.
+const csvValues = 5
+
+// CSV returns the report in CSV format with one row per argument:
+// call, path, number of programs, number of distinct values, the top value,
+// the fraction of programs that use only the top value, the constant flag and
+// the most frequent values with their occurrence counts.
+func (rep *Report) CSV() []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "call,path,programs,distinct,top,top_fraction,constant,values\n")
+	for _, a := range rep.Args {
+		var vals []uint64
+		for val := range a.Values {
+			vals = append(vals, val)
+		}
+		sort.Slice(vals, func(i, j int) bool {
+			if a.Values[vals[i]] != a.Values[vals[j]] {
+				return a.Values[vals[i]] > a.Values[vals[j]]
+			}
+			return vals[i] < vals[j]
+		})
+		if len(vals) > csvValues {
+			vals = vals[:csvValues]
+		}
+		top := new(bytes.Buffer)
+		for i, val := range vals {
+			if i != 0 {
+				top.WriteByte(' ')
+			}
+			fmt.Fprintf(top, "0x%x:%v", val, a.Values[val])
+		}
+		fmt.Fprintf(buf, "%v,%v,%v,%v,0x%x,%.3f,%v,%v\n", a.Call, a.Path, a.Programs, len(a.Values),
+			a.Top, float64(a.TopPrograms)/float64(a.Programs), a.Constant, top)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package csource
+
+import (
+	"github.com/google/syzkaller/prog"
+)
+
+// BundleVariant is a variant of a C reproducer in a bundle, see WriteBundle.
+type BundleVariant struct {
+	Name        string
+	Description string
+	// Tweak changes the base options along one axis.
+	Tweak func(opts *Options)
+}
+
+// BundleVariants are the variants WriteBundle generates, in the order they should be presented.
+var BundleVariants = []BundleVariant{
+	{"plain", "single execution", func(opts *Options) {}},
+	{"repeat", "execution in an infinite loop", func(opts *Options) {
+		opts.Repeat = true
+	}},
+	{"multiproc", "execution in an infinite loop in 8 processes", func(opts *Options) {
+		opts.Repeat = true
+		opts.Procs = 8
+	}},
+	{"namespace", "single execution in a namespace sandbox", func(opts *Options) {
+		opts.Sandbox = sandboxNamespace
+	}},
+}
+
+// WriteBundle generates C reproducers for p for all BundleVariants derived from base.
+// It returns the sources keyed by variant name. Variants that are not valid for the target
+// (e.g. the namespace sandbox on a target without it) are not generated,
+// skipped holds the reason for every such variant.
+func WriteBundle(p *prog.Prog, base Options) (srcs map[string][]byte, skipped map[string]string) {
+	srcs = make(map[string][]byte)
+	skipped = make(map[string]string)
+	for _, variant := range BundleVariants {
+		opts := base
+		variant.Tweak(&opts)
+		if err := opts.Check(p.Target.OS); err != nil {
+			skipped[variant.Name] = err.Error()
+			continue
+		}
+		src, err := Write(p, opts)
+		if err != nil {
+			skipped[variant.Name] = err.Error()
+			continue
+		}
+		if formatted, err := Format(src); err == nil {
+			src = formatted
+		}
+		srcs[variant.Name] = src
+	}
+	return
+}
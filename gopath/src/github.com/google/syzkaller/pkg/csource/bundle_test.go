@@ -0,0 +1,62 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package csource
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestWriteBundle(t *testing.T) {
+	tests := []struct {
+		os, arch string
+		// Variants that must be skipped for the target.
+		skipped []string
+	}{
+		{"linux", "amd64", nil},
+		{"test", "64", []string{"namespace"}},
+	}
+	for _, test := range tests {
+		t.Run(test.os+"/"+test.arch, func(t *testing.T) {
+			target, err := prog.GetTarget(test.os, test.arch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := target.Generate(rand.NewSource(0), 5, target.DefaultChoiceTable())
+			base := Options{
+				Procs:     1,
+				Sandbox:   sandboxNone,
+				UseTmpDir: true,
+				Repro:     true,
+			}
+			srcs, skipped := WriteBundle(p, base)
+			wantSkipped := make(map[string]bool)
+			for _, name := range test.skipped {
+				wantSkipped[name] = true
+			}
+			for _, variant := range BundleVariants {
+				src, reason := srcs[variant.Name], skipped[variant.Name]
+				switch {
+				case src != nil && reason != "":
+					t.Errorf("variant %v is both generated and skipped: %v", variant.Name, reason)
+				case wantSkipped[variant.Name] && reason == "":
+					t.Errorf("variant %v is not skipped", variant.Name)
+				case !wantSkipped[variant.Name] && len(src) == 0:
+					t.Errorf("variant %v is not generated: %v", variant.Name, reason)
+				}
+			}
+			if len(srcs)+len(skipped) != len(BundleVariants) {
+				t.Errorf("got %v sources and %v skipped variants for %v variants",
+					len(srcs), len(skipped), len(BundleVariants))
+			}
+			if srcs["plain"] != nil && bytes.Equal(srcs["plain"], srcs["repeat"]) {
+				t.Errorf("plain and repeat variants are the same")
+			}
+		})
+	}
+}
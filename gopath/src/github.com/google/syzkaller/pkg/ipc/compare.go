@@ -0,0 +1,37 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package ipc
+
+import (
+	"github.com/google/syzkaller/prog"
+)
+
+// CallDiff is a call whose errno differs between two executions of a program.
+type CallDiff struct {
+	Call   int // index of the call in the program
+	Name   string
+	Errno0 int
+	Errno1 int
+}
+
+// DiffErrnos compares errno of calls of p that finished in both executions described
+// by info0 and info1. Calls for which allowed returns true (it may be nil) are expected
+// to differ and are skipped.
+func DiffErrnos(p *prog.Prog, info0, info1 *ProgInfo, allowed func(name string) bool) []CallDiff {
+	var diffs []CallDiff
+	for i, c := range p.Calls {
+		if i >= len(info0.Calls) || i >= len(info1.Calls) {
+			break
+		}
+		ci0, ci1 := &info0.Calls[i], &info1.Calls[i]
+		if ci0.Flags&ci1.Flags&CallFinished == 0 || ci0.Errno == ci1.Errno {
+			continue
+		}
+		if allowed != nil && allowed(c.Meta.Name) {
+			continue
+		}
+		diffs = append(diffs, CallDiff{i, c.Meta.Name, ci0.Errno, ci1.Errno})
+	}
+	return diffs
+}
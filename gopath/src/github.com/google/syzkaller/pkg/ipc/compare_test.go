@@ -0,0 +1,63 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package ipc_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestDiffErrnos(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(target.Syscalls) < 4 {
+		t.Skip("need 4 different syscalls")
+	}
+	p := &prog.Prog{Target: target}
+	for i := 0; i < 4; i++ {
+		p.Calls = append(p.Calls, &prog.Call{Meta: target.Syscalls[i]})
+	}
+	info := func(errnos ...int) *ProgInfo {
+		info := new(ProgInfo)
+		for _, errno := range errnos {
+			flags := CallExecuted | CallFinished
+			if errno < 0 {
+				flags, errno = CallExecuted, 0
+			}
+			info.Calls = append(info.Calls, CallInfo{Flags: flags, Errno: errno})
+		}
+		return info
+	}
+	for i, test := range []struct {
+		info0, info1 *ProgInfo
+		allowed      func(string) bool
+		want         string
+	}{
+		{info(0, 1, 2, 3), info(0, 1, 2, 3), nil, "[]"},
+		{info(0, 1, 2, 3), info(0, 2, 2, 4), nil, "[{1 1 2} {3 3 4}]"},
+		// Calls that did not finish in either execution are not compared.
+		{info(0, -1, 2, 3), info(5, 1, 2, -1), nil, "[{0 0 5}]"},
+		// Missing call infos are not compared.
+		{info(0, 1), info(0, 2, 2, 3), nil, "[{1 1 2}]"},
+		{info(0, 1, 2, 3), info(0, 2, 2, 4), func(name string) bool { return name == p.Calls[3].Meta.Name }, "[{1 1 2}]"},
+	} {
+		var got []string
+		for _, d := range DiffErrnos(p, test.info0, test.info1, test.allowed) {
+			if d.Name != p.Calls[d.Call].Meta.Name {
+				t.Errorf("#%v: call %v is named %v", i, d.Call, d.Name)
+			}
+			got = append(got, fmt.Sprintf("{%v %v %v}", d.Call, d.Errno0, d.Errno1))
+		}
+		if "["+strings.Join(got, " ")+"]" != test.want {
+			t.Errorf("#%v: got %v, want %v", i, got, test.want)
+		}
+	}
+}
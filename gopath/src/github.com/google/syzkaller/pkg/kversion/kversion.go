@@ -0,0 +1,147 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package kversion checks programs against the kernel version that introduced
+// the syscalls and ioctl commands they use.
+//
+// Versions come from an external table with one "NAME VERSION" entry per line.
+// NAME is a glob pattern matched against syscall names (e.g. "io_uring_*" or
+// "ioctl$KVM_CAP_*"), or "ioctl:CMD" for an ioctl command given as a number or
+// a const name. Later entries override earlier ones. Calls that are not in the
+// table are assumed to be available in all versions.
+package kversion
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/prog"
+)
+
+// Version is a kernel version, e.g. 5.4.0.
+type Version [3]int
+
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	parts := strings.Split(s, ".")
+	if len(parts) > len(v) {
+		return v, fmt.Errorf("bad kernel version %q", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("bad kernel version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v Version) Less(v1 Version) bool {
+	for i := range v {
+		if v[i] != v1[i] {
+			return v[i] < v1[i]
+		}
+	}
+	return false
+}
+
+func (v Version) String() string {
+	if v[2] == 0 {
+		return fmt.Sprintf("%v.%v", v[0], v[1])
+	}
+	return fmt.Sprintf("%v.%v.%v", v[0], v[1], v[2])
+}
+
+// Table maps syscalls and ioctl commands of a target to the versions that introduced them.
+type Table struct {
+	calls  map[int]Version // indexed by syscall ID
+	ioctls map[uint64]Version
+}
+
+func Parse(target *prog.Target, data []byte) (*Table, error) {
+	t := &Table{
+		calls:  make(map[int]Version),
+		ioctls: make(map[uint64]Version),
+	}
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %v: want 'NAME VERSION'", line)
+		}
+		v, err := ParseVersion(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		if cmd := strings.TrimPrefix(fields[0], "ioctl:"); cmd != fields[0] {
+			val, err := strconv.ParseUint(cmd, 0, 64)
+			if err != nil {
+				var ok bool
+				if val, ok = target.ConstMap[cmd]; !ok {
+					return nil, fmt.Errorf("line %v: unknown ioctl command %q", line, cmd)
+				}
+			}
+			t.ioctls[val] = v
+			continue
+		}
+		matched := false
+		for _, c := range target.Syscalls {
+			ok, err := path.Match(fields[0], c.Name)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: bad pattern %q: %v", line, fields[0], err)
+			}
+			if ok {
+				t.calls[c.ID] = v
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("line %v: %q does not match any syscall", line, fields[0])
+		}
+	}
+	return t, s.Err()
+}
+
+// Missing is a call of a program that is not available in the checked version.
+type Missing struct {
+	Call int
+	// Name is the syscall name, or ioctl:CMD for a command that is newer than the ioctl variant.
+	Name    string
+	Version Version
+}
+
+// Check returns calls of p that were introduced after version v.
+func (t *Table) Check(p *prog.Prog, v Version) []Missing {
+	var res []Missing
+	for i, c := range p.Calls {
+		if cv, ok := t.calls[c.Meta.ID]; ok && v.Less(cv) {
+			res = append(res, Missing{i, c.Meta.Name, cv})
+			continue
+		}
+		if c.Meta.CallName != "ioctl" || len(c.Args) < 2 {
+			continue
+		}
+		if cmd, ok := c.Args[1].(*prog.ConstArg); ok {
+			if cv, ok := t.ioctls[cmd.Val]; ok && v.Less(cv) {
+				res = append(res, Missing{i, fmt.Sprintf("ioctl:%#x", cmd.Val), cv})
+			}
+		}
+	}
+	return res
+}
+
+// Score returns the fraction of calls of p that are available in version v.
+func (t *Table) Score(p *prog.Prog, v Version) float64 {
+	if len(p.Calls) == 0 {
+		return 1
+	}
+	return 1 - float64(len(t.Check(p, v)))/float64(len(p.Calls))
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package log
+
+import (
+	golog "log"
+	"sync"
+)
+
+var (
+	tagMu sync.Mutex
+	tag   string
+)
+
+// SetTag tags all subsequent log output of the process with tag,
+// so that logs of several processes written to one place can be told apart.
+// Log lines are printed through the standard logger, the tag goes into its prefix.
+// Lines cached by EnableLogCaching are not tagged. An empty tag removes the tag.
+func SetTag(t string) {
+	tagMu.Lock()
+	defer tagMu.Unlock()
+	tag = t
+	if t == "" {
+		golog.SetPrefix("")
+		return
+	}
+	golog.SetPrefix(t + " ")
+}
+
+// Tag returns the tag set with SetTag.
+func Tag() string {
+	tagMu.Lock()
+	defer tagMu.Unlock()
+	return tag
+}
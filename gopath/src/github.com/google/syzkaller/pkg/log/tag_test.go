@@ -0,0 +1,37 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package log
+
+import (
+	"bytes"
+	golog "log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetTag(t *testing.T) {
+	buf := new(bytes.Buffer)
+	golog.SetOutput(buf)
+	flags := golog.Flags()
+	golog.SetFlags(0)
+	defer func() {
+		SetTag("")
+		golog.SetFlags(flags)
+		golog.SetOutput(os.Stderr)
+	}()
+	SetTag("run1")
+	if Tag() != "run1" {
+		t.Fatalf("tag is %q, want run1", Tag())
+	}
+	Logf(0, "tagged")
+	SetTag("")
+	Logf(0, "untagged")
+	if got, want := buf.String(), "run1 tagged\nuntagged\n"; got != want {
+		t.Fatalf("got output %q, want %q", got, want)
+	}
+	if strings.Contains(golog.Prefix(), "run1") {
+		t.Fatalf("tag is left in the prefix %q", golog.Prefix())
+	}
+}
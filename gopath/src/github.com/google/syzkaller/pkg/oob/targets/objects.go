@@ -0,0 +1,113 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package targets
+
+// Objects is the table of known target objects.
+// Layouts are for x86_64 builds without debug options that change struct layout
+// (e.g. lockdep), verify them with pahole for the kernel under test.
+var Objects = []*Object{
+	{
+		Name: "struct msg_msg",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			MinSize: 64,
+			MaxSize: 4096,
+			Fields: []Field{
+				{Name: "m_list.next", Offset: 0, Size: 8, Pointer: true},
+				{Name: "m_list.prev", Offset: 8, Size: 8, Pointer: true},
+				{Name: "m_type", Offset: 16, Size: 8},
+				{Name: "m_ts", Offset: 24, Size: 8},
+				{Name: "next", Offset: 32, Size: 8, Pointer: true},
+				{Name: "security", Offset: 40, Size: 8, Pointer: true},
+			},
+		}},
+	},
+	{
+		Name: "struct seq_operations",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			MinSize: 32,
+			MaxSize: 32,
+			Fields: []Field{
+				{Name: "start", Offset: 0, Size: 8, Pointer: true},
+				{Name: "stop", Offset: 8, Size: 8, Pointer: true},
+				{Name: "next", Offset: 16, Size: 8, Pointer: true},
+				{Name: "show", Offset: 24, Size: 8, Pointer: true},
+			},
+		}},
+	},
+	{
+		Name: "struct shm_file_data",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			MinSize: 32,
+			MaxSize: 32,
+			Fields: []Field{
+				{Name: "id", Offset: 0, Size: 4},
+				{Name: "ns", Offset: 8, Size: 8, Pointer: true},
+				{Name: "file", Offset: 16, Size: 8, Pointer: true},
+				{Name: "vm_ops", Offset: 24, Size: 8, Pointer: true},
+			},
+		}},
+	},
+	{
+		Name: "struct subprocess_info",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			MinSize: 128,
+			MaxSize: 128,
+			Fields: []Field{
+				{Name: "work.data", Offset: 0, Size: 8},
+				{Name: "work.entry", Offset: 8, Size: 16, Pointer: true},
+				{Name: "work.func", Offset: 24, Size: 8, Pointer: true},
+			},
+		}},
+	},
+	{
+		Name: "struct pipe_buffer[]",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			MinSize: 1024,
+			MaxSize: 1024,
+			Fields: []Field{
+				{Name: "bufs[0].page", Offset: 0, Size: 8, Pointer: true},
+				{Name: "bufs[0].offset", Offset: 8, Size: 4},
+				{Name: "bufs[0].len", Offset: 12, Size: 4},
+				{Name: "bufs[0].ops", Offset: 16, Size: 8, Pointer: true},
+				{Name: "bufs[0].flags", Offset: 24, Size: 4},
+				{Name: "bufs[0].private", Offset: 32, Size: 8},
+			},
+		}},
+	},
+	{
+		Name: "struct tty_struct",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			MinSize: 1024,
+			MaxSize: 1024,
+			Fields: []Field{
+				{Name: "magic", Offset: 0, Size: 4},
+				{Name: "kref", Offset: 4, Size: 4},
+				{Name: "dev", Offset: 8, Size: 8, Pointer: true},
+				{Name: "driver", Offset: 16, Size: 8, Pointer: true},
+				{Name: "ops", Offset: 24, Size: 8, Pointer: true},
+			},
+		}},
+	},
+	{
+		Name: "struct file",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			Cache:   "filp",
+			Fields: []Field{
+				{Name: "f_u", Offset: 0, Size: 16, Pointer: true},
+				{Name: "f_path.mnt", Offset: 16, Size: 8, Pointer: true},
+				{Name: "f_path.dentry", Offset: 24, Size: 8, Pointer: true},
+				{Name: "f_inode", Offset: 32, Size: 8, Pointer: true},
+				{Name: "f_op", Offset: 40, Size: 8, Pointer: true},
+				{Name: "f_count", Offset: 56, Size: 8},
+			},
+		}},
+	},
+}
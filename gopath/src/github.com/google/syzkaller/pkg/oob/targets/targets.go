@@ -0,0 +1,148 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package targets matches out-of-bounds access capabilities with kernel objects
+// that are useful to corrupt (or leak) when they are allocated next to the vulnerable object.
+//
+// An out-of-bounds access past the end of an object in a slab cache lands in the adjacent
+// slot of the same cache. If an object from Objects is allocated in that slot, the access
+// overlaps some of its fields. Match returns such objects ranked by the fields overlapped.
+package targets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Capability is an out-of-bounds access extracted from a KASAN report.
+type Capability struct {
+	Write bool
+	// Cache is the slab cache of the vulnerable object (e.g. kmalloc-64) and CacheSize is its object size.
+	Cache     string
+	CacheSize int
+	// Offset is the offset of the access from the start of the adjacent slot, Size is the access size.
+	Offset int
+	Size   int
+	// Kernel is the kernel version (e.g. 5.4), empty if unknown.
+	Kernel string
+}
+
+func (c Capability) String() string {
+	access := "read"
+	if c.Write {
+		access = "write"
+	}
+	return fmt.Sprintf("%v of size %v at offset %v of the next %v slot", access, c.Size, c.Offset, c.Cache)
+}
+
+type Field struct {
+	Name   string
+	Offset int
+	Size   int
+	// Pointer is set for fields holding kernel pointers (function pointers, ops tables, lists),
+	// corrupting or leaking them is most useful.
+	Pointer bool
+}
+
+// Object is a kernel object that is a useful exploitation target.
+type Object struct {
+	Name     string
+	Variants []Variant
+}
+
+// Variant is the layout of an object in some kernel versions, struct sizes and
+// field offsets drift across versions.
+type Variant struct {
+	// Kernels are version prefixes the variant applies to (e.g. "5." or "4.19").
+	Kernels []string
+	// Cache is the dedicated cache of the object, or empty if the object comes from
+	// kmalloc caches of sizes [MinSize, MaxSize].
+	Cache   string
+	MinSize int
+	MaxSize int
+	Fields  []Field
+}
+
+// Candidate is an object a capability can reach and the fields it overlaps.
+type Candidate struct {
+	Object  *Object
+	Variant *Variant
+	Fields  []Field
+	Score   int
+}
+
+// Match returns objects that can be allocated in the slot adjacent to the vulnerable
+// object and have fields overlapped by the access, best candidates first.
+func Match(c Capability) []Candidate {
+	var res []Candidate
+	if c.Offset < 0 || c.Size <= 0 {
+		return nil
+	}
+	for _, obj := range Objects {
+		for i := range obj.Variants {
+			v := &obj.Variants[i]
+			if !v.matchKernel(c.Kernel) || !v.matchCache(c.Cache, c.CacheSize) {
+				continue
+			}
+			cand := Candidate{Object: obj, Variant: v}
+			for _, f := range v.Fields {
+				if c.Offset < f.Offset+f.Size && f.Offset < c.Offset+c.Size {
+					cand.Fields = append(cand.Fields, f)
+					cand.Score++
+					if f.Pointer {
+						cand.Score += 2
+					}
+				}
+			}
+			if len(cand.Fields) != 0 {
+				res = append(res, cand)
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Score > res[j].Score
+	})
+	return res
+}
+
+func (v *Variant) matchKernel(kernel string) bool {
+	if kernel == "" {
+		return true
+	}
+	for _, prefix := range v.Kernels {
+		if strings.HasPrefix(kernel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *Variant) matchCache(cache string, size int) bool {
+	if v.Cache != "" {
+		return v.Cache == cache
+	}
+	return strings.HasPrefix(cache, "kmalloc-") && size >= v.MinSize && size <= v.MaxSize
+}
+
+// Report formats candidates for c in human-readable form.
+func Report(c Capability, cands []Candidate) string {
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "capability: %v (kernel %v)\n", c, c.Kernel)
+	if len(cands) == 0 {
+		fmt.Fprintf(buf, "no known target objects\n")
+		return buf.String()
+	}
+	what := "leak"
+	if c.Write {
+		what = "corrupt"
+	}
+	for _, cand := range cands {
+		var fields []string
+		for _, f := range cand.Fields {
+			fields = append(fields, fmt.Sprintf("%v@%v", f.Name, f.Offset))
+		}
+		fmt.Fprintf(buf, "%4v %v: %v %v\n", cand.Score, cand.Object.Name, what, strings.Join(fields, ", "))
+	}
+	return buf.String()
+}
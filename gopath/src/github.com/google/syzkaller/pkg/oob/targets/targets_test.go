@@ -0,0 +1,155 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package targets
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testObjects = []*Object{
+	{
+		Name: "struct a",
+		Variants: []Variant{{
+			Kernels: []string{"5."},
+			MinSize: 64,
+			MaxSize: 128,
+			Fields: []Field{
+				{Name: "f0", Offset: 0, Size: 8, Pointer: true},
+				{Name: "f1", Offset: 8, Size: 4},
+				{Name: "f2", Offset: 16, Size: 8, Pointer: true},
+			},
+		}},
+	},
+	{
+		Name: "struct b",
+		Variants: []Variant{{
+			Kernels: []string{"4.19"},
+			Cache:   "filp",
+			Fields: []Field{
+				{Name: "g", Offset: 0, Size: 8},
+			},
+		}},
+	},
+	{
+		Name: "struct c",
+		Variants: []Variant{{
+			Kernels: []string{"4.", "5."},
+			MinSize: 32,
+			MaxSize: 64,
+			Fields: []Field{
+				{Name: "h", Offset: 4, Size: 4},
+			},
+		}},
+	},
+}
+
+func TestMatch(t *testing.T) {
+	defer func(objects []*Object) { Objects = objects }(Objects)
+	Objects = testObjects
+	tests := []struct {
+		c    Capability
+		want []string
+	}{
+		{
+			c:    Capability{Write: true, Cache: "kmalloc-64", CacheSize: 64, Offset: 0, Size: 8, Kernel: "5.4"},
+			want: []string{"struct a:3:f0", "struct c:1:h"},
+		},
+		{
+			c:    Capability{Cache: "kmalloc-128", CacheSize: 128, Offset: 8, Size: 16},
+			want: []string{"struct a:4:f1,f2"},
+		},
+		{
+			c:    Capability{Cache: "filp", Offset: 0, Size: 1, Kernel: "4.19.1"},
+			want: []string{"struct b:1:g"},
+		},
+		{
+			// Kernel version does not match the only filp variant.
+			c: Capability{Cache: "filp", Offset: 0, Size: 1, Kernel: "5.4"},
+		},
+		{
+			// The access falls between fields.
+			c: Capability{Cache: "kmalloc-64", CacheSize: 64, Offset: 12, Size: 4, Kernel: "5.4"},
+		},
+		{
+			// The cache is too large for all kmalloc variants.
+			c: Capability{Cache: "kmalloc-256", CacheSize: 256, Offset: 0, Size: 8},
+		},
+		{
+			c: Capability{Cache: "kmalloc-64", CacheSize: 64, Offset: -8, Size: 8},
+		},
+		{
+			c: Capability{Cache: "kmalloc-64", CacheSize: 64, Offset: 0, Size: 0},
+		},
+	}
+	for i, test := range tests {
+		var got []string
+		for _, cand := range Match(test.c) {
+			var fields []string
+			for _, f := range cand.Fields {
+				fields = append(fields, f.Name)
+			}
+			got = append(got, fmt.Sprintf("%v:%v:%v", cand.Object.Name, cand.Score, strings.Join(fields, ",")))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("#%v: Match(%+v) = %q, want %q", i, test.c, got, test.want)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	defer func(objects []*Object) { Objects = objects }(Objects)
+	Objects = testObjects
+	tests := []struct {
+		c    Capability
+		want string
+	}{
+		{
+			c: Capability{Write: true, Cache: "kmalloc-64", CacheSize: 64, Offset: 0, Size: 8, Kernel: "5.4"},
+			want: "capability: write of size 8 at offset 0 of the next kmalloc-64 slot (kernel 5.4)\n" +
+				"   3 struct a: corrupt f0@0\n" +
+				"   1 struct c: corrupt h@4\n",
+		},
+		{
+			c: Capability{Cache: "kmalloc-128", CacheSize: 128, Offset: 8, Size: 16, Kernel: "5.10"},
+			want: "capability: read of size 16 at offset 8 of the next kmalloc-128 slot (kernel 5.10)\n" +
+				"   4 struct a: leak f1@8, f2@16\n",
+		},
+		{
+			c: Capability{Cache: "kmalloc-256", CacheSize: 256, Offset: 0, Size: 8, Kernel: "5.4"},
+			want: "capability: read of size 8 at offset 0 of the next kmalloc-256 slot (kernel 5.4)\n" +
+				"no known target objects\n",
+		},
+	}
+	for i, test := range tests {
+		if got := Report(test.c, Match(test.c)); got != test.want {
+			t.Errorf("#%v: got:\n%v\nwant:\n%v", i, got, test.want)
+		}
+	}
+}
+
+func TestObjects(t *testing.T) {
+	for _, obj := range Objects {
+		for _, v := range obj.Variants {
+			if len(v.Kernels) == 0 {
+				t.Errorf("%v: no kernel versions", obj.Name)
+			}
+			if v.Cache == "" && (v.MinSize <= 0 || v.MinSize > v.MaxSize) {
+				t.Errorf("%v: bad size range [%v, %v]", obj.Name, v.MinSize, v.MaxSize)
+			}
+			end := 0
+			for _, f := range v.Fields {
+				if f.Offset < end || f.Size <= 0 {
+					t.Errorf("%v: field %v overlaps the previous one or is empty", obj.Name, f.Name)
+				}
+				end = f.Offset + f.Size
+				if v.Cache == "" && end > v.MaxSize {
+					t.Errorf("%v: field %v is outside of the object", obj.Name, f.Name)
+				}
+			}
+		}
+	}
+}
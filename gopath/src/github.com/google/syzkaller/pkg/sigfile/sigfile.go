@@ -0,0 +1,89 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package sigfile reads and writes sets of coverage signal, e.g. to pass the signal
+// already covered by syz-manager to syz-stress or between consecutive syz-stress runs.
+//
+// The file starts with the magic line "syzsig1\n" followed by the number of
+// signal values and the sorted values as deltas from the previous value,
+// all encoded as unsigned varints.
+package sigfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const magic = "syzsig1\n"
+
+// Write writes signal to w. The order of values in signal does not matter.
+func Write(w io.Writer, signal []uint32) error {
+	sorted := append([]uint32{}, signal...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	var buf [binary.MaxVarintLen64]byte
+	bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(sorted)))])
+	prev := uint32(0)
+	for _, s := range sorted {
+		bw.Write(buf[:binary.PutUvarint(buf[:], uint64(s-prev))])
+		prev = s
+	}
+	return bw.Flush()
+}
+
+// Read reads signal written by Write. Values are returned sorted.
+func Read(r io.Reader) ([]uint32, error) {
+	br := bufio.NewReader(r)
+	hdr := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, hdr); err != nil || string(hdr) != magic {
+		return nil, fmt.Errorf("not a signal file")
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signal count: %v", err)
+	}
+	var signal []uint32
+	prev := uint64(0)
+	for i := uint64(0); i < n; i++ {
+		delta, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signal %v/%v: %v", i, n, err)
+		}
+		prev += delta
+		if prev > 1<<32-1 {
+			return nil, fmt.Errorf("signal %v/%v is out of range", i, n)
+		}
+		signal = append(signal, uint32(prev))
+	}
+	return signal, nil
+}
+
+// ReadFile reads signal from file.
+func ReadFile(file string) ([]uint32, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// WriteFile writes signal into file.
+func WriteFile(file string, signal []uint32) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, signal); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
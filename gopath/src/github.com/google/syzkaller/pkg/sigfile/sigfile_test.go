@@ -0,0 +1,123 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package sigfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(0))
+	var random []uint32
+	for i := 0; i < 10000; i++ {
+		random = append(random, rnd.Uint32())
+	}
+	tests := [][]uint32{
+		nil,
+		{0},
+		{1<<32 - 1},
+		{5, 3, 1, 3, 0, 1<<32 - 1},
+		random,
+	}
+	for i, signal := range tests {
+		buf := new(bytes.Buffer)
+		if err := Write(buf, signal); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(buf)
+		if err != nil {
+			t.Fatalf("#%v: %v", i, err)
+		}
+		want := append([]uint32{}, signal...)
+		sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+		if len(want) == 0 {
+			want = nil
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("#%v: got %v values, want %v", i, len(got), len(want))
+		}
+	}
+}
+
+func TestRoundTripFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "signal")
+	if err := WriteFile(file, []uint32{30, 10, 20}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint32{10, 20, 30}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if _, err := ReadFile(filepath.Join(dir, "missing")); err == nil {
+		t.Fatalf("reading a missing file succeeded")
+	}
+}
+
+func TestBadMagic(t *testing.T) {
+	valid := new(bytes.Buffer)
+	if err := Write(valid, []uint32{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []string{
+		"",
+		"syzsig",
+		"syzsig2\n",
+		"SYZSIG1\n",
+		"syzsig1 ",
+		"\n" + valid.String(),
+		valid.String()[1:],
+	}
+	for i, data := range tests {
+		_, err := Read(strings.NewReader(data))
+		if err == nil || err.Error() != "not a signal file" {
+			t.Errorf("#%v: got error %v, want bad magic", i, err)
+		}
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	// Values with multi-byte varint deltas, so that files are also cut inside a value.
+	buf := new(bytes.Buffer)
+	if err := Write(buf, []uint32{1000, 1 << 20, 1<<32 - 1}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for n := 0; n < len(data); n++ {
+		if _, err := Read(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("reading the first %v/%v bytes succeeded", n, len(data))
+		}
+	}
+	if _, err := Read(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutOfRange(t *testing.T) {
+	buf := bytes.NewBufferString(magic)
+	var tmp [binary.MaxVarintLen64]byte
+	for _, v := range []uint64{2, 1<<32 - 1, 1} {
+		buf.Write(tmp[:binary.PutUvarint(tmp[:], v)])
+	}
+	_, err := Read(buf)
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("got error %v, want out of range", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package vuln describes a known vulnerability that fuzzing is steered towards.
+//
+// A description is a JSON file of the form:
+//
+//	{
+//		"id": "CVE-2017-7308",
+//		"syscalls": ["setsockopt$packet_rx_ring"],
+//		"prelude": ["r0 = socket$packet(0x11, 0x3, 0x300)"],
+//		"alloc_site": "packet_set_ring"
+//	}
+//
+// id identifies the vulnerability in artifacts, syscalls lists the vulnerable
+// syscalls that every generated program must contain, prelude lists calls
+// (in program syntax, arguments may be omitted) that must precede them,
+// and alloc_site is a regexp matched against KASAN reports to select reports
+// about the vulnerable object.
+package vuln
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/google/syzkaller/prog"
+)
+
+type Vuln struct {
+	ID        string   `json:"id"`
+	Syscalls  []string `json:"syscalls"`
+	Prelude   []string `json:"prelude"`
+	AllocSite string   `json:"alloc_site"`
+
+	// AllocSiteRe is the compiled AllocSite, nil if AllocSite is empty.
+	AllocSiteRe *regexp.Regexp `json:"-"`
+}
+
+// Load reads and validates the description in file against target.
+func Load(file string, target *prog.Target) (*Vuln, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	v, err := Parse(data, target)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", file, err)
+	}
+	return v, nil
+}
+
+// Parse parses and validates the description in data against target.
+// Validation errors start with the name of the offending field.
+func Parse(data []byte, target *prog.Target) (*Vuln, error) {
+	v := new(Vuln)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return nil, err
+	}
+	if v.ID == "" {
+		return nil, fmt.Errorf("id: must not be empty")
+	}
+	if len(v.Syscalls) == 0 {
+		return nil, fmt.Errorf("syscalls: must not be empty")
+	}
+	for i, name := range v.Syscalls {
+		if target.SyscallMap[name] == nil {
+			return nil, fmt.Errorf("syscalls[%v]: unknown syscall %q", i, name)
+		}
+	}
+	for i, call := range v.Prelude {
+		if strings.TrimSpace(call) == "" || strings.Contains(call, "\n") {
+			return nil, fmt.Errorf("prelude[%v]: must be a single call", i)
+		}
+	}
+	if _, err := target.Deserialize([]byte(strings.Join(v.Prelude, "\n")), prog.NonStrict); err != nil {
+		return nil, fmt.Errorf("prelude: %v", err)
+	}
+	if v.AllocSite != "" {
+		var err error
+		if v.AllocSiteRe, err = regexp.Compile(v.AllocSite); err != nil {
+			return nil, fmt.Errorf("alloc_site: %v", err)
+		}
+	}
+	return v, nil
+}
+
+// Template returns a program template (see syz-stress -template) that consists of
+// the prelude, holes calls chosen by the generator, and the vulnerable syscalls.
+func (v *Vuln) Template(holes int) []byte {
+	buf := new(bytes.Buffer)
+	for _, call := range v.Prelude {
+		fmt.Fprintf(buf, "%v\n", call)
+	}
+	if holes > 0 {
+		fmt.Fprintf(buf, "HOLE*%v\n", holes)
+	}
+	for _, name := range v.Syscalls {
+		fmt.Fprintf(buf, "%v()\n", name)
+	}
+	return buf.Bytes()
+}
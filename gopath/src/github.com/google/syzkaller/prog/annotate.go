@@ -0,0 +1,124 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SerializeAnnotated serializes p with a trailing comment after every call that
+// describes the call's flag values (by their symbolic names), the resources it consumes
+// and its buffer sizes. Deserialize ignores trailing comments, so the result is still a valid program.
+func (p *Prog) SerializeAnnotated() []byte {
+	p = p.Clone()
+	names := flagNames(p.Target)
+	producers := make(map[*ResultArg]int)
+	notes := make([][]string, len(p.Calls))
+	for i, c := range p.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			switch a := arg.(type) {
+			case *ConstArg:
+				if typ, ok := a.Type().(*FlagsType); ok {
+					notes[i] = append(notes[i], fmt.Sprintf("%v=%v", typ.Name(), names.format(typ, a.Val)))
+				}
+			case *DataArg:
+				notes[i] = append(notes[i], fmt.Sprintf("%v buffer of %v bytes", a.Type().Name(), a.Size()))
+			case *ResultArg:
+				if idx, ok := producers[a.Res]; ok {
+					notes[i] = append(notes[i], fmt.Sprintf("uses %v from line %v", a.Type().Name(), idx+1))
+				}
+				producers[a] = i
+			}
+		})
+		// Comments of the original program would be emitted as separate lines.
+		c.Comment = ""
+	}
+	buf := new(bytes.Buffer)
+	i := 0
+	for _, line := range strings.Split(strings.TrimSuffix(string(p.Serialize()), "\n"), "\n") {
+		buf.WriteString(line)
+		if line != "" && line[0] != '#' && i < len(notes) {
+			if len(notes[i]) != 0 {
+				fmt.Fprintf(buf, " # %v", strings.Join(notes[i], ", "))
+			}
+			i++
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// DescribeArgs returns a human-readable view of the argument values of every call in p:
+// pointer addresses and pointees, scalar and flag values, buffer contents and
+// the calls that produce the used resources.
+func (p *Prog) DescribeArgs() []byte {
+	buf := new(strings.Builder)
+	producers := make(map[*ResultArg]int)
+	for i, c := range p.Calls {
+		fmt.Fprintf(buf, "call %v: %v\n", i, c.Meta.Name)
+		for _, arg := range c.Args {
+			WalkArg(arg, func(arg Arg, depth int) bool {
+				describeArg(buf, arg, depth+1, i, producers)
+				return true
+			})
+		}
+		if c.Ret != nil {
+			producers[c.Ret] = i
+		}
+	}
+	return []byte(buf.String())
+}
+
+// Number of bytes of buffer contents shown by DescribeArgs.
+const describeDataLen = 32
+
+// describeArg describes arg without the arguments it contains.
+func describeArg(buf *strings.Builder, arg Arg, depth, call int, producers map[*ResultArg]int) {
+	typ := arg.Type()
+	name := typ.FieldName()
+	if name == "" {
+		name = typ.Name()
+	}
+	fmt.Fprintf(buf, "%v%v: ", strings.Repeat("\t", depth), name)
+	switch a := arg.(type) {
+	case *ConstArg:
+		kind := "value"
+		if _, ok := typ.(*FlagsType); ok {
+			kind = "flags"
+		}
+		fmt.Fprintf(buf, "%v 0x%x (%v)\n", kind, a.Val, a.Val)
+	case *PointerArg:
+		if a.Res == nil {
+			fmt.Fprintf(buf, "pointer 0x%x, vma of %v bytes\n", a.Address, a.VmaSize)
+			return
+		}
+		fmt.Fprintf(buf, "pointer 0x%x to\n", a.Address)
+	case *DataArg:
+		if typ.Dir() == DirOut {
+			fmt.Fprintf(buf, "output buffer of %v bytes\n", a.Size())
+			return
+		}
+		data := a.Data()
+		more := ""
+		if len(data) > describeDataLen {
+			data, more = data[:describeDataLen], "..."
+		}
+		fmt.Fprintf(buf, "buffer of %v bytes %q%v\n", a.Size(), data, more)
+	case *GroupArg:
+		fmt.Fprintf(buf, "%v fields\n", len(a.Inner))
+	case *UnionArg:
+		fmt.Fprintf(buf, "union\n")
+	case *ResultArg:
+		if idx, ok := producers[a.Res]; ok && a.Res != nil {
+			fmt.Fprintf(buf, "resource from call %v\n", idx)
+		} else {
+			fmt.Fprintf(buf, "resource value 0x%x\n", a.Val)
+		}
+		producers[a] = call
+	default:
+		fmt.Fprintf(buf, "%T\n", arg)
+	}
+}
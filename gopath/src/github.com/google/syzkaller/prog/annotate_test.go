@@ -0,0 +1,71 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestSerializeAnnotated(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seed := time.Now().UnixNano()
+	t.Logf("seed=%v", seed)
+	rs := rand.NewSource(seed)
+	ct := target.DefaultChoiceTable()
+	iters := 1000
+	if testing.Short() {
+		iters = 100
+	}
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, ct)
+		want := p.Serialize()
+		data := p.SerializeAnnotated()
+		if !bytes.Equal(p.Serialize(), want) {
+			t.Fatalf("SerializeAnnotated changed the program:\n%s\nwant:\n%s", p.Serialize(), want)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != len(p.Calls) {
+			t.Fatalf("got %v lines for %v calls:\n%s", len(lines), len(p.Calls), data)
+		}
+		p1, err := target.Deserialize(data, prog.Strict)
+		if err != nil {
+			t.Fatalf("failed to deserialize annotated program: %v\n%s", err, data)
+		}
+		for _, c := range p1.Calls {
+			c.Comment = ""
+		}
+		if got := p1.Serialize(); !bytes.Equal(got, want) {
+			t.Fatalf("annotated program deserialized into a different program:\n%s\nwant:\n%s", got, want)
+		}
+	}
+}
+
+func TestDescribeArgs(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	ct := target.DefaultChoiceTable()
+	for i := 0; i < 100; i++ {
+		p := target.Generate(rs, 10, ct)
+		data := string(p.DescribeArgs())
+		for j, c := range p.Calls {
+			if line := fmt.Sprintf("call %v: %v\n", j, c.Meta.Name); !strings.Contains(data, line) {
+				t.Fatalf("no %q in the description:\n%s", line, data)
+			}
+		}
+	}
+}
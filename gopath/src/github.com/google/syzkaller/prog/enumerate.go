@@ -0,0 +1,232 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ArgSpec selects a scalar argument of a program and the set of values it takes.
+// Spec syntax is CALL.ARG[.FIELD]...=VALUES where CALL is the call index,
+// ARG is the argument index and FIELDs index into structs and arrays
+// (pointers and unions are followed implicitly). VALUES is a range A..B,
+// a list A,B,C or a set of flags A|B|C that takes all their combinations.
+type ArgSpec struct {
+	Spec string
+	Call int
+	Path []int
+	Vals []uint64
+}
+
+// ParseArgSpecs parses a ';'-separated list of specs, ranges may have at most limit values.
+func ParseArgSpecs(s string, limit int) ([]*ArgSpec, error) {
+	var specs []*ArgSpec
+	for _, str := range strings.Split(s, ";") {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			continue
+		}
+		spec, err := parseArgSpec(str, limit)
+		if err != nil {
+			return nil, fmt.Errorf("bad spec %q: %v", str, err)
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no specs")
+	}
+	return specs, nil
+}
+
+func parseArgSpec(s string, limit int) (*ArgSpec, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq == -1 {
+		return nil, fmt.Errorf("no '='")
+	}
+	spec := &ArgSpec{Spec: s}
+	for i, idx := range strings.Split(s[:eq], ".") {
+		v, err := strconv.Atoi(idx)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("bad index %q", idx)
+		}
+		if i == 0 {
+			spec.Call = v
+		} else {
+			spec.Path = append(spec.Path, v)
+		}
+	}
+	if len(spec.Path) == 0 {
+		return nil, fmt.Errorf("no argument index")
+	}
+	if err := spec.SetValues(s[eq+1:], limit); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// ParseArgPath parses CALL.ARG[.FIELD]... selecting a scalar argument of p,
+// ARG and FIELDs are either indexes or field names. The returned spec has no values.
+func ParseArgPath(p *Prog, s string) (*ArgSpec, error) {
+	elems := strings.Split(s, ".")
+	if len(elems) < 2 {
+		return nil, fmt.Errorf("bad argument path %q: want CALL.ARG[.FIELD]...", s)
+	}
+	call, err := strconv.Atoi(elems[0])
+	if err != nil || call < 0 || call >= len(p.Calls) {
+		return nil, fmt.Errorf("bad call index %q", elems[0])
+	}
+	spec := &ArgSpec{Spec: s, Call: call}
+	args := p.Calls[call].Args
+	for i, elem := range elems[1:] {
+		if i != 0 {
+			group, ok := DerefArg(args[spec.Path[i-1]]).(*GroupArg)
+			if !ok {
+				return nil, fmt.Errorf("%v: %v is not a struct or array", s, strings.Join(elems[:i+1], "."))
+			}
+			args = group.Inner
+		}
+		idx, err := strconv.Atoi(elem)
+		if err != nil {
+			idx = -1
+			for j, arg := range args {
+				if arg.Type().FieldName() == elem {
+					idx = j
+					break
+				}
+			}
+		}
+		if idx < 0 || idx >= len(args) {
+			return nil, fmt.Errorf("%v: no field %q", s, elem)
+		}
+		spec.Path = append(spec.Path, idx)
+	}
+	if _, err := spec.Resolve(p); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// SetValues parses VALUES of the spec syntax into spec.Vals, ranges may have at most limit values.
+func (spec *ArgSpec) SetValues(vals string, limit int) error {
+	spec.Vals = nil
+	switch {
+	case strings.Contains(vals, ".."):
+		parts := strings.SplitN(vals, "..", 2)
+		lo, err := strconv.ParseUint(parts[0], 0, 64)
+		if err != nil {
+			return err
+		}
+		hi, err := strconv.ParseUint(parts[1], 0, 64)
+		if err != nil {
+			return err
+		}
+		if hi < lo || hi-lo >= uint64(limit) {
+			return fmt.Errorf("bad range")
+		}
+		for v := lo; ; v++ {
+			spec.Vals = append(spec.Vals, v)
+			if v == hi {
+				break
+			}
+		}
+	case strings.Contains(vals, "|"):
+		var flags []uint64
+		for _, str := range strings.Split(vals, "|") {
+			v, err := strconv.ParseUint(str, 0, 64)
+			if err != nil {
+				return err
+			}
+			flags = append(flags, v)
+		}
+		if len(flags) > 16 {
+			return fmt.Errorf("too many flags")
+		}
+		for mask := 0; mask < 1<<uint(len(flags)); mask++ {
+			v := uint64(0)
+			for i, f := range flags {
+				if mask&(1<<uint(i)) != 0 {
+					v |= f
+				}
+			}
+			spec.Vals = append(spec.Vals, v)
+		}
+	default:
+		for _, str := range strings.Split(vals, ",") {
+			v, err := strconv.ParseUint(str, 0, 64)
+			if err != nil {
+				return err
+			}
+			spec.Vals = append(spec.Vals, v)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the scalar argument selected by spec in p.
+func (spec *ArgSpec) Resolve(p *Prog) (*ConstArg, error) {
+	if spec.Call >= len(p.Calls) {
+		return nil, fmt.Errorf("%v: program has only %v calls", spec.Spec, len(p.Calls))
+	}
+	args := p.Calls[spec.Call].Args
+	var arg Arg
+	for i, idx := range spec.Path {
+		if i != 0 {
+			group, ok := DerefArg(arg).(*GroupArg)
+			if !ok {
+				return nil, fmt.Errorf("%v: element %v is not a struct or array", spec.Spec, i)
+			}
+			args = group.Inner
+		}
+		if idx >= len(args) {
+			return nil, fmt.Errorf("%v: element %v has only %v fields", spec.Spec, i+1, len(args))
+		}
+		arg = args[idx]
+	}
+	c, ok := DerefArg(arg).(*ConstArg)
+	if !ok {
+		return nil, fmt.Errorf("%v: argument is not a scalar", spec.Spec)
+	}
+	return c, nil
+}
+
+// EnumerateArgs returns an iterator over all variants of p with the arguments selected by specs
+// set to all combinations of their values, along with the values. p is not changed.
+// The iterator returns nil after the last variant. It's an error if there are more than limit variants.
+func EnumerateArgs(p *Prog, specs []*ArgSpec, limit int) (func() (*Prog, []uint64), error) {
+	total := 1
+	for _, spec := range specs {
+		if _, err := spec.Resolve(p); err != nil {
+			return nil, err
+		}
+		total *= len(spec.Vals)
+		if total > limit {
+			return nil, fmt.Errorf("more than %v variants", limit)
+		}
+	}
+	pos := make([]int, len(specs))
+	done := false
+	return func() (*Prog, []uint64) {
+		if done {
+			return nil, nil
+		}
+		variant := p.Clone()
+		vals := make([]uint64, len(specs))
+		for i, spec := range specs {
+			arg, _ := spec.Resolve(variant)
+			vals[i] = spec.Vals[pos[i]]
+			arg.Val = vals[i]
+		}
+		done = true
+		for i := range pos {
+			if pos[i]++; pos[i] < len(specs[i].Vals) {
+				done = false
+				break
+			}
+			pos[i] = 0
+		}
+		return variant, vals
+	}, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseArgSpecs(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		want string
+	}{
+		{"1.2=0..3", "1 [2] [0 1 2 3]"},
+		{" 0.1.0=5,0x10 ; ", "0 [1 0] [5 16]"},
+		{"0.0=0x1|0x4", "0 [0] [0 1 4 5]"},
+		{"2.0.3.1=7", "2 [0 3 1] [7]"},
+		{"", ""},
+		{"1=0", ""},
+		{"1.x=0", ""},
+		{"1.-1=0", ""},
+		{"1.2", ""},
+		{"1.2=3..1", ""},
+		{"1.2=0..100", ""},
+		{"1.2=0x1|y", ""},
+		{"1.2=1,,2", ""},
+	} {
+		specs, err := ParseArgSpecs(test.spec, 100)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: no error", test.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.spec, err)
+			continue
+		}
+		got := fmt.Sprint(specs[0].Call, " ", specs[0].Path, " ", specs[0].Vals)
+		if len(specs) != 1 || got != test.want {
+			t.Errorf("%q: got %v specs, first %q, want %q", test.spec, len(specs), got, test.want)
+		}
+	}
+}
+
+// enumTestProg returns a program with a single call: scalar argument 0 and
+// argument 1 that points to a struct of a scalar and a union with a scalar.
+func enumTestProg() *Prog {
+	return &Prog{Calls: []*Call{{
+		Args: []Arg{
+			MakeConstArg(&IntType{}, 1),
+			MakePointerArg(&PtrType{}, 0, MakeGroupArg(&StructType{}, []Arg{
+				MakeConstArg(&IntType{}, 2),
+				MakeUnionArg(&UnionType{}, MakeConstArg(&IntType{}, 3)),
+			})),
+		},
+	}}}
+}
+
+func TestEnumerateArgs(t *testing.T) {
+	p := enumTestProg()
+	specs, err := ParseArgSpecs("0.1.0=1..3;0.1.1=0x10|0x20", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := EnumerateArgs(p, specs, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for variant, vals := next(); variant != nil; variant, vals = next() {
+		for i, spec := range specs {
+			arg, err := spec.Resolve(variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if arg.Val != vals[i] {
+				t.Errorf("variant %#x: %v is %#x", vals, spec.Spec, arg.Val)
+			}
+		}
+		if seen[fmt.Sprint(vals)] {
+			t.Errorf("variant %#x enumerated twice", vals)
+		}
+		seen[fmt.Sprint(vals)] = true
+	}
+	if len(seen) != 3*4 {
+		t.Errorf("enumerated %v variants, want %v", len(seen), 3*4)
+	}
+	for i, spec := range specs {
+		arg, _ := spec.Resolve(p)
+		if want := []uint64{2, 3}[i]; arg.Val != want {
+			t.Errorf("original program changed: %v is %#x, want %#x", spec.Spec, arg.Val, want)
+		}
+	}
+	if _, err := EnumerateArgs(p, specs, 11); err == nil {
+		t.Errorf("variant limit is not enforced")
+	}
+	for _, bad := range []string{"1.0=0", "0.2=0", "0.0.0=0", "0.1=0", "0.1.2=0"} {
+		specs, err := ParseArgSpecs(bad, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := EnumerateArgs(p, specs, 100); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
+
+func TestParseArgPath(t *testing.T) {
+	p := enumTestProg()
+	for _, path := range []string{"0.0", "0.1.0", "0.1.1"} {
+		spec, err := ParseArgPath(p, path)
+		if err != nil {
+			t.Errorf("%q: %v", path, err)
+			continue
+		}
+		if err := spec.SetValues("4,5", 100); err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(spec.Vals) != "[4 5]" {
+			t.Errorf("%q: got values %v", path, spec.Vals)
+		}
+	}
+	for _, path := range []string{"0", "1.0", "x.0", "0.2", "0.0.0", "0.1", "0.1.x"} {
+		if _, err := ParseArgPath(p, path); err == nil {
+			t.Errorf("%q: no error", path)
+		}
+	}
+}
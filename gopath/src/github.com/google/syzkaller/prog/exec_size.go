@@ -0,0 +1,51 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrProgramTooLarge means that the exec encoding of a program does not fit into
+// the executor input region. Errors returned by SerializeForExecLimit match it with errors.Is.
+var ErrProgramTooLarge = errors.New("program does not fit into the executor input")
+
+// ProgramTooLargeError is returned by SerializeForExecLimit with the required size.
+type ProgramTooLargeError struct {
+	Size  int // size of the exec encoding of the program, -1 if it exceeds maxExecSize
+	Limit int // size of the buffer the program did not fit into
+}
+
+func (err *ProgramTooLargeError) Error() string {
+	return fmt.Sprintf("%v: %v bytes, limit %v", ErrProgramTooLarge, err.Size, err.Limit)
+}
+
+func (err *ProgramTooLargeError) Is(target error) bool {
+	return target == ErrProgramTooLarge
+}
+
+// maxExecSize bounds the buffers ExecSize tries.
+const maxExecSize = 1 << 30
+
+// ExecSize returns the size of the exec encoding of p, that is, the smallest buffer
+// SerializeForExec succeeds with. It returns -1 if the size exceeds 1GB.
+func (p *Prog) ExecSize() int {
+	for size := ExecBufferSize; size <= maxExecSize; size *= 2 {
+		if n, err := p.SerializeForExec(make([]byte, size)); err == nil {
+			return n
+		}
+	}
+	return -1
+}
+
+// SerializeForExecLimit is SerializeForExec that returns *ProgramTooLargeError
+// if p does not fit into buffer.
+func (p *Prog) SerializeForExecLimit(buffer []byte) (int, error) {
+	n, err := p.SerializeForExec(buffer)
+	if err != nil {
+		return 0, &ProgramTooLargeError{Size: p.ExecSize(), Limit: len(buffer)}
+	}
+	return n, nil
+}
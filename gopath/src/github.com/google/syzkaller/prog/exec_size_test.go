@@ -0,0 +1,78 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestSerializeForExecLimit(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	for i := 0; i < 100; i++ {
+		p := target.Generate(rs, 10, target.DefaultChoiceTable())
+		size := p.ExecSize()
+		if size <= 0 {
+			t.Fatalf("bad exec size %v", size)
+		}
+		// Right at the boundary.
+		n, err := p.SerializeForExecLimit(make([]byte, size))
+		if err != nil {
+			t.Fatalf("program does not fit into %v bytes: %v", size, err)
+		}
+		if n != size {
+			t.Fatalf("serialized %v bytes, exec size %v", n, size)
+		}
+		// Just over it.
+		_, err = p.SerializeForExecLimit(make([]byte, size-1))
+		checkTooLarge(t, err, size, size-1)
+	}
+}
+
+func TestSerializeForExecLimitLargeData(t *testing.T) {
+	target, err := prog.GetTarget("linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The data argument alone is larger than the default executor input region.
+	data := make([]byte, prog.ExecBufferSize)
+	text := fmt.Sprintf("write(0xffffffffffffffff, &(0x7f0000000000)=\"%v\", 0x%x)\n",
+		hex.EncodeToString(data), len(data))
+	p, err := target.Deserialize([]byte(text), prog.Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := p.ExecSize()
+	if size <= len(data) {
+		t.Fatalf("exec size %v is smaller than the data argument", size)
+	}
+	_, err = p.SerializeForExecLimit(make([]byte, prog.ExecBufferSize))
+	checkTooLarge(t, err, size, prog.ExecBufferSize)
+	if _, err := p.SerializeForExecLimit(make([]byte, size)); err != nil {
+		t.Fatalf("program does not fit into %v bytes: %v", size, err)
+	}
+}
+
+func checkTooLarge(t *testing.T, err error, size, limit int) {
+	if !errors.Is(err, prog.ErrProgramTooLarge) {
+		t.Fatalf("got error %v, want ErrProgramTooLarge", err)
+	}
+	var tooLarge *prog.ProgramTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("got error %T, want *ProgramTooLargeError", err)
+	}
+	if tooLarge.Size != size || tooLarge.Limit != limit {
+		t.Fatalf("got size %v limit %v, want size %v limit %v", tooLarge.Size, tooLarge.Limit, size, limit)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// flagNameTable maps values of flag sets to the names of the constants they consist of.
+type flagNameTable struct {
+	mu    sync.Mutex
+	byVal map[uint64][]string          // all target constants by value
+	sets  map[string]map[uint64]string // flag set name -> value -> constant name
+}
+
+var (
+	flagNamesMu     sync.Mutex
+	flagNamesTables = make(map[*Target]*flagNameTable)
+)
+
+func flagNames(target *Target) *flagNameTable {
+	flagNamesMu.Lock()
+	defer flagNamesMu.Unlock()
+	t := flagNamesTables[target]
+	if t == nil {
+		t = newFlagNameTable(target.ConstMap)
+		flagNamesTables[target] = t
+	}
+	return t
+}
+
+func newFlagNameTable(consts map[string]uint64) *flagNameTable {
+	t := &flagNameTable{
+		byVal: make(map[uint64][]string),
+		sets:  make(map[string]map[uint64]string),
+	}
+	for name, val := range consts {
+		t.byVal[val] = append(t.byVal[val], name)
+	}
+	for _, names := range t.byVal {
+		sort.Strings(names)
+	}
+	return t
+}
+
+// set returns value names of the flag set typ. Descriptions do not keep names of
+// flag values, so they are recovered from the target constants. Many constants share
+// a value, so for every value the name with the prefix (e.g. O_ in O_RDWR) that is
+// the most common among all values of the set is chosen.
+func (t *flagNameTable) set(typ *FlagsType) map[uint64]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if names, ok := t.sets[typ.Name()]; ok {
+		return names
+	}
+	prefixes := make(map[string]int)
+	for _, val := range typ.Vals {
+		seen := make(map[string]bool)
+		for _, name := range t.byVal[val] {
+			if pfx := constPrefix(name); !seen[pfx] {
+				seen[pfx] = true
+				prefixes[pfx]++
+			}
+		}
+	}
+	names := make(map[uint64]string)
+	for _, val := range typ.Vals {
+		best := ""
+		for _, name := range t.byVal[val] {
+			if best == "" || prefixes[constPrefix(name)] > prefixes[constPrefix(best)] {
+				best = name
+			}
+		}
+		if best != "" {
+			names[val] = best
+		}
+	}
+	t.sets[typ.Name()] = names
+	return names
+}
+
+func constPrefix(name string) string {
+	if i := strings.IndexByte(name, '_'); i != -1 {
+		return name[:i+1]
+	}
+	return name
+}
+
+// format returns val of the flag set typ as constant names, e.g. O_RDWR|O_CLOEXEC.
+// Bits that do not correspond to any named value are printed in hex.
+func (t *flagNameTable) format(typ *FlagsType, val uint64) string {
+	names := t.set(typ)
+	if name, ok := names[val]; ok {
+		return name
+	}
+	if !typ.BitMask || val == 0 {
+		return fmt.Sprintf("0x%x", val)
+	}
+	var parts []string
+	rest := val
+	for _, v := range typ.Vals {
+		if name, ok := names[v]; ok && v != 0 && rest&v == v {
+			parts = append(parts, name)
+			rest &^= v
+		}
+	}
+	if rest != 0 {
+		parts = append(parts, fmt.Sprintf("0x%x", rest))
+	}
+	return strings.Join(parts, "|")
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"testing"
+)
+
+func TestFlagNames(t *testing.T) {
+	names := newFlagNameTable(map[string]uint64{
+		"O_RDONLY":    0,
+		"O_WRONLY":    1,
+		"O_RDWR":      2,
+		"O_CLOEXEC":   0x80000,
+		"O_NONBLOCK":  0x800,
+		"SOCK_STREAM": 1,
+		"AF_UNSPEC":   0,
+		"F_OK":        0,
+		"MODE_X":      0x1000,
+	})
+	flags := func(name string, bitmask bool, vals ...uint64) *FlagsType {
+		return &FlagsType{
+			IntTypeCommon: IntTypeCommon{TypeCommon: TypeCommon{TypeName: name}},
+			Vals:          vals,
+			BitMask:       bitmask,
+		}
+	}
+	open := flags("open_flags", true, 0, 1, 2, 0x80000, 0x800)
+	mode := flags("mode", false, 0, 1, 0x1000)
+	tests := []struct {
+		typ  *FlagsType
+		val  uint64
+		want string
+	}{
+		{open, 0, "O_RDONLY"},
+		{open, 1, "O_WRONLY"},
+		{open, 2 | 0x80000, "O_RDWR|O_CLOEXEC"},
+		{open, 2 | 0x80000 | 0x800, "O_RDWR|O_CLOEXEC|O_NONBLOCK"},
+		{open, 0x800 | 0x4, "O_NONBLOCK|0x4"},
+		{mode, 0x1000, "MODE_X"},
+		{mode, 3, "0x3"},
+	}
+	for _, test := range tests {
+		if got := names.format(test.typ, test.val); got != test.want {
+			t.Errorf("%v value 0x%x: got %q, want %q", test.typ.Name(), test.val, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// GroupAttackComment is the comment line that precedes the first attack call of a serialized group.
+const GroupAttackComment = "group: attack"
+
+// Group is a program group: setup calls followed by attack calls that may use
+// resources created by the setup calls. Both parts are kept in a single program,
+// so references from the attack calls into the setup calls are ordinary resource
+// references, and the group is executed as one program: the attack calls see the
+// process state (e.g. the fd table) created by the setup calls.
+//
+// A group is serialized as a program with a "# group: attack" comment line before
+// the first attack call, so it round-trips through Deserialize and can be stored in a corpus db.
+type Group struct {
+	Prog  *Prog
+	Setup int // number of setup calls
+}
+
+// DeserializeGroup parses a serialized group.
+func (target *Target) DeserializeGroup(data []byte, mode DeserializeMode) (*Group, error) {
+	p, err := target.Deserialize(data, mode)
+	if err != nil {
+		return nil, err
+	}
+	for i, c := range p.Calls {
+		if c.Comment != GroupAttackComment {
+			continue
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("program group has no setup calls")
+		}
+		c.Comment = ""
+		return &Group{Prog: p, Setup: i}, nil
+	}
+	return nil, fmt.Errorf("program group has no %q comment line", "# "+GroupAttackComment)
+}
+
+// Serialize serializes the group.
+func (g *Group) Serialize() []byte {
+	p := g.Prog.Clone()
+	if g.Setup < len(p.Calls) {
+		p.Calls[g.Setup].Comment = GroupAttackComment
+	}
+	return p.Serialize()
+}
+
+func (g *Group) Clone() *Group {
+	return &Group{Prog: g.Prog.Clone(), Setup: g.Setup}
+}
+
+// Mutate mutates the attack calls of the group: it inserts and removes attack calls
+// and mutates their arguments. Setup calls are not changed, the attack calls keep
+// using their resources and newly generated calls can use them too.
+// At least one attack call is kept, ncalls limits the total number of calls.
+func (g *Group) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, corpus []*Prog) {
+	r := newRand(g.Prog.Target, rs)
+	if ncalls <= g.Setup {
+		ncalls = g.Setup + 1
+	}
+	for stop, ok := false, false; !stop; stop = ok && r.oneOf(3) {
+		switch {
+		case r.nOutOf(20, 31):
+			ok = g.insertCall(r, ncalls, ct, corpus)
+		case r.nOutOf(10, 11):
+			ok = g.mutateArg(r, ncalls, ct, corpus)
+		default:
+			ok = g.removeCall(r)
+		}
+	}
+	for _, c := range g.Prog.Calls[g.Setup:] {
+		g.Prog.Target.SanitizeCall(c)
+	}
+}
+
+func (g *Group) insertCall(r *randGen, ncalls int, ct *ChoiceTable, corpus []*Prog) bool {
+	p := g.Prog
+	if len(p.Calls) >= ncalls {
+		return false
+	}
+	idx := g.Setup + r.Intn(len(p.Calls)-g.Setup+1)
+	var c *Call
+	if idx < len(p.Calls) {
+		c = p.Calls[idx]
+	}
+	s := analyze(ct, corpus, p, c)
+	calls := r.generateCall(s, p, idx)
+	p.insertBefore(c, calls)
+	for len(p.Calls) > ncalls {
+		p.removeCall(idx)
+	}
+	return true
+}
+
+func (g *Group) removeCall(r *randGen) bool {
+	p := g.Prog
+	if len(p.Calls)-g.Setup <= 1 {
+		return false
+	}
+	p.removeCall(g.Setup + r.Intn(len(p.Calls)-g.Setup))
+	return true
+}
+
+func (g *Group) mutateArg(r *randGen, ncalls int, ct *ChoiceTable, corpus []*Prog) bool {
+	p := g.Prog
+	if len(p.Calls) == g.Setup {
+		return false
+	}
+	idx := g.Setup + r.Intn(len(p.Calls)-g.Setup)
+	c := p.Calls[idx]
+	updateSizes := true
+	for stop, ok := false, false; !stop; stop = ok && r.oneOf(3) {
+		ok = true
+		ma := &mutationArgs{target: p.Target}
+		ForeachArg(c, ma.collectArg)
+		if len(ma.args) == 0 {
+			return false
+		}
+		s := analyze(ct, corpus, p, c)
+		arg, argCtx := ma.chooseArg(r.Rand)
+		calls, ok1 := p.Target.mutateArg(r, s, arg, argCtx, &updateSizes)
+		if !ok1 {
+			ok = false
+			continue
+		}
+		// New calls that create resources for the argument go right before the call,
+		// they are attack calls as well.
+		p.insertBefore(c, calls)
+		idx += len(calls)
+		for len(p.Calls) > ncalls && idx > g.Setup {
+			idx--
+			p.removeCall(idx)
+		}
+		if updateSizes {
+			p.Target.assignSizesCall(c)
+		}
+	}
+	return true
+}
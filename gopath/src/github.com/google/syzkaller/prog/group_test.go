@@ -0,0 +1,101 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func serializeCalls(p *prog.Prog, calls []*prog.Call) []byte {
+	return (&prog.Prog{Target: p.Target, Calls: calls}).Serialize()
+}
+
+func TestGroupSerialize(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	ct := target.DefaultChoiceTable()
+	for i := 0; i < 100; i++ {
+		p := target.Generate(rs, 6, ct)
+		if len(p.Calls) < 2 {
+			continue
+		}
+		g := &prog.Group{Prog: p, Setup: 1 + i%(len(p.Calls)-1)}
+		data := g.Serialize()
+		g1, err := target.DeserializeGroup(data, prog.Strict)
+		if err != nil {
+			t.Fatalf("failed to deserialize group: %v\n%s", err, data)
+		}
+		if g1.Setup != g.Setup {
+			t.Fatalf("got %v setup calls, want %v\n%s", g1.Setup, g.Setup, data)
+		}
+		if got, want := g1.Prog.Serialize(), p.Serialize(); !bytes.Equal(got, want) {
+			t.Fatalf("group program changed:\n%s\nwant:\n%s", got, want)
+		}
+		if data1 := g1.Serialize(); !bytes.Equal(data1, data) {
+			t.Fatalf("group serialization changed:\n%s\nwant:\n%s", data1, data)
+		}
+	}
+}
+
+func TestGroupDeserializeErrors(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := target.Generate(rand.NewSource(0), 3, target.DefaultChoiceTable())
+	// No marker.
+	if _, err := target.DeserializeGroup(p.Serialize(), prog.NonStrict); err == nil {
+		t.Errorf("group without the attack marker is accepted")
+	}
+	// No setup calls.
+	data := append([]byte("# "+prog.GroupAttackComment+"\n"), p.Serialize()...)
+	if _, err := target.DeserializeGroup(data, prog.NonStrict); err == nil {
+		t.Errorf("group without setup calls is accepted:\n%s", data)
+	}
+}
+
+func TestGroupMutate(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	ct := target.DefaultChoiceTable()
+	changed := 0
+	for i := 0; i < 100; i++ {
+		p := target.Generate(rs, 6, ct)
+		if len(p.Calls) < 2 {
+			continue
+		}
+		g := &prog.Group{Prog: p, Setup: len(p.Calls) / 2}
+		setup := serializeCalls(p, p.Calls[:g.Setup])
+		data := p.Serialize()
+		for j := 0; j < 10; j++ {
+			g.Mutate(rs, 10, ct, nil)
+			if len(p.Calls) <= g.Setup || len(p.Calls) > 10 {
+				t.Fatalf("mutant has %v calls, %v setup calls", len(p.Calls), g.Setup)
+			}
+			if got := serializeCalls(p, p.Calls[:g.Setup]); !bytes.Equal(got, setup) {
+				t.Fatalf("setup calls changed:\n%s\nwant:\n%s", got, setup)
+			}
+			if _, err := target.Deserialize(p.Serialize(), prog.Strict); err != nil {
+				t.Fatalf("mutant is invalid: %v\n%s", err, p.Serialize())
+			}
+		}
+		if !bytes.Equal(p.Serialize(), data) {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Fatalf("mutations never changed the attack calls")
+	}
+}
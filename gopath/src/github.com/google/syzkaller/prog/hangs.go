@@ -0,0 +1,151 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// HangRule describes a call pattern that reliably blocks until the executor timeout
+// (e.g. reads from empty pipes or futex waits without a timeout) and its fix-up.
+// A rule selects calls by name and either sets flags in an argument, bounds
+// a timeout argument or drops the call. Flag values are referenced by const names
+// and resolved with the target, so the same rule works on all architectures of an OS.
+type HangRule struct {
+	Name   string
+	Calls  []string // call names without the $ variant
+	Action HangAction
+	Arg    int
+	Const  string   // HangSetFlags
+	Max    uint64   // HangClamp
+	Mask   uint64   // HangDrop
+	Ops    []string // HangDrop
+	Unless int      // HangDrop
+}
+
+type HangAction int
+
+const (
+	// HangSetFlags ORs the Const flag into argument Arg.
+	HangSetFlags HangAction = iota
+	// HangClamp limits argument Arg to Max, infinite (negative) timeouts included.
+	HangClamp
+	// HangDrop removes the call if argument Arg masked with Mask is one of Ops
+	// and the pointer argument Unless is NULL. Arg -1 drops the call unconditionally,
+	// Unless -1 disables the pointer check.
+	HangDrop
+)
+
+// hangRules are the hang avoidance rules of each OS.
+var hangRules = map[string][]*HangRule{
+	"linux": {
+		{Name: "pipe2 O_NONBLOCK", Calls: []string{"pipe2"}, Action: HangSetFlags, Arg: 1, Const: "O_NONBLOCK"},
+		{Name: "socket SOCK_NONBLOCK", Calls: []string{"socket", "socketpair"}, Action: HangSetFlags, Arg: 1,
+			Const: "SOCK_NONBLOCK"},
+		{Name: "accept4 SOCK_NONBLOCK", Calls: []string{"accept4"}, Action: HangSetFlags, Arg: 3,
+			Const: "SOCK_NONBLOCK"},
+		{Name: "eventfd2 EFD_NONBLOCK", Calls: []string{"eventfd2"}, Action: HangSetFlags, Arg: 1,
+			Const: "EFD_NONBLOCK"},
+		{Name: "wait4 WNOHANG", Calls: []string{"wait4"}, Action: HangSetFlags, Arg: 2, Const: "WNOHANG"},
+		{Name: "waitid WNOHANG", Calls: []string{"waitid"}, Action: HangSetFlags, Arg: 3, Const: "WNOHANG"},
+		{Name: "msgrcv IPC_NOWAIT", Calls: []string{"msgrcv"}, Action: HangSetFlags, Arg: 4, Const: "IPC_NOWAIT"},
+		{Name: "poll timeout", Calls: []string{"poll"}, Action: HangClamp, Arg: 2, Max: 10},
+		{Name: "epoll_wait timeout", Calls: []string{"epoll_wait", "epoll_pwait"}, Action: HangClamp, Arg: 3, Max: 10},
+		{Name: "futex wait without timeout", Calls: []string{"futex"}, Action: HangDrop, Arg: 1, Mask: 0x7f,
+			Ops: []string{"FUTEX_WAIT", "FUTEX_WAIT_BITSET"}, Unless: 3},
+		{Name: "pause", Calls: []string{"pause"}, Action: HangDrop, Arg: -1, Unless: -1},
+	},
+}
+
+// HangRules returns hang avoidance rules for the target OS, nil if there are none.
+func (target *Target) HangRules() []*HangRule {
+	return hangRules[target.OS]
+}
+
+// AvoidHangs applies hang avoidance rules of the target to p and calls fired
+// for every rule that changed it.
+func (p *Prog) AvoidHangs(fired func(rule *HangRule)) {
+	rules := p.Target.HangRules()
+	for i := 0; i < len(p.Calls); i++ {
+		c := p.Calls[i]
+		for _, rule := range rules {
+			if !rule.matches(c) {
+				continue
+			}
+			if rule.Action == HangDrop {
+				if rule.drop(p.Target, c) {
+					p.RemoveCall(i)
+					i--
+					fired(rule)
+					break
+				}
+				continue
+			}
+			if rule.fix(p.Target, c) {
+				fired(rule)
+			}
+		}
+	}
+}
+
+func (rule *HangRule) matches(c *Call) bool {
+	for _, name := range rule.Calls {
+		if c.Meta.CallName == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *HangRule) fix(target *Target, c *Call) bool {
+	arg := hangConstArg(c, rule.Arg)
+	if arg == nil {
+		return false
+	}
+	switch rule.Action {
+	case HangSetFlags:
+		flag, ok := target.ConstMap[rule.Const]
+		if !ok || arg.Val&flag == flag {
+			return false
+		}
+		arg.Val |= flag
+	case HangClamp:
+		if arg.Val <= rule.Max {
+			return false
+		}
+		arg.Val = rule.Max
+	}
+	return true
+}
+
+func (rule *HangRule) drop(target *Target, c *Call) bool {
+	if rule.Arg >= 0 {
+		arg := hangConstArg(c, rule.Arg)
+		if arg == nil {
+			return false
+		}
+		matched := false
+		for _, op := range rule.Ops {
+			if val, ok := target.ConstMap[op]; ok && arg.Val&rule.Mask == val {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if rule.Unless >= 0 {
+		if rule.Unless >= len(c.Args) {
+			return false
+		}
+		if ptr, ok := c.Args[rule.Unless].(*PointerArg); !ok || ptr.Res != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func hangConstArg(c *Call, idx int) *ConstArg {
+	if idx < 0 || idx >= len(c.Args) {
+		return nil
+	}
+	arg, _ := c.Args[idx].(*ConstArg)
+	return arg
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAvoidHangs(t *testing.T) {
+	target := &Target{
+		OS: "linux",
+		ConstMap: map[string]uint64{
+			"O_NONBLOCK": 0x800,
+			"FUTEX_WAIT": 0,
+		},
+	}
+	call := func(name string, args ...Arg) *Call {
+		return &Call{Meta: &Syscall{Name: name, CallName: name}, Args: args}
+	}
+	p := &Prog{Target: target, Calls: []*Call{
+		call("pipe2", MakeConstArg(&IntType{}, 0), MakeConstArg(&IntType{}, 0x1)),
+		call("poll", MakeConstArg(&IntType{}, 0), MakeConstArg(&IntType{}, 1), MakeConstArg(&IntType{}, ^uint64(0))),
+		// A futex wait with a timeout is left alone.
+		call("futex", MakeConstArg(&IntType{}, 0), MakeConstArg(&IntType{}, 0x80), MakeConstArg(&IntType{}, 0),
+			MakePointerArg(&PtrType{}, 0, MakeConstArg(&IntType{}, 0))),
+		call("futex", MakeConstArg(&IntType{}, 0), MakeConstArg(&IntType{}, 0x80), MakeConstArg(&IntType{}, 0),
+			&PointerArg{}),
+		call("pause"),
+		call("getpid"),
+	}}
+	var fired []string
+	p.AvoidHangs(func(rule *HangRule) {
+		fired = append(fired, rule.Name)
+	})
+	want := "[pipe2 O_NONBLOCK poll timeout futex wait without timeout pause]"
+	if fmt.Sprint(fired) != want {
+		t.Fatalf("fired rules %v, want %v", fired, want)
+	}
+	if len(p.Calls) != 4 || p.Calls[3].Meta.Name != "getpid" {
+		t.Fatalf("got %v calls, want pipe2, poll, futex and getpid", len(p.Calls))
+	}
+	if val := p.Calls[0].Args[1].(*ConstArg).Val; val != 0x801 {
+		t.Errorf("pipe2 flags are %#x, want 0x801", val)
+	}
+	if val := p.Calls[1].Args[2].(*ConstArg).Val; val != 10 {
+		t.Errorf("poll timeout is %v, want 10", val)
+	}
+	fired = nil
+	p.AvoidHangs(func(rule *HangRule) {
+		fired = append(fired, rule.Name)
+	})
+	if len(fired) != 0 {
+		t.Errorf("rules fired on a fixed program: %v", fired)
+	}
+	if rules := (&Target{OS: "none"}).HangRules(); rules != nil {
+		t.Errorf("got %v rules for an unknown OS", len(rules))
+	}
+}
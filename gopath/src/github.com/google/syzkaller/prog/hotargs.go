@@ -0,0 +1,82 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// HotArg is a scalar argument whose value the kernel compared with Operands.
+type HotArg struct {
+	Arg *ConstArg
+	// Weight is 1/N if the compared value matches N arguments of the call.
+	Weight   float64
+	Operands []uint64
+}
+
+// HotArgs returns scalar arguments of p whose values match comparison operands
+// in comps, comps[i] are comparisons collected for call i.
+// If the same value appears in several arguments of a call, it's not known
+// which one was compared, so all of them are returned with reduced weight.
+func (p *Prog) HotArgs(comps []CompMap) []HotArg {
+	var hot []HotArg
+	for i, c := range p.Calls {
+		if i >= len(comps) {
+			break
+		}
+		callComps := comps[i]
+		if len(callComps) == 0 {
+			continue
+		}
+		byVal := make(map[uint64][]*ConstArg)
+		var vals []uint64
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			a, ok := arg.(*ConstArg)
+			if !ok || len(callComps[a.Val]) == 0 {
+				return
+			}
+			if byVal[a.Val] == nil {
+				vals = append(vals, a.Val)
+			}
+			byVal[a.Val] = append(byVal[a.Val], a)
+		})
+		for _, val := range vals {
+			var operands []uint64
+			for op := range callComps[val] {
+				operands = append(operands, op)
+			}
+			sort.Slice(operands, func(i, j int) bool { return operands[i] < operands[j] })
+			args := byVal[val]
+			for _, arg := range args {
+				hot = append(hot, HotArg{arg, 1 / float64(len(args)), operands})
+			}
+		}
+	}
+	return hot
+}
+
+// MutateHotArg replaces a hot argument of p (see HotArgs), chosen according to weights,
+// with one of the values the kernel compared it with. It returns false if p has no hot arguments.
+func (p *Prog) MutateHotArg(rs rand.Source, comps []CompMap) bool {
+	hot := p.HotArgs(comps)
+	if len(hot) == 0 {
+		return false
+	}
+	r := rand.New(rs)
+	total := 0.0
+	for _, h := range hot {
+		total += h.Weight
+	}
+	h := hot[len(hot)-1]
+	x := r.Float64() * total
+	for _, h1 := range hot {
+		if x -= h1.Weight; x < 0 {
+			h = h1
+			break
+		}
+	}
+	h.Arg.Val = h.Operands[r.Intn(len(h.Operands))]
+	return true
+}
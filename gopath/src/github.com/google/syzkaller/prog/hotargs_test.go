@@ -0,0 +1,64 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestHotArgs(t *testing.T) {
+	p := enumTestProg()
+	// Argument values are 1, 2 and 3.
+	if hot := p.HotArgs(nil); len(hot) != 0 {
+		t.Fatalf("got %v hot args without comparisons", len(hot))
+	}
+	comps := []CompMap{{
+		2: {9: true, 7: true},
+		5: {1: true},
+	}}
+	hot := p.HotArgs(comps)
+	if len(hot) != 1 || hot[0].Arg.Val != 2 || hot[0].Weight != 1 || fmt.Sprint(hot[0].Operands) != "[7 9]" {
+		t.Fatalf("got hot args %+v, want argument 2 compared with [7 9]", hot)
+	}
+	// Comparisons of a call are not applied to other calls.
+	p.Calls = append(p.Calls, enumTestProg().Calls[0])
+	if hot := p.HotArgs(comps); len(hot) != 1 {
+		t.Fatalf("got %v hot args, comparisons of call 0 are applied to call 1", len(hot))
+	}
+	// The compared value matches two arguments, both are hot with half the weight.
+	p.Calls[0].Args[0].(*ConstArg).Val = 2
+	hot = p.HotArgs(comps)
+	if len(hot) != 2 || hot[0].Weight != 0.5 || hot[1].Weight != 0.5 {
+		t.Fatalf("got hot args %+v, want 2 args with weight 0.5", hot)
+	}
+}
+
+func TestMutateHotArg(t *testing.T) {
+	rs := rand.NewSource(0)
+	comps := []CompMap{{2: {7: true, 9: true}}}
+	seen := make(map[uint64]bool)
+	for i := 0; i < 100; i++ {
+		p := enumTestProg()
+		if !p.MutateHotArg(rs, comps) {
+			t.Fatalf("no hot argument mutated")
+		}
+		spec := &ArgSpec{Spec: "0.1.0", Path: []int{1, 0}}
+		arg, err := spec.Resolve(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if arg.Val != 7 && arg.Val != 9 {
+			t.Fatalf("hot argument is set to %#x, want one of the operands", arg.Val)
+		}
+		seen[arg.Val] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("operands used: %v, want both", seen)
+	}
+	if enumTestProg().MutateHotArg(rs, nil) {
+		t.Errorf("mutated a program without hot arguments")
+	}
+}
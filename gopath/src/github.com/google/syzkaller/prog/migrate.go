@@ -0,0 +1,133 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Migration is a table of syscall renames for programs serialized with older descriptions.
+// The table has one "old new [new...]" line per renamed syscall, lines starting with # are comments.
+// A rename to several syscalls is ambiguous: the first one is used by default,
+// Variants enumerates the others. Renames of syscalls that still exist are ignored.
+type Migration struct {
+	target *Target
+	// aliases maps old syscall names to copies of the new syscalls renamed to the old name.
+	// The parser resolves calls with an old name to an alias, then the call is switched
+	// to the new syscall.
+	aliases map[string][]*Syscall
+}
+
+// migrateMu serializes migrations, they temporarily add old names to Target.SyscallMap.
+var migrateMu sync.Mutex
+
+// ParseMigration parses a rename table.
+func (target *Target) ParseMigration(data []byte) (*Migration, error) {
+	m := &Migration{
+		target:  target,
+		aliases: make(map[string][]*Syscall),
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %v: want 'old new [new...]'", i+1)
+		}
+		for _, name := range fields[1:] {
+			if target.SyscallMap[name] == nil {
+				return nil, fmt.Errorf("line %v: unknown syscall %v", i+1, name)
+			}
+		}
+		if target.SyscallMap[fields[0]] != nil {
+			continue
+		}
+		for _, name := range fields[1:] {
+			alias := *target.SyscallMap[name]
+			alias.Name = fields[0]
+			m.aliases[fields[0]] = append(m.aliases[fields[0]], &alias)
+		}
+	}
+	return m, nil
+}
+
+// Deserialize deserializes data like Target.Deserialize, calls with old names are
+// parsed as calls of the first of their new syscalls. It also returns the number of
+// renamed calls keyed by the old name. The serialized text is never rewritten.
+// Must not be called concurrently with other uses of the target.
+func (m *Migration) Deserialize(data []byte, mode DeserializeMode) (*Prog, map[string]int, error) {
+	return m.deserialize(data, mode, nil)
+}
+
+// Ambiguous returns the sorted old names in renamed that have several new syscalls.
+func (m *Migration) Ambiguous(renamed map[string]int) []string {
+	var ambiguous []string
+	for old := range renamed {
+		if len(m.aliases[old]) > 1 {
+			ambiguous = append(ambiguous, old)
+		}
+	}
+	sort.Strings(ambiguous)
+	return ambiguous
+}
+
+// Variants deserializes data with all combinations of the new syscalls of the ambiguous
+// old names (see Ambiguous), at most max programs. The first program is the one returned
+// by Deserialize. Combinations that fail to deserialize are skipped.
+// Must not be called concurrently with other uses of the target.
+func (m *Migration) Variants(data []byte, mode DeserializeMode, ambiguous []string, max int) []*Prog {
+	var progs []*Prog
+	choice := make(map[string]int)
+	for len(progs) < max {
+		if p, _, err := m.deserialize(data, mode, choice); err == nil {
+			progs = append(progs, p)
+		}
+		// Advance to the next combination, as an odometer over the variants of each old name.
+		i := 0
+		for ; i < len(ambiguous); i++ {
+			old := ambiguous[i]
+			if choice[old]++; choice[old] < len(m.aliases[old]) {
+				break
+			}
+			choice[old] = 0
+		}
+		if i == len(ambiguous) {
+			break
+		}
+	}
+	return progs
+}
+
+// deserialize deserializes data with old syscall names resolved to the aliases selected
+// by choice (the first ones by default), and switches the parsed calls from the aliases
+// to the new syscalls.
+func (m *Migration) deserialize(data []byte, mode DeserializeMode, choice map[string]int) (
+	*Prog, map[string]int, error) {
+	target := m.target
+	migrateMu.Lock()
+	for old, aliases := range m.aliases {
+		target.SyscallMap[old] = aliases[choice[old]]
+	}
+	p, err := target.Deserialize(data, mode)
+	for old := range m.aliases {
+		delete(target.SyscallMap, old)
+	}
+	migrateMu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+	renamed := make(map[string]int)
+	for _, c := range p.Calls {
+		old := c.Meta.Name
+		if aliases := m.aliases[old]; aliases != nil && c.Meta == aliases[choice[old]] {
+			c.Meta = target.Syscalls[c.Meta.ID]
+			renamed[old]++
+		}
+	}
+	return p, renamed, nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestParseMigrationErrors(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := target.Syscalls[0].Name
+	for _, table := range []string{
+		"old",
+		"old no_such_call",
+		fmt.Sprintf("old %v no_such_call", name),
+	} {
+		if _, err := target.ParseMigration([]byte(table)); err == nil {
+			t.Errorf("table %q parsed without errors", table)
+		}
+	}
+}
+
+func TestMigration(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p *prog.Prog
+	for rs := rand.NewSource(0); p == nil || len(p.Calls) < 2; {
+		p = target.Generate(rs, 5, target.DefaultChoiceTable())
+	}
+	want := p.Serialize()
+	meta := p.Calls[0].Meta
+	other := target.Syscalls[(meta.ID+1)%len(target.Syscalls)]
+	// The old name replaces the name of the first call only, the rest of the program must not change.
+	data := bytes.Replace(want, []byte(meta.Name+"("), []byte("migrate$old("), 1)
+	m, err := target.ParseMigration([]byte(fmt.Sprintf("# renames\n\nmigrate$old %v %v\n%v %v\n",
+		meta.Name, other.Name, other.Name, meta.Name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Renames are applied concurrently, migrations must not interfere with each other.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				p1, renamed, err := m.Deserialize(data, prog.NonStrict)
+				if err != nil {
+					t.Errorf("failed to deserialize: %v", err)
+					return
+				}
+				if renamed["migrate$old"] != 1 || len(renamed) != 1 {
+					t.Errorf("renamed %v, want migrate$old: 1", renamed)
+				}
+				if got := p1.Serialize(); !bytes.Equal(got, want) {
+					t.Errorf("migrated program:\n%s\nwant:\n%s", got, want)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if target.SyscallMap["migrate$old"] != nil {
+		t.Fatalf("old syscall name is left in the target")
+	}
+	// Renames of existing syscalls are ignored.
+	p1, renamed, err := m.Deserialize(want, prog.NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renamed) != 0 || !bytes.Equal(p1.Serialize(), want) {
+		t.Errorf("program without old names is changed, renamed %v:\n%s", renamed, p1.Serialize())
+	}
+	ambiguous := m.Ambiguous(map[string]int{"migrate$old": 1, other.Name: 1})
+	if fmt.Sprint(ambiguous) != "[migrate$old]" {
+		t.Fatalf("ambiguous renames %v, want [migrate$old]", ambiguous)
+	}
+	variants := m.Variants(data, prog.NonStrict, ambiguous, 10)
+	if len(variants) != 2 || variants[0].Calls[0].Meta != meta || variants[1].Calls[0].Meta != other {
+		t.Fatalf("got %v variants, want variants with %v and %v", len(variants), meta.Name, other.Name)
+	}
+	if variants := m.Variants(data, prog.NonStrict, ambiguous, 1); len(variants) != 1 {
+		t.Fatalf("got %v variants with limit 1", len(variants))
+	}
+}
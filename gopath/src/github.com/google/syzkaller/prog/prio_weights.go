@@ -0,0 +1,24 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// Weights returns the weights the table uses to choose the next call after the call
+// with ID from: Weights(from)[to] is the weight of the call with ID to, the probability
+// of choosing it is the weight divided by the sum of all weights of the row.
+// It returns nil if from is not enabled. The result is a copy and can be modified.
+// The element type of the cumulative rows changed between versions of the table,
+// so values are converted explicitly.
+func (ct *ChoiceTable) Weights(from int) []int {
+	if from < 0 || from >= len(ct.runs) || ct.runs[from] == nil {
+		return nil
+	}
+	run := ct.runs[from]
+	weights := make([]int, len(run))
+	prev := 0
+	for i, sum := range run {
+		weights[i] = int(sum) - prev
+		prev = int(sum)
+	}
+	return weights
+}
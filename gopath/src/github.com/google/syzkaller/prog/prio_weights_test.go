@@ -0,0 +1,58 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog_test
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestChoiceTableWeights(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := make(map[*prog.Syscall]bool)
+	for i, c := range target.Syscalls {
+		if i%2 == 0 {
+			enabled[c] = true
+		}
+	}
+	ct := target.BuildChoiceTable(target.CalculatePriorities(nil), enabled)
+	for _, from := range target.Syscalls {
+		weights := ct.Weights(from.ID)
+		if !enabled[from] {
+			if weights != nil {
+				t.Fatalf("got weights for disabled call %v", from.Name)
+			}
+			continue
+		}
+		if len(weights) != len(target.Syscalls) {
+			t.Fatalf("%v: got %v weights for %v calls", from.Name, len(weights), len(target.Syscalls))
+		}
+		total := 0
+		for _, to := range target.Syscalls {
+			w := weights[to.ID]
+			if w < 0 || !enabled[to] && w != 0 {
+				t.Fatalf("%v -> %v (enabled %v): weight %v", from.Name, to.Name, enabled[to], w)
+			}
+			total += w
+		}
+		if total == 0 {
+			t.Fatalf("%v: all weights are 0", from.Name)
+		}
+		// The result is a copy.
+		weights[from.ID] = -1
+		if ct.Weights(from.ID)[from.ID] == -1 {
+			t.Fatalf("%v: weights share memory with the table", from.Name)
+		}
+	}
+	for _, from := range []int{-1, len(target.Syscalls)} {
+		if weights := ct.Weights(from); weights != nil {
+			t.Fatalf("got weights for call %v: %v", from, weights)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// Stats are basic metrics of a program.
+type Stats struct {
+	Calls     int
+	Size      int // serialized size in bytes
+	Resources int // resource arguments, including call results
+	BlobBytes int // bytes of input buffers
+	Depth     int // max nesting of pointers, structs, arrays and unions
+}
+
+// Stats returns metrics of p computed in a single walk over the program.
+// Stats are not cached: a cache would have to live in Prog and be cleared
+// by everything that changes programs in place.
+func (p *Prog) Stats() Stats {
+	st := Stats{Calls: len(p.Calls), Size: len(p.Serialize())}
+	for _, c := range p.Calls {
+		for _, arg := range c.Args {
+			st.walk(arg)
+		}
+		if c.Ret != nil {
+			st.Resources++
+		}
+	}
+	return st
+}
+
+func (st *Stats) walk(arg Arg) {
+	WalkArg(arg, func(arg Arg, depth int) bool {
+		if depth+1 > st.Depth {
+			st.Depth = depth + 1
+		}
+		switch a := arg.(type) {
+		case *ResultArg:
+			st.Resources++
+		case *DataArg:
+			if a.Type().Dir() != DirOut {
+				st.BlobBytes += len(a.Data())
+			}
+		}
+		return true
+	})
+}
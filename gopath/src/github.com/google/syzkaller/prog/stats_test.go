@@ -0,0 +1,69 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog_test
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestStats(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	for i := 0; i < 100; i++ {
+		p := target.Generate(rs, 10, target.DefaultChoiceTable())
+		st := p.Stats()
+		if st.Calls != len(p.Calls) || st.Size != len(p.Serialize()) {
+			t.Fatalf("got %+v for %v calls, %v bytes", st, len(p.Calls), len(p.Serialize()))
+		}
+		if st.Resources < 0 || st.BlobBytes < 0 || st.Depth < 0 {
+			t.Fatalf("bad stats %+v", st)
+		}
+		if st1 := p.Stats(); st1 != st {
+			t.Fatalf("stats changed without changes to the program: %+v -> %+v", st, st1)
+		}
+	}
+}
+
+// mutate mutates p until its serialization changes.
+func mutate(t *testing.T, p *prog.Prog, rs rand.Source, ct *prog.ChoiceTable) {
+	data := p.Serialize()
+	for i := 0; i < 100; i++ {
+		p.Mutate(rs, 30, ct, nil)
+		if !bytes.Equal(p.Serialize(), data) {
+			return
+		}
+	}
+	t.Fatalf("mutations did not change the program")
+}
+
+func TestStatsMutate(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	ct := target.DefaultChoiceTable()
+	for i := 0; i < 100; i++ {
+		p := target.Generate(rs, 5, ct)
+		st := p.Stats()
+		// Stats follow changes made to the program in place.
+		p1 := p.Clone()
+		mutate(t, p1, rs, ct)
+		st1 := p1.Stats()
+		if st1.Calls != len(p1.Calls) || st1.Size != len(p1.Serialize()) {
+			t.Fatalf("stale stats %+v after mutation: %v calls, %v bytes", st1, len(p1.Calls), len(p1.Serialize()))
+		}
+		if p.Stats() != st {
+			t.Fatalf("mutation of a clone changed stats of the original")
+		}
+	}
+}
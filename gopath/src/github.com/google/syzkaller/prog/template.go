@@ -0,0 +1,128 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Template is a partially specified program. Fixed calls are written in the usual
+// program syntax (arguments may be omitted), a line with HOLE or HOLE*N stands for
+// 1 or N calls chosen by the generator, e.g.:
+//
+//	r0 = openat$kvm(0xffffffffffffff9c, &(0x7f0000000000)='/dev/kvm\x00', 0x0, 0x0)
+//	ioctl$KVM_CREATE_VM(r0, 0xae01, 0x0)
+//	HOLE*5
+//	close()
+type Template struct {
+	fixed *Prog
+	// holes[i] is the number of generated calls inserted before fixed call i,
+	// the last element is the number of calls appended after all fixed calls.
+	holes []int
+}
+
+// ParseTemplate parses a template. Fixed calls are parsed with Deserialize in NonStrict mode,
+// so resources are passed between them as in a normal program.
+func (target *Target) ParseTemplate(data []byte) (*Template, error) {
+	tmpl := &Template{holes: []int{0}}
+	fixed := new(bytes.Buffer)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if !strings.HasPrefix(line, "HOLE") {
+			fixed.WriteString(line + "\n")
+			tmpl.holes = append(tmpl.holes, 0)
+			continue
+		}
+		n := 1
+		if rest := line[len("HOLE"):]; rest != "" {
+			var err error
+			if !strings.HasPrefix(rest, "*") {
+				return nil, fmt.Errorf("line %v: bad hole %q", i+1, line)
+			}
+			if n, err = strconv.Atoi(rest[1:]); err != nil || n <= 0 {
+				return nil, fmt.Errorf("line %v: bad hole count %q", i+1, line)
+			}
+		}
+		tmpl.holes[len(tmpl.holes)-1] += n
+	}
+	var err error
+	if tmpl.fixed, err = target.Deserialize(fixed.Bytes(), NonStrict); err != nil {
+		return nil, err
+	}
+	if len(tmpl.fixed.Calls) != len(tmpl.holes)-1 {
+		return nil, fmt.Errorf("template calls must be on separate lines")
+	}
+	return tmpl, nil
+}
+
+// FillTemplate creates a new instance of tmpl. Calls are added in the template order
+// and every hole call is generated with the choice table biased by the preceding calls,
+// with resources of all preceding calls (fixed or generated) in scope. Resource arguments
+// of fixed calls that are not bound to a resource in the template (e.g. omitted ones)
+// are bound to a compatible resource created by a preceding call, if any.
+// A hole call can bring the calls that create its resources along, all of them are kept.
+func FillTemplate(target *Target, tmpl *Template, rs rand.Source, ct *ChoiceTable) *Prog {
+	r := newRand(target, rs)
+	s := newState(target, ct, nil)
+	fixed := tmpl.fixed.Clone()
+	p := &Prog{Target: target}
+	for i, n := range tmpl.holes {
+		for ; n > 0; n-- {
+			for _, c := range r.generateCall(s, p, len(p.Calls)) {
+				s.analyze(c)
+				p.Calls = append(p.Calls, c)
+			}
+		}
+		if i < len(fixed.Calls) {
+			c := fixed.Calls[i]
+			bindTemplateResources(r, s, c)
+			s.analyze(c)
+			p.Calls = append(p.Calls, c)
+		}
+	}
+	return p
+}
+
+// bindTemplateResources binds unbound input resource arguments of c that have
+// the default value to random compatible resources in s.
+func bindTemplateResources(r *randGen, s *state, c *Call) {
+	ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+		a, ok := arg.(*ResultArg)
+		if !ok || a.Res != nil || a.Type().Dir() == DirOut {
+			return
+		}
+		typ, ok := a.Type().(*ResourceType)
+		if !ok || len(typ.Desc.Values) == 0 || a.Val != typ.Desc.Values[0] {
+			return
+		}
+		var names []string
+		for name := range s.resources {
+			if r.target.isCompatibleResource(typ.Desc.Name, name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		var candidates []*ResultArg
+		for _, name := range names {
+			candidates = append(candidates, s.resources[name]...)
+		}
+		if len(candidates) == 0 {
+			return
+		}
+		res := candidates[r.Intn(len(candidates))]
+		a.Res = res
+		if res.uses == nil {
+			res.uses = make(map[*ResultArg]bool)
+		}
+		res.uses[a] = true
+	})
+}
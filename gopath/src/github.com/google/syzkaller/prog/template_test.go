@@ -0,0 +1,117 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+func TestParseTemplateErrors(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tmpl := range []string{
+		"HOLE5",
+		"HOLE*0",
+		"HOLE*-1",
+		"HOLE*x",
+		"no_such_call()",
+	} {
+		if _, err := target.ParseTemplate([]byte(tmpl)); err == nil {
+			t.Errorf("template %q parsed without errors", tmpl)
+		}
+	}
+}
+
+func TestFillTemplate(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	ct := target.DefaultChoiceTable()
+	for i := 0; i < 100; i++ {
+		// Fixed calls are taken from a generated program, so they are valid and pass resources.
+		fixed := target.Generate(rs, 3, ct)
+		holes := []int{i % 3, 2, 0, 1}
+		tmpl := new(strings.Builder)
+		lines := strings.Split(strings.TrimSpace(string(fixed.Serialize())), "\n")
+		for j, line := range lines {
+			if holes[j] != 0 {
+				fmt.Fprintf(tmpl, "HOLE*%v\n", holes[j])
+			}
+			fmt.Fprintf(tmpl, "%v\n", line)
+		}
+		fmt.Fprintf(tmpl, "HOLE\n")
+		holes = append(holes[:len(lines)], 1)
+		tp, err := target.ParseTemplate([]byte(tmpl.String()))
+		if err != nil {
+			t.Fatalf("failed to parse template: %v\n%v", err, tmpl)
+		}
+		p := prog.FillTemplate(target, tp, rs, ct)
+		// Fixed calls go in order, with at least the requested number of calls before each.
+		pos := 0
+		for j, c := range fixed.Calls {
+			pos += holes[j]
+			for pos < len(p.Calls) && p.Calls[pos].Meta != c.Meta {
+				pos++
+			}
+			if pos == len(p.Calls) {
+				t.Fatalf("fixed call %v is missing:\n%s\ntemplate:\n%v", c.Meta.Name, p.Serialize(), tmpl)
+			}
+			pos++
+		}
+		if pos+holes[len(holes)-1] > len(p.Calls) {
+			t.Fatalf("trailing hole is not filled:\n%s\ntemplate:\n%v", p.Serialize(), tmpl)
+		}
+		if _, err := target.Deserialize(p.Serialize(), prog.Strict); err != nil {
+			t.Fatalf("filled template is invalid: %v\n%s", err, p.Serialize())
+		}
+	}
+}
+
+// Resource arguments omitted in fixed calls are bound to resources created by preceding calls.
+func TestFillTemplateResources(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var producer, consumer *prog.Syscall
+	for _, c := range target.Syscalls {
+		res, ok := c.Ret.(*prog.ResourceType)
+		if !ok {
+			continue
+		}
+		for _, c1 := range target.Syscalls {
+			if len(c1.Args) != 0 {
+				if res1, ok := c1.Args[0].(*prog.ResourceType); ok && res1.Desc == res.Desc {
+					producer, consumer = c, c1
+				}
+			}
+		}
+	}
+	if producer == nil {
+		t.Skip("no pair of calls that pass a resource directly")
+	}
+	tmpl, err := target.ParseTemplate([]byte(fmt.Sprintf("%v()\nHOLE*3\n%v()\n", producer.Name, consumer.Name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	for i := 0; i < 10; i++ {
+		p := prog.FillTemplate(target, tmpl, rs, target.DefaultChoiceTable())
+		last := p.Calls[len(p.Calls)-1]
+		arg, ok := last.Args[0].(*prog.ResultArg)
+		if !ok || arg.Res == nil {
+			t.Fatalf("resource of %v is not bound:\n%s", consumer.Name, p.Serialize())
+		}
+	}
+}
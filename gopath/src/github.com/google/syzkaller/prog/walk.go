@@ -0,0 +1,43 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// WalkArg calls fn for arg and, depth-first, for the arguments it contains:
+// pointees, union options and fields and elements of structs and arrays.
+// depth is 0 for arg and grows by one with every level of nesting.
+// If fn returns false, the arguments contained in the visited one are skipped.
+func WalkArg(arg Arg, fn func(arg Arg, depth int) bool) {
+	walkArg(arg, 0, fn)
+}
+
+func walkArg(arg Arg, depth int, fn func(arg Arg, depth int) bool) {
+	if arg == nil || !fn(arg, depth) {
+		return
+	}
+	switch a := arg.(type) {
+	case *PointerArg:
+		walkArg(a.Res, depth+1, fn)
+	case *UnionArg:
+		walkArg(a.Option, depth+1, fn)
+	case *GroupArg:
+		for _, inner := range a.Inner {
+			walkArg(inner, depth+1, fn)
+		}
+	}
+}
+
+// DerefArg follows pointers and unions from arg and returns the first argument
+// that is neither, or the last pointer if it points to nothing.
+func DerefArg(arg Arg) Arg {
+	res := arg
+	WalkArg(arg, func(a Arg, _ int) bool {
+		res = a
+		switch a.(type) {
+		case *PointerArg, *UnionArg:
+			return true
+		}
+		return false
+	})
+	return res
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestWalkArg(t *testing.T) {
+	p := enumTestProg()
+	var visited []string
+	for _, arg := range p.Calls[0].Args {
+		WalkArg(arg, func(arg Arg, depth int) bool {
+			visited = append(visited, fmt.Sprintf("%T:%v", arg, depth))
+			return true
+		})
+	}
+	want := "[*prog.ConstArg:0 *prog.PointerArg:0 *prog.GroupArg:1 *prog.ConstArg:2 *prog.UnionArg:2 *prog.ConstArg:3]"
+	if fmt.Sprint(visited) != want {
+		t.Fatalf("visited %v, want %v", visited, want)
+	}
+	visited = nil
+	WalkArg(p.Calls[0].Args[1], func(arg Arg, depth int) bool {
+		visited = append(visited, fmt.Sprintf("%T", arg))
+		_, isGroup := arg.(*GroupArg)
+		return !isGroup
+	})
+	if fmt.Sprint(visited) != "[*prog.PointerArg *prog.GroupArg]" {
+		t.Fatalf("visited %v, fields of the struct are not skipped", visited)
+	}
+}
+
+func TestDerefArg(t *testing.T) {
+	p := enumTestProg()
+	if _, ok := DerefArg(p.Calls[0].Args[1]).(*GroupArg); !ok {
+		t.Errorf("pointer is not followed")
+	}
+	union := p.Calls[0].Args[1].(*PointerArg).Res.(*GroupArg).Inner[1]
+	if arg, ok := DerefArg(union).(*ConstArg); !ok || arg.Val != 3 {
+		t.Errorf("union is not followed")
+	}
+	ptr := &PointerArg{}
+	if DerefArg(ptr) != ptr {
+		t.Errorf("pointer to nothing is not returned")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagAdaptiveLen = flag.String("adaptive-len", "", "min:max: adjust length of generated programs within the bounds based on feedback")
+
+	// curProgLen is the current length of generated programs, it's accessed atomically.
+	curProgLen int64 = programLength
+	adaptive   *lenController
+)
+
+const (
+	// A crash is worth this much new signal.
+	adaptiveCrashValue = 100
+	// Weight of a new sample in the running averages.
+	adaptiveAlpha = 0.001
+	// Length is adjusted if value per call of longer programs differs from that of
+	// shorter programs by more than this factor.
+	adaptiveThreshold = 1.2
+	adaptivePeriod    = 10 * time.Second
+)
+
+// lenController adjusts the length of generated programs. It maintains running
+// averages of value (new signal and crashes) per call for programs longer than the
+// current length and for the rest, and moves the length towards the more productive side.
+type lenController struct {
+	min, max int
+	mu       sync.Mutex
+	long     float64
+	short    float64
+	nlong    int
+	nshort   int
+	history  []lenChange
+}
+
+type lenChange struct {
+	time time.Time
+	len  int
+}
+
+func initAdaptiveLen(spec string) error {
+	var min, max int
+	if _, err := fmt.Sscanf(spec, "%d:%d", &min, &max); err != nil {
+		return fmt.Errorf("bad -adaptive-len %q, want min:max: %v", spec, err)
+	}
+	if min <= 0 || max < min {
+		return fmt.Errorf("bad -adaptive-len %q, want 0 < min <= max", spec)
+	}
+	start := programLength
+	if start < min {
+		start = min
+	}
+	if start > max {
+		start = max
+	}
+	atomic.StoreInt64(&curProgLen, int64(start))
+	adaptive = &lenController{
+		min:     min,
+		max:     max,
+		history: []lenChange{{time.Now(), start}},
+	}
+	go func() {
+		for range time.NewTicker(adaptivePeriod).C {
+			adaptive.adjust()
+		}
+	}()
+	return nil
+}
+
+// progLen returns the current length of generated programs.
+func progLen() int {
+	return int(atomic.LoadInt64(&curProgLen))
+}
+
+// add accounts the result of execution of a program with ncalls calls.
+func (lc *lenController) add(ncalls, newSignal int, crashed bool) {
+	if ncalls == 0 {
+		return
+	}
+	value := float64(newSignal)
+	if crashed {
+		value += adaptiveCrashValue
+	}
+	value /= float64(ncalls)
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if ncalls > progLen() {
+		lc.long += (value - lc.long) * adaptiveAlpha
+		lc.nlong++
+	} else {
+		lc.short += (value - lc.short) * adaptiveAlpha
+		lc.nshort++
+	}
+}
+
+func (lc *lenController) adjust() {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	// Don't trust the averages until there are enough samples on both sides.
+	if lc.nlong < 100 || lc.nshort < 100 {
+		return
+	}
+	cur := progLen()
+	step := cur / 10
+	if step == 0 {
+		step = 1
+	}
+	next := cur
+	switch {
+	case lc.long > lc.short*adaptiveThreshold:
+		next = cur + step
+	case lc.long*adaptiveThreshold < lc.short:
+		next = cur - step
+	}
+	if next < lc.min {
+		next = lc.min
+	}
+	if next > lc.max {
+		next = lc.max
+	}
+	if next == cur {
+		return
+	}
+	log.Logf(0, "adjusting program length %v -> %v (value per call: longer %.4f, shorter %.4f)",
+		cur, next, lc.long, lc.short)
+	atomic.StoreInt64(&curProgLen, int64(next))
+	lc.history = append(lc.history, lenChange{time.Now(), next})
+	lc.nlong, lc.nshort = 0, 0
+}
+
+// trajectory returns program length changes over time.
+func (lc *lenController) trajectory() string {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	buf := new(strings.Builder)
+	start := lc.history[0].time
+	for _, c := range lc.history {
+		fmt.Fprintf(buf, "%10v %v\n", c.time.Sub(start).Round(time.Second), c.len)
+	}
+	return buf.String()
+}
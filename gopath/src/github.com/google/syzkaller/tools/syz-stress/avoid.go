@@ -0,0 +1,33 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagAvoidHangs = flag.Bool("avoid-hangs", false,
+		"fix up calls that reliably hang (blocking pipe reads, futex waits without timeout, etc) before execution")
+
+	hangRules []*prog.HangRule
+	hangFixes = newTitleStats()
+)
+
+func initAvoidHangs(target *prog.Target) {
+	hangRules = target.HangRules()
+	if hangRules == nil {
+		log.Logf(0, "-avoid-hangs: no rules for %v", target.OS)
+	}
+}
+
+// avoidHangs applies hang avoidance rules to p and accounts fired rules.
+func avoidHangs(p *prog.Prog) {
+	p.AvoidHangs(func(rule *prog.HangRule) {
+		hangFixes.add(rule.Name)
+	})
+}
@@ -0,0 +1,214 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagBalloon = flag.String("balloon", "", "memory to hold next to every executor to create memory pressure (e.g. 512M), "+
+		"the memory is charged to the cgroups of the executor")
+	flagBalloonCycle   = flag.Duration("balloon-cycle", 0, "period to alternately deflate and inflate the balloons")
+	flagBalloonMinFree = flag.String("balloon-min-free", "256M", "deflate the balloons when available memory drops below this")
+)
+
+// balloonEnv is set in the environment of balloon processes, which run the syz-stress binary.
+// The value is the number of bytes the process holds.
+const balloonEnv = "SYZ_STRESS_BALLOON"
+
+// balloon is a process that holds memory on behalf of the executor of a proc.
+// The process is moved into the cgroups of the executor before it touches the memory,
+// so the memory is charged to the executor's memory cgroup. It holds the memory until
+// its stdin is closed, which also happens if syz-stress dies.
+type balloon struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// cgroups is /proc/PID/cgroup of the executor the balloon was placed next to.
+	cgroups string
+	done    chan struct{}
+}
+
+type balloonController struct {
+	mu       sync.Mutex
+	balloons map[*proc]*balloon
+	size     uint64
+	minFree  uint64
+	cycle    time.Duration
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+var balloons *balloonController
+
+func startBalloons() error {
+	if err := checkBalloon(); err != nil {
+		return err
+	}
+	size, err := parseSize(*flagBalloon)
+	if err != nil {
+		return fmt.Errorf("bad -balloon: %v", err)
+	}
+	minFree, err := parseSize(*flagBalloonMinFree)
+	if err != nil {
+		return fmt.Errorf("bad -balloon-min-free: %v", err)
+	}
+	balloons = &balloonController{
+		balloons: make(map[*proc]*balloon),
+		size:     size,
+		minFree:  minFree,
+		cycle:    *flagBalloonCycle,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go balloons.loop()
+	return nil
+}
+
+// finishBalloons deflates all balloons.
+func finishBalloons() {
+	if balloons == nil {
+		return
+	}
+	close(balloons.stop)
+	<-balloons.stopped
+}
+
+func (bc *balloonController) loop() {
+	defer close(bc.stopped)
+	defer bc.deflate()
+	inflated := true
+	lastToggle := time.Now()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-bc.stop:
+			return
+		case <-ticker.C:
+		}
+		if bc.cycle != 0 && time.Since(lastToggle) >= bc.cycle {
+			inflated = !inflated
+			lastToggle = time.Now()
+		}
+		avail, err := memAvailable()
+		if err != nil {
+			log.Logf(0, "balloon: %v", err)
+			return
+		}
+		if avail < bc.minFree {
+			if bc.deflate() != 0 {
+				log.Logf(0, "balloon: available memory %vMB is below the limit, deflating", avail>>20)
+			}
+			continue
+		}
+		if !inflated {
+			bc.deflate()
+			continue
+		}
+		bc.inflate(avail)
+	}
+}
+
+// inflate places a balloon next to the executor of every proc that does not have one
+// while available memory allows it. Balloons whose executor moved to other cgroups
+// (e.g. it was restarted) are replaced.
+func (bc *balloonController) inflate(avail uint64) {
+	workersMu.Lock()
+	procs := append([]*proc{}, workers...)
+	workersMu.Unlock()
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	for _, proc := range procs {
+		eps := proc.executorProcs()
+		if len(eps) == 0 {
+			continue
+		}
+		cgroups := executorCgroups(eps[0].pid)
+		if b := bc.balloons[proc]; b != nil {
+			select {
+			case <-b.done:
+			default:
+				if b.cgroups == cgroups {
+					continue
+				}
+			}
+			b.deflate()
+			delete(bc.balloons, proc)
+		}
+		if avail < bc.minFree+bc.size {
+			return
+		}
+		b, err := startBalloon(bc.size, eps[0].pid, cgroups)
+		if err != nil {
+			log.Logf(0, "balloon: proc %v: %v", proc.pid, err)
+			continue
+		}
+		bc.balloons[proc] = b
+		avail -= bc.size
+	}
+}
+
+// deflate stops all balloons and returns the number of stopped balloons.
+func (bc *balloonController) deflate() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	n := 0
+	for proc, b := range bc.balloons {
+		b.deflate()
+		delete(bc.balloons, proc)
+		n++
+	}
+	return n
+}
+
+// startBalloon starts a balloon process of size bytes in the cgroups of process executor.
+func startBalloon(size uint64, executor int, cgroups string) (*balloon, error) {
+	bin, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(bin)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%v=%v", balloonEnv, size))
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	b := &balloon{cmd: cmd, stdin: stdin, cgroups: cgroups, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(b.done)
+	}()
+	if err := joinCgroups(cmd.Process.Pid, executor); err != nil {
+		b.deflate()
+		return nil, err
+	}
+	// The balloon waits for this byte to touch the memory.
+	if _, err := stdin.Write([]byte{1}); err != nil {
+		b.deflate()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *balloon) deflate() {
+	b.stdin.Close()
+	select {
+	case <-b.done:
+	case <-time.After(time.Second):
+		b.cmd.Process.Kill()
+		<-b.done
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+func checkBalloon() error {
+	if os.Getuid() != 0 {
+		return fmt.Errorf("-balloon requires root to move balloons into the executor cgroups")
+	}
+	return nil
+}
+
+// runBalloon is the main function of a balloon process that holds size bytes.
+func runBalloon(size string) int {
+	n, err := strconv.ParseUint(size, 10, 64)
+	if err != nil {
+		log.Logf(0, "balloon: bad size %q", size)
+		return 1
+	}
+	// The OOM killer should take the balloon before anything else.
+	ioutil.WriteFile("/proc/self/oom_score_adj", []byte("1000"), 0)
+	// Memory is charged to the cgroup of the process that touches it first,
+	// so wait until the parent moved us into the executor cgroups.
+	var buf [1]byte
+	if _, err := os.Stdin.Read(buf[:]); err != nil {
+		return 0
+	}
+	mem, err := syscall.Mmap(-1, 0, int(n), syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		log.Logf(0, "balloon: failed to mmap: %v", err)
+		return 1
+	}
+	pageSize := os.Getpagesize()
+	for off := 0; off < len(mem); off += pageSize {
+		mem[off] = 1
+	}
+	io.Copy(ioutil.Discard, os.Stdin)
+	return 0
+}
+
+// executorCgroups returns /proc/PID/cgroup of process pid.
+func executorCgroups(pid int) string {
+	data, _ := ioutil.ReadFile(fmt.Sprintf("/proc/%v/cgroup", pid))
+	return string(data)
+}
+
+// joinCgroups moves process pid into the cgroups of process target in every hierarchy
+// mounted in our mount namespace. Failure to join the hierarchy with the memory controller
+// is an error, the balloon would be charged to the wrong cgroup otherwise.
+func joinCgroups(pid, target int) error {
+	mounts, err := cgroupMounts()
+	if err != nil {
+		return err
+	}
+	joinedMemory := false
+	for _, line := range strings.Split(strings.TrimSpace(executorCgroups(target)), "\n") {
+		// Lines are hierarchy-ID:controllers:path, controllers are empty for cgroup2.
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		dir, memory, ok := findCgroupMount(mounts, parts[1], parts[2])
+		if !ok {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0); err != nil {
+			if memory {
+				return fmt.Errorf("failed to join %v: %v", dir, err)
+			}
+			log.Logf(1, "balloon: failed to join %v: %v", dir, err)
+			continue
+		}
+		joinedMemory = joinedMemory || memory
+	}
+	if !joinedMemory {
+		return fmt.Errorf("memory cgroup of executor %v is not mounted", target)
+	}
+	return nil
+}
+
+type cgroupMount struct {
+	dir  string // mount point
+	root string // root of the mount inside of the hierarchy
+	// options are the super options of a cgroup v1 mount, they include the controllers.
+	options map[string]bool
+	v2      bool
+	memory  bool // the hierarchy has the memory controller
+}
+
+// cgroupMounts returns the mounted cgroup hierarchies.
+func cgroupMounts() ([]cgroupMount, error) {
+	data, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	var mounts []cgroupMount
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		// Optional fields are terminated with -, followed by fstype, source and super options.
+		line := strings.SplitN(s.Text(), " - ", 2)
+		if len(line) != 2 {
+			continue
+		}
+		fields, fs := strings.Fields(line[0]), strings.Fields(line[1])
+		if len(fields) < 5 || len(fs) < 3 {
+			continue
+		}
+		mnt := cgroupMount{dir: unescapeMountPath(fields[4]), root: unescapeMountPath(fields[3])}
+		switch fs[0] {
+		case "cgroup2":
+			mnt.v2 = true
+			controllers, _ := ioutil.ReadFile(filepath.Join(mnt.dir, "cgroup.controllers"))
+			for _, c := range strings.Fields(string(controllers)) {
+				mnt.memory = mnt.memory || c == "memory"
+			}
+		case "cgroup":
+			mnt.options = make(map[string]bool)
+			for _, opt := range strings.Split(fs[2], ",") {
+				mnt.options[opt] = true
+			}
+			mnt.memory = mnt.options["memory"]
+		default:
+			continue
+		}
+		mounts = append(mounts, mnt)
+	}
+	return mounts, nil
+}
+
+// findCgroupMount returns the mount of the hierarchy with controllers (as listed
+// in /proc/PID/cgroup, empty for cgroup2) that contains path.
+func findCgroupMount(mounts []cgroupMount, controllers, path string) (string, bool, bool) {
+	for _, mnt := range mounts {
+		if mnt.v2 != (controllers == "") {
+			continue
+		}
+		match := true
+		for _, c := range strings.Split(controllers, ",") {
+			match = match && (mnt.v2 || mnt.options[c])
+		}
+		rel, err := filepath.Rel(mnt.root, path)
+		if !match || err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return filepath.Join(mnt.dir, rel), mnt.memory, true
+	}
+	return "", false, false
+}
+
+func memAvailable() (uint64, error) {
+	data, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("bad MemAvailable value %q: %v", fields[1], err)
+		}
+		return kb << 10, nil
+	}
+	return 0, fmt.Errorf("no MemAvailable in /proc/meminfo")
+}
@@ -0,0 +1,41 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+)
+
+func TestFindCgroupMount(t *testing.T) {
+	mounts := []cgroupMount{
+		{dir: "/sys/fs/cgroup/cpu,cpuacct", root: "/", options: map[string]bool{"rw": true, "cpu": true, "cpuacct": true}},
+		{dir: "/syzcgroup/cpu", root: "/", options: map[string]bool{"rw": true, "cpuset": true}},
+		{dir: "/sys/fs/cgroup/memory", root: "/", options: map[string]bool{"rw": true, "memory": true}, memory: true},
+		{dir: "/sys/fs/cgroup/systemd", root: "/", options: map[string]bool{"rw": true, "name=systemd": true}},
+		{dir: "/syzcgroup/unified", root: "/syz", v2: true, memory: true},
+	}
+	tests := []struct {
+		controllers string
+		path        string
+		dir         string
+		memory      bool
+		ok          bool
+	}{
+		{"cpu,cpuacct", "/syz1", "/sys/fs/cgroup/cpu,cpuacct/syz1", false, true},
+		{"memory", "/", "/sys/fs/cgroup/memory", true, true},
+		{"memory", "/a/b", "/sys/fs/cgroup/memory/a/b", true, true},
+		{"name=systemd", "/user.slice", "/sys/fs/cgroup/systemd/user.slice", false, true},
+		{"", "/syz/syz3", "/syzcgroup/unified/syz3", true, true},
+		// Outside of the root of the only cgroup2 mount.
+		{"", "/user.slice", "", false, false},
+		{"blkio", "/", "", false, false},
+	}
+	for _, test := range tests {
+		dir, memory, ok := findCgroupMount(mounts, test.controllers, test.path)
+		if dir != test.dir || memory != test.memory || ok != test.ok {
+			t.Errorf("%q %v: got %q/%v/%v, want %q/%v/%v", test.controllers, test.path,
+				dir, memory, ok, test.dir, test.memory, test.ok)
+		}
+	}
+}
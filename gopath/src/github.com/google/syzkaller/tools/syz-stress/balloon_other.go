@@ -0,0 +1,31 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+func checkBalloon() error {
+	return fmt.Errorf("-balloon is supported only on linux")
+}
+
+func runBalloon(size string) int {
+	return 1
+}
+
+func executorCgroups(pid int) string {
+	return ""
+}
+
+func joinCgroups(pid, target int) error {
+	return fmt.Errorf("cgroups are supported only on linux")
+}
+
+func memAvailable() (uint64, error) {
+	return 0, fmt.Errorf("available memory is known only on linux")
+}
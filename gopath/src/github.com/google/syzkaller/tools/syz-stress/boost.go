@@ -0,0 +1,64 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagBoostCalls = flag.String("boost-calls", "", "file:multiplier, multiply priority of syscalls listed "+
+	"in file (one name or glob per line, e.g. recently changed calls) by multiplier")
+
+// loadBoost parses -boost-calls and returns multipliers indexed by syscall ID for enabled calls.
+// Boosting is applied after -syscalls filtering and -call-weights, so it never enables a call.
+func loadBoost(target *prog.Target, spec string, calls map[*prog.Syscall]bool) (map[int]float32, error) {
+	colon := strings.LastIndexByte(spec, ':')
+	if colon <= 0 {
+		return nil, fmt.Errorf("bad -boost-calls %q, want file:multiplier", spec)
+	}
+	mult, err := strconv.ParseFloat(spec[colon+1:], 32)
+	if err != nil || mult <= 0 {
+		return nil, fmt.Errorf("bad -boost-calls multiplier %q", spec[colon+1:])
+	}
+	data, err := ioutil.ReadFile(spec[:colon])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read boosted calls: %v", err)
+	}
+	boost := make(map[int]float32)
+	var names []string
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		pattern := strings.TrimSpace(s.Text())
+		if pattern == "" || pattern[0] == '#' {
+			continue
+		}
+		matched, err := matchSyscalls(target, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		for _, c := range matched {
+			if calls[c] && boost[c.ID] == 0 {
+				boost[c.ID] = float32(mult)
+				names = append(names, c.Name)
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	log.Logf(0, "%v/%v: boosting %v enabled calls by %v: %v", target.OS, target.Arch,
+		len(names), mult, strings.Join(names, " "))
+	return boost, nil
+}
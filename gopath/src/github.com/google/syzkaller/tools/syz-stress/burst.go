@@ -0,0 +1,65 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagBurst = flag.String("burst", "", "on:off durations (e.g. 5s:2s), fuzz for on, then idle for off, repeatedly")
+
+	// burstGate holds a channel that is closed while execution is allowed.
+	burstGate atomic.Value
+	burstOn   uint32
+)
+
+func startBurst(spec string) error {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("bad -burst %q, want on:off", spec)
+	}
+	on, err := time.ParseDuration(parts[0])
+	if err != nil {
+		return fmt.Errorf("bad -burst on duration: %v", err)
+	}
+	off, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return fmt.Errorf("bad -burst off duration: %v", err)
+	}
+	if on <= 0 || off <= 0 {
+		return fmt.Errorf("bad -burst %q, durations must be positive", spec)
+	}
+	open := make(chan struct{})
+	close(open)
+	burstGate.Store(open)
+	atomic.StoreUint32(&burstOn, 1)
+	go func() {
+		for {
+			time.Sleep(on)
+			burstGate.Store(make(chan struct{}))
+			atomic.StoreUint32(&burstOn, 0)
+			log.Logf(1, "burst: idle for %v", off)
+			time.Sleep(off)
+			closed := burstGate.Load().(chan struct{})
+			atomic.StoreUint32(&burstOn, 1)
+			close(closed)
+			log.Logf(1, "burst: fuzzing for %v", on)
+		}
+	}()
+	return nil
+}
+
+// waitBurst blocks while execution is paused by -burst.
+func waitBurst() {
+	if gate, ok := burstGate.Load().(chan struct{}); ok {
+		<-gate
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+type choiceTableDump struct {
+	Calls []string
+	// Totals[i] is the sum of weights of all calls that can be generated after Calls[i].
+	Totals []int
+	// Weights[i][j] is the weight of generating Calls[j] after Calls[i],
+	// the probability is Weights[i][j]/Totals[i].
+	Weights [][]int
+}
+
+// dumpChoiceTable writes the call-to-call weights of the choice table ct for
+// the enabled calls into file. Files with .csv extension get one from,to,weight
+// row per pair, everything else is written as JSON.
+func dumpChoiceTable(file string, target *prog.Target, ct *prog.ChoiceTable) error {
+	var enabled []*prog.Syscall
+	for _, c := range target.Syscalls {
+		if ct.Weights(c.ID) != nil {
+			enabled = append(enabled, c)
+		}
+	}
+	sort.Slice(enabled, func(i, j int) bool {
+		return enabled[i].Name < enabled[j].Name
+	})
+	dump := &choiceTableDump{}
+	for _, from := range enabled {
+		weights := ct.Weights(from.ID)
+		row := make([]int, len(enabled))
+		total := 0
+		for j, to := range enabled {
+			row[j] = weights[to.ID]
+			total += row[j]
+		}
+		dump.Calls = append(dump.Calls, from.Name)
+		dump.Totals = append(dump.Totals, total)
+		dump.Weights = append(dump.Weights, row)
+	}
+	var data []byte
+	if filepath.Ext(file) == ".csv" {
+		buf := new(bytes.Buffer)
+		fmt.Fprintf(buf, "from,to,weight\n")
+		for i, from := range dump.Calls {
+			for j, to := range dump.Calls {
+				fmt.Fprintf(buf, "%v,%v,%v\n", from, to, dump.Weights[i][j])
+			}
+		}
+		data = buf.Bytes()
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(dump, "", "\t"); err != nil {
+			return err
+		}
+	}
+	return osutil.WriteFile(file, data)
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var (
+	flagCollapseFraction = flag.Float64("collapse-fraction", 0, "recycle executor of a proc when its average "+
+		"signal per program drops below this fraction of the run average (requires -cover, 0 - disabled)")
+	flagCollapsePrograms = flag.Int("collapse-programs", 100, "number of consecutive low-signal programs that indicate coverage collapse")
+	flagCollapseExit     = flag.Bool("collapse-exit", false, "exit when coverage collapses on all procs at once")
+
+	statRecycle     uint64
+	statSignalTotal uint64
+	statSignalProgs uint64
+
+	collapseMu sync.Mutex
+	// collapsed holds the last time coverage collapsed on each proc.
+	collapsed []time.Time
+)
+
+const (
+	// The run average is not trusted until this many programs were executed.
+	collapseWarmup = 1000
+	// Coverage is considered collapsed globally if it collapsed on all procs within this window.
+	collapseWindow = time.Minute
+	collapseDecay  = 0.9
+)
+
+func initCollapse(procs int) {
+	collapsed = make([]time.Time, procs)
+}
+
+// collapseDetector tracks signal per program on a single proc and detects when KCOV
+// silently stops returning coverage.
+type collapseDetector struct {
+	enabled bool
+	avg     float64 // exponential moving average of signal per program
+	low     int     // number of consecutive programs with the average below the threshold
+}
+
+// add accounts signal of an executed program and returns true if coverage collapsed.
+func (cd *collapseDetector) add(signal int) bool {
+	total := atomic.AddUint64(&statSignalTotal, uint64(signal))
+	progs := atomic.AddUint64(&statSignalProgs, 1)
+	runAvg := float64(total) / float64(progs)
+	if cd.low == 0 && cd.avg == 0 {
+		cd.avg = runAvg
+	}
+	cd.avg = cd.avg*collapseDecay + float64(signal)*(1-collapseDecay)
+	if progs < collapseWarmup {
+		return false
+	}
+	if cd.avg >= runAvg**flagCollapseFraction {
+		cd.low = 0
+		return false
+	}
+	cd.low++
+	if cd.low < *flagCollapsePrograms {
+		return false
+	}
+	cd.low = 0
+	cd.avg = runAvg
+	return true
+}
+
+func progSignal(info *ipc.ProgInfo) int {
+	if info == nil {
+		return 0
+	}
+	n := len(info.Extra.Signal)
+	for _, c := range info.Calls {
+		n += len(c.Signal)
+	}
+	return n
+}
+
+func (proc *proc) handleCollapse() {
+	atomic.AddUint64(&statRecycle, 1)
+	log.Logf(0, "proc %v: coverage collapsed, recycling executor", proc.pid)
+	proc.recycleEnv()
+	if noteCollapse(proc.pid, time.Now()) {
+		handleGlobalCollapse()
+	}
+}
+
+// noteCollapse records that coverage collapsed on proc pid at time now and returns true
+// if it collapsed on all procs within collapseWindow.
+func noteCollapse(pid int, now time.Time) bool {
+	collapseMu.Lock()
+	defer collapseMu.Unlock()
+	collapsed[pid] = now
+	for _, t := range collapsed {
+		if now.Sub(t) > collapseWindow {
+			return false
+		}
+	}
+	for i := range collapsed {
+		collapsed[i] = time.Time{}
+	}
+	return true
+}
+
+func handleGlobalCollapse() {
+	log.Logf(0, "WARNING: COVERAGE COLLAPSED ON ALL PROCS")
+	output, err := osutil.RunCmd(time.Minute, "", "dmesg")
+	if err != nil {
+		log.Logf(0, "failed to run dmesg: %v", err)
+	}
+	if *flagCrashdir != "" {
+		file := filepath.Join(*flagCrashdir, fmt.Sprintf("collapse-dmesg-%v.log", time.Now().Unix()))
+		if err := osutil.WriteFile(file, output); err != nil {
+			log.Logf(0, "failed to save dmesg: %v", err)
+		} else {
+			log.Logf(0, "dmesg saved to %v", file)
+		}
+	} else {
+		const maxTail = 64 << 10
+		if len(output) > maxTail {
+			output = output[len(output)-maxTail:]
+		}
+		log.Logf(0, "dmesg:\n%s", output)
+	}
+	if *flagCollapseExit {
+		log.Fatalf("exiting due to coverage collapse")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+)
+
+// resetCollapse resets the run-wide signal statistics and sets -collapse-* flags.
+// It returns a function that restores the flags.
+func resetCollapse(fraction float64, programs int) func() {
+	atomic.StoreUint64(&statSignalTotal, 0)
+	atomic.StoreUint64(&statSignalProgs, 0)
+	oldFraction, oldPrograms := *flagCollapseFraction, *flagCollapsePrograms
+	*flagCollapseFraction, *flagCollapsePrograms = fraction, programs
+	return func() {
+		*flagCollapseFraction, *flagCollapsePrograms = oldFraction, oldPrograms
+	}
+}
+
+func TestCollapseDetector(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal func(i int) int
+		// The first program (counting from 0) the collapse is detected on, or -1.
+		wantMin, wantMax int
+	}{
+		{
+			name:    "healthy",
+			signal:  func(i int) int { return 50 + i%100 },
+			wantMin: -1,
+		},
+		{
+			name: "collapse",
+			signal: func(i int) int {
+				if i >= 2000 {
+					return 0
+				}
+				return 100
+			},
+			// The moving average needs a few dozen programs to drop below 10% of the run average,
+			// then -collapse-programs consecutive programs must stay below it.
+			wantMin: 2000 + 100,
+			wantMax: 2000 + 200,
+		},
+		{
+			name:    "no coverage at all",
+			signal:  func(i int) int { return 0 },
+			wantMin: -1,
+		},
+		{
+			name: "collapse during warmup",
+			signal: func(i int) int {
+				if i >= 100 {
+					return 0
+				}
+				return 100
+			},
+			// Nothing is reported until collapseWarmup programs, then the average is still low.
+			wantMin: collapseWarmup,
+			wantMax: collapseWarmup + 200,
+		},
+		{
+			name: "short dip",
+			signal: func(i int) int {
+				if i >= 2000 && i < 2050 {
+					return 0
+				}
+				return 100
+			},
+			wantMin: -1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer resetCollapse(0.1, 100)()
+			cd := &collapseDetector{enabled: true}
+			got := -1
+			for i := 0; i < 5000; i++ {
+				if cd.add(test.signal(i)) {
+					got = i
+					break
+				}
+			}
+			if test.wantMin == -1 {
+				if got != -1 {
+					t.Fatalf("collapse detected on program %v", got)
+				}
+				return
+			}
+			if got < test.wantMin || got > test.wantMax {
+				t.Fatalf("collapse detected on program %v, want [%v, %v]", got, test.wantMin, test.wantMax)
+			}
+		})
+	}
+}
+
+func TestCollapseRecovery(t *testing.T) {
+	defer resetCollapse(0.1, 100)()
+	cd := &collapseDetector{enabled: true}
+	for i := 0; i < 2000; i++ {
+		cd.add(100)
+	}
+	collapses := 0
+	for i := 0; i < 1000; i++ {
+		if cd.add(0) {
+			collapses++
+		}
+	}
+	if collapses < 2 {
+		t.Fatalf("persistent collapse reported %v times, want it reported again after recycling", collapses)
+	}
+	// After the executor is recycled, coverage is back and no more collapses are reported.
+	for i := 0; i < 1000; i++ {
+		if cd.add(100) {
+			t.Fatalf("collapse reported after coverage recovered")
+		}
+	}
+}
+
+func TestProgSignal(t *testing.T) {
+	if got := progSignal(nil); got != 0 {
+		t.Fatalf("progSignal(nil) = %v", got)
+	}
+	info := &ipc.ProgInfo{
+		Calls: []ipc.CallInfo{
+			{Signal: []uint32{1, 2, 3}},
+			{},
+			{Signal: []uint32{4}},
+		},
+		Extra: ipc.CallInfo{Signal: []uint32{5, 6}},
+	}
+	if got := progSignal(info); got != 6 {
+		t.Fatalf("progSignal = %v, want 6", got)
+	}
+}
+
+func TestNoteCollapse(t *testing.T) {
+	initCollapse(3)
+	now := time.Now()
+	if noteCollapse(0, now) || noteCollapse(1, now.Add(time.Second)) {
+		t.Fatalf("global collapse reported before all procs collapsed")
+	}
+	if !noteCollapse(2, now.Add(2*time.Second)) {
+		t.Fatalf("global collapse is not reported")
+	}
+	// The state is reset after a global collapse.
+	if noteCollapse(2, now.Add(3*time.Second)) {
+		t.Fatalf("global collapse reported twice")
+	}
+	// Collapses that are too far apart are not global.
+	later := now.Add(collapseWindow + 10*time.Second)
+	if noteCollapse(0, later) || noteCollapse(1, later) {
+		t.Fatalf("global collapse reported with a stale proc")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var (
+	flagCompare     = flag.String("compare", "", "compare crashes of two runs and exit: -compare crashdirA crashdirB")
+	flagCompareJSON = flag.String("compare-json", "", "also write -compare results to this json file")
+)
+
+// runComparison is the result of comparing crashes of two runs.
+type runComparison struct {
+	A, B      string
+	OnlyA     []string // titles found only in run A
+	OnlyB     []string // titles found only in run B
+	Common    []string // titles found in both runs with at least one common program
+	Different []string // titles found in both runs with different programs
+	Warnings  []string
+}
+
+// readRunIndex reads the crashdir index of a run and returns the set of program hashes
+// saved for every title. Missing and malformed parts of the index produce warnings.
+func readRunIndex(dir string, warn func(string, ...interface{})) map[string]map[string]bool {
+	titles := make(map[string]map[string]bool)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		warn("%v: failed to read crash index: %v", dir, err)
+		return titles
+	}
+	idx := new(crashIndex)
+	if err := json.Unmarshal(data, idx); err != nil {
+		warn("%v: failed to parse crash index: %v", dir, err)
+		return titles
+	}
+	for i, a := range idx.Artifacts {
+		if a == nil || a.Title == "" || a.Name == "" {
+			warn("%v: artifact #%v has no title or name, skipping", dir, i)
+			continue
+		}
+		if titles[a.Title] == nil {
+			titles[a.Title] = make(map[string]bool)
+		}
+		// Names are <category>-<hash>-<run id>, <category>-<hash> or just <hash> for older runs.
+		name := a.Name
+		if a.RunID != "" {
+			name = strings.TrimSuffix(name, "-"+a.RunID)
+		}
+		titles[a.Title][name[strings.LastIndexByte(name, '-')+1:]] = true
+	}
+	return titles
+}
+
+func compareRuns(dirA, dirB string) *runComparison {
+	res := &runComparison{A: dirA, B: dirB}
+	warn := func(msg string, args ...interface{}) {
+		res.Warnings = append(res.Warnings, fmt.Sprintf(msg, args...))
+	}
+	a := readRunIndex(dirA, warn)
+	b := readRunIndex(dirB, warn)
+	for title, progsA := range a {
+		progsB := b[title]
+		if progsB == nil {
+			res.OnlyA = append(res.OnlyA, title)
+			continue
+		}
+		common := false
+		for hash := range progsA {
+			if progsB[hash] {
+				common = true
+			}
+		}
+		if common {
+			res.Common = append(res.Common, title)
+		} else {
+			res.Different = append(res.Different, title)
+		}
+	}
+	for title := range b {
+		if a[title] == nil {
+			res.OnlyB = append(res.OnlyB, title)
+		}
+	}
+	for _, list := range [][]string{res.OnlyA, res.OnlyB, res.Common, res.Different} {
+		sort.Strings(list)
+	}
+	return res
+}
+
+func (res *runComparison) String() string {
+	buf := new(strings.Builder)
+	section := func(name string, titles []string) {
+		fmt.Fprintf(buf, "%v: %v\n", name, len(titles))
+		for _, title := range titles {
+			fmt.Fprintf(buf, "\t%v\n", title)
+		}
+	}
+	section("only in "+res.A, res.OnlyA)
+	section("only in "+res.B, res.OnlyB)
+	section("in both, different programs", res.Different)
+	section("in both, same program", res.Common)
+	return buf.String()
+}
+
+// runCompare compares crashes of two runs and logs the result.
+func runCompare(dirA, dirB string) {
+	res := compareRuns(dirA, dirB)
+	for _, w := range res.Warnings {
+		log.Logf(0, "warning: %v", w)
+	}
+	log.Logf(0, "crash comparison:\n%v", strings.TrimSuffix(res.String(), "\n"))
+	if *flagCompareJSON != "" {
+		data, err := json.MarshalIndent(res, "", "\t")
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if err := osutil.WriteFile(*flagCompareJSON, data); err != nil {
+			log.Fatalf("failed to write comparison: %v", err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syz-stress-compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dirA := writeRun(t, dir, "a", `{"Artifacts": [
+		{"Title": "only A", "Name": "other-aaaa"},
+		{"Title": "same", "Name": "oob-write-1111-run1", "RunID": "run1"},
+		{"Title": "same", "Name": "oob-write-2222-run1", "RunID": "run1"},
+		{"Title": "different", "Name": "uaf-3333"},
+		{"Title": "old name", "Name": "4444"}
+	]}`)
+	dirB := writeRun(t, dir, "b", `{"Artifacts": [
+		{"Title": "only B", "Name": "other-bbbb"},
+		{"Title": "same", "Name": "oob-write-2222-run2", "RunID": "run2"},
+		{"Title": "different", "Name": "uaf-5555"},
+		{"Title": "old name", "Name": "other-4444"}
+	]}`)
+	res := compareRuns(dirA, dirB)
+	want := &runComparison{
+		A:         dirA,
+		B:         dirB,
+		OnlyA:     []string{"only A"},
+		OnlyB:     []string{"only B"},
+		Common:    []string{"old name", "same"},
+		Different: []string{"different"},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("got:\n%+v\nwant:\n%+v", res, want)
+	}
+	// The JSON output has the same content.
+	data, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res1 := new(runComparison)
+	if err := json.Unmarshal(data, res1); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res1, want) {
+		t.Fatalf("JSON round trip:\n%+v\nwant:\n%+v", res1, want)
+	}
+	text := res.String()
+	for _, line := range []string{
+		"only in " + dirA + ": 1\n\tonly A\n",
+		"only in " + dirB + ": 1\n\tonly B\n",
+		"in both, different programs: 1\n\tdifferent\n",
+		"in both, same program: 2\n\told name\n\tsame\n",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("text output misses %q:\n%v", line, text)
+		}
+	}
+}
+
+func TestComparePartialRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syz-stress-compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		name     string
+		index    string // contents of index.json, no file if empty
+		titles   []string
+		warnings int
+	}{
+		{
+			name:     "missing",
+			warnings: 1,
+		},
+		{
+			name:     "truncated",
+			index:    `{"Artifacts": [{"Title": "foo", "Na`,
+			warnings: 1,
+		},
+		{
+			name: "fields",
+			index: `{"Artifacts": [
+				{"Title": "foo", "Name": "other-1111"},
+				{"Title": "no name"},
+				{"Name": "other-2222"},
+				null
+			]}`,
+			titles:   []string{"foo"},
+			warnings: 3,
+		},
+	}
+	for _, test := range tests {
+		runDir := filepath.Join(dir, test.name)
+		if test.index != "" {
+			runDir = writeRun(t, dir, test.name, test.index)
+		}
+		var warnings []string
+		titles := readRunIndex(runDir, func(msg string, args ...interface{}) {
+			warnings = append(warnings, msg)
+		})
+		var got []string
+		for title := range titles {
+			got = append(got, title)
+		}
+		if !reflect.DeepEqual(got, test.titles) {
+			t.Errorf("%v: got titles %q, want %q", test.name, got, test.titles)
+		}
+		if len(warnings) != test.warnings {
+			t.Errorf("%v: got %v warnings, want %v: %q", test.name, len(warnings), test.warnings, warnings)
+		}
+	}
+	// A missing run produces a warning, all crashes of the other run are unique to it.
+	res := compareRuns(filepath.Join(dir, "missing"), filepath.Join(dir, "fields"))
+	if len(res.Warnings) != 4 || !reflect.DeepEqual(res.OnlyB, []string{"foo"}) || len(res.OnlyA) != 0 {
+		t.Fatalf("bad comparison with a missing run: %+v", res)
+	}
+}
+
+func writeRun(t *testing.T, dir, name, index string) string {
+	runDir := filepath.Join(dir, name)
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(runDir, "index.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return runDir
+}
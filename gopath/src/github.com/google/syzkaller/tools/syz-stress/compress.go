@@ -0,0 +1,52 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var flagCompress = flag.Bool("compress", false, "gzip files saved to crashdir (adds .gz suffix)")
+
+// artifactSuffix returns the suffix appended to names of files saved to crashdir.
+func artifactSuffix() string {
+	if *flagCompress {
+		return ".gz"
+	}
+	return ""
+}
+
+// writeArtifact writes data to file+artifactSuffix() and returns the number of bytes written.
+func writeArtifact(file string, data []byte) (int, error) {
+	if *flagCompress {
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		data = buf.Bytes()
+	}
+	return len(data), osutil.WriteFile(file+artifactSuffix(), data)
+}
+
+// readArtifact reads file, transparently decompressing it if it has .gz suffix.
+func readArtifact(file string) ([]byte, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil || !strings.HasSuffix(file, ".gz") {
+		return data, err
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
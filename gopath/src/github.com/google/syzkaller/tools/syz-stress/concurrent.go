@@ -0,0 +1,173 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagSaveConcurrent = flag.Bool("save-concurrent", false, "save programs that other procs executed "+
+		"concurrently with a crash as <hash>.concurrent")
+	flagReplayConcurrent = flag.String("replay-concurrent", "",
+		"execute programs of a .concurrent crash bundle in parallel with the recorded relative timing and exit")
+	flagReplayConcurrentRuns = flag.Int("replay-concurrent-runs", 10, "number of -replay-concurrent attempts")
+
+	// concurrentSets maps programs being executed to programs that other procs
+	// executed concurrently with them, it's maintained only with -save-concurrent.
+	concurrentSets sync.Map
+)
+
+// concurrentProg is a program in a .concurrent bundle.
+type concurrentProg struct {
+	pid   int
+	state string // "crashed", "executing" or "completed"
+	// offset is the start time of the program relative to the crashed program.
+	offset time.Duration
+	data   []byte
+}
+
+// snapshotConcurrent returns the program executed by proc pid followed by programs
+// of other procs that overlapped with it in time: the ones they are executing now
+// and the ones they completed since the program started.
+func snapshotConcurrent(pid int, data []byte, start, end time.Time) []concurrentProg {
+	res := []concurrentProg{{pid: pid, state: "crashed", data: data}}
+	for other := range lastProgs {
+		if other == pid {
+			continue
+		}
+		if cur, _ := currentProgs[other].Load().([]byte); len(cur) != 0 {
+			if curStart := time.Unix(0, atomic.LoadInt64(&currentStarts[other])); !curStart.After(end) {
+				res = append(res, concurrentProg{other, "executing", curStart.Sub(start), cur})
+			}
+		}
+		if last, _ := lastProgs[other].Load().(*inflightProg); last != nil && last.end >= start.UnixNano() {
+			res = append(res, concurrentProg{other, "completed", time.Duration(last.start - start.UnixNano()), last.data})
+		}
+	}
+	return res
+}
+
+// programConcurrent returns the .concurrent bundle of a program being executed,
+// or nil if no other programs were executed concurrently with it.
+func programConcurrent(p *prog.Prog) []byte {
+	v, ok := concurrentSets.Load(p)
+	if !ok {
+		return nil
+	}
+	progs := v.([]concurrentProg)
+	if len(progs) < 2 {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	for _, cp := range progs {
+		fmt.Fprintf(buf, "# proc %v %v start %v\n%s\n", cp.pid, cp.state, cp.offset, cp.data)
+	}
+	return buf.Bytes()
+}
+
+// parseConcurrent parses a .concurrent bundle. Programs are separated by empty lines
+// and each starts with a header line written by programConcurrent.
+func parseConcurrent(data []byte) ([]concurrentProg, error) {
+	var res []concurrentProg
+	for _, data := range bytes.Split(data, []byte("\n\n")) {
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		var cp concurrentProg
+		var offset string
+		if _, err := fmt.Sscanf(string(data), "# proc %d %s start %s\n", &cp.pid, &cp.state, &offset); err != nil {
+			return nil, fmt.Errorf("bad program header: %v", err)
+		}
+		var err error
+		if cp.offset, err = time.ParseDuration(offset); err != nil {
+			return nil, fmt.Errorf("bad start offset %q: %v", offset, err)
+		}
+		cp.data = data
+		res = append(res, cp)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no programs")
+	}
+	return res, nil
+}
+
+// runReplayConcurrent executes programs of a .concurrent bundle on a fresh set of
+// execution environments, one per program, starting each program at its recorded
+// offset. Nothing else is executed meanwhile.
+func runReplayConcurrent(ft *fuzzTarget, file string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("failed to read concurrent bundle: %v", err)
+	}
+	bundle, err := parseConcurrent(data)
+	if err != nil {
+		log.Fatalf("failed to parse %v: %v", file, err)
+	}
+	sort.Slice(bundle, func(i, j int) bool {
+		return bundle[i].offset < bundle[j].offset
+	})
+	var progs []*prog.Prog
+	for i, cp := range bundle {
+		p, err := ft.target.Deserialize(cp.data, prog.NonStrict)
+		if err != nil {
+			log.Fatalf("program %v (proc %v): failed to deserialize: %v", i, cp.pid, err)
+		}
+		if c := disabledCall(ft, p); c != "" {
+			log.Fatalf("program %v (proc %v): uses disabled syscall %v", i, cp.pid, c)
+		}
+		progs = append(progs, p)
+	}
+	gate = ipc.NewGate(2*len(progs), nil)
+	var procs []*proc
+	for i := range progs {
+		procs = append(procs, newProc(ft, i))
+	}
+	crashedRuns := 0
+	for run := 0; run < *flagReplayConcurrentRuns; run++ {
+		var wg sync.WaitGroup
+		crashed := make([]bool, len(progs))
+		base := time.Now().Add(-bundle[0].offset)
+		for i := range progs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				proc, p := procs[i], progs[i]
+				time.Sleep(time.Until(base.Add(bundle[i].offset)))
+				atomic.AddUint64(&statExec, 1)
+				output, _, hanged, err := proc.env.Exec(ft.execOpts, p)
+				if crashed[i] = handleResult(p, output, hanged, err); crashed[i] {
+					outMu.Lock()
+					fmt.Fprintf(progOutput, "run %v: program of proc %v (%v) crashed:\n%s\n",
+						run, bundle[i].pid, bundle[i].state, p.Serialize())
+					progOutput.Write(output)
+					outMu.Unlock()
+				}
+				if err != nil || hanged {
+					proc.recycleEnv()
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, c := range crashed {
+			if c {
+				crashedRuns++
+				break
+			}
+		}
+	}
+	fmt.Printf("replayed %v programs %v times, %v runs crashed\n", len(progs), *flagReplayConcurrentRuns, crashedRuns)
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+var (
+	flagConfig = flag.String("config", "",
+		"JSON file that maps flag names to values, e.g. {\"procs\": 4, \"crashdir\": \"crashes\"};\n"+
+			"flags given on the command line or in the environment override the file")
+	flagPrintConfig = flag.Bool("print-config", false, "print the effective configuration as a -config file and exit")
+)
+
+// loadConfig sets flags of fs that are not set yet from the JSON config file.
+// It must be called after fs.Parse. The config is an object with flag names
+// as keys, any flag can be set this way. Unknown flags are rejected.
+// Values are strings in the command line syntax, or JSON numbers and booleans.
+func loadConfig(fs *flag.FlagSet, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+	var cfg map[string]json.RawMessage
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse config %v: %v", file, err)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, raw := range cfg {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("config %v: unknown field %q", file, name)
+		}
+		val, err := configValue(raw)
+		if err != nil {
+			return fmt.Errorf("config %v: bad value of %v: %v", file, name, err)
+		}
+		prev := f.Value.String()
+		if err := fs.Set(name, val); err != nil {
+			return fmt.Errorf("config %v: bad value of %v: %v", file, name, err)
+		}
+		if set[name] {
+			// The value is still checked, but the flag keeps its value from the command line.
+			fs.Set(name, prev)
+		}
+	}
+	return nil
+}
+
+// configValue returns the command line form of a config value.
+func configValue(raw json.RawMessage) (string, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) != 0 && raw[0] == '"' {
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", err
+	}
+	switch v.(type) {
+	case bool, float64:
+		return string(raw), nil
+	}
+	return "", fmt.Errorf("want a string, number or boolean, got %s", raw)
+}
+
+// printConfig writes the current values of all flags of fs as a config file to w.
+func printConfig(w io.Writer, fs *flag.FlagSet) error {
+	cfg := make(map[string]interface{})
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		var val interface{} = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			switch v := getter.Get().(type) {
+			case time.Duration:
+			case bool, int, int64, uint, uint64, float64:
+				val = v
+			}
+		}
+		cfg[f.Name] = val
+	})
+	data, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
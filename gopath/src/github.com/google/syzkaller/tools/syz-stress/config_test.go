@@ -0,0 +1,187 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfigFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.String("config", "", "")
+	fs.String("str", "default", "")
+	fs.Int("num", 1, "")
+	fs.Bool("on", false, "")
+	fs.Duration("dur", time.Second, "")
+	return fs
+}
+
+func flagValues(fs *flag.FlagSet) map[string]string {
+	vals := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" {
+			vals[f.Name] = f.Value.String()
+		}
+	})
+	return vals
+}
+
+func writeConfig(t *testing.T, dir, data string) string {
+	file := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syz-stress-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tests := []struct {
+		config string
+		args   []string
+		env    map[string]string
+		want   map[string]string // only the flags that differ from the defaults
+		err    string
+	}{
+		{
+			config: `{}`,
+		},
+		{
+			config: `{"str": "a b", "num": 4, "on": true, "dur": "5s"}`,
+			want:   map[string]string{"str": "a b", "num": "4", "on": "true", "dur": "5s"},
+		},
+		{
+			config: `{"num": "4", "on": "true"}`,
+			want:   map[string]string{"num": "4", "on": "true"},
+		},
+		{
+			config: `{"str": "a", "num": 4, "on": true}`,
+			args:   []string{"-num=8", "-on=false"},
+			want:   map[string]string{"str": "a", "num": "8"},
+		},
+		{
+			config: `{"str": "a", "num": 4}`,
+			env:    map[string]string{"SYZSTRESS_NUM": "6", "SYZSTRESS_STR": "env"},
+			args:   []string{"-str=cmd"},
+			want:   map[string]string{"str": "cmd", "num": "6"},
+		},
+		{
+			config: `{"str": "a", "nosuchflag": 1}`,
+			err:    `unknown field "nosuchflag"`,
+		},
+		{
+			config: `{"config": "other.json"}`,
+			err:    `unknown field "config"`,
+		},
+		{
+			config: `{"num": "abc"}`,
+			err:    "bad value of num",
+		},
+		{
+			config: `{"num": 1.5}`,
+			err:    "bad value of num",
+		},
+		{
+			config: `{"num": [1]}`,
+			err:    "bad value of num",
+		},
+		{
+			config: `{"str": null}`,
+			err:    "bad value of str",
+		},
+		{
+			// Values overridden on the command line are checked too.
+			config: `{"num": "abc"}`,
+			args:   []string{"-num=8"},
+			err:    "bad value of num",
+		},
+		{
+			config: `{"num": 4`,
+			err:    "failed to parse config",
+		},
+	}
+	for i, test := range tests {
+		file := writeConfig(t, dir, test.config)
+		for name, val := range test.env {
+			os.Setenv(name, val)
+		}
+		fs := testConfigFlags()
+		want := flagValues(fs)
+		for name, val := range test.want {
+			want[name] = val
+		}
+		err := setFlagsFromEnv(fs)
+		if err == nil {
+			err = fs.Parse(append(test.args, "-config="+file))
+		}
+		for name := range test.env {
+			os.Unsetenv(name)
+		}
+		if err != nil {
+			t.Fatalf("#%v: %v", i, err)
+		}
+		err = loadConfig(fs, file)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("#%v: got error %v, want %q", i, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%v: %v", i, err)
+			continue
+		}
+		if got := flagValues(fs); !reflect.DeepEqual(got, want) {
+			t.Errorf("#%v: got flags %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	err := loadConfig(testConfigFlags(), filepath.Join(os.TempDir(), "syz-stress-no-such-config.json"))
+	if err == nil || !strings.Contains(err.Error(), "failed to read config") {
+		t.Fatalf("got error %v, want a read failure", err)
+	}
+}
+
+// TestPrintConfig checks that a printed config sets the same flag values when loaded.
+func TestPrintConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syz-stress-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fs := testConfigFlags()
+	if err := fs.Parse([]string{"-str=a \"b\"", "-num=-3", "-on", "-dur=1m30s"}); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := printConfig(buf, fs); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), `"config"`) {
+		t.Errorf("printed config contains -config:\n%s", buf.Bytes())
+	}
+	file := writeConfig(t, dir, buf.String())
+	fs1 := testConfigFlags()
+	if err := loadConfig(fs1, file); err != nil {
+		t.Fatalf("failed to load printed config: %v\n%s", err, buf.Bytes())
+	}
+	if got, want := flagValues(fs1), flagValues(fs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got flags %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/google/syzkaller/pkg/constants"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagCorpusConstants = flag.String("corpus-constants", "",
+	"write value distributions of scalar arguments of -corpus programs to this csv file and exit")
+
+// writeCorpusConstants writes the constants report for the corpus into file
+// and logs arguments that look constant.
+func writeCorpusConstants(target *prog.Target, file string) {
+	if *flagCorpus == "" {
+		log.Fatalf("-corpus-constants requires -corpus")
+	}
+	corpus := readCorpus(target)
+	rep := constants.Analyze(corpus)
+	flagged := 0
+	for _, a := range rep.Args {
+		if a.Constant {
+			flagged++
+			log.Logf(1, "%v %v is 0x%x in %v/%v programs", a.Call, a.Path, a.Top, a.TopPrograms, a.Programs)
+		}
+	}
+	if err := osutil.WriteFile(file, rep.CSV()); err != nil {
+		log.Fatalf("failed to write corpus constants: %v", err)
+	}
+	log.Logf(0, "analyzed %v arguments in %v programs, %v look constant", len(rep.Args), len(corpus), flagged)
+}
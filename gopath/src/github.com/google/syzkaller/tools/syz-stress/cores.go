@@ -0,0 +1,90 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagCollectCores = flag.String("collect-cores", "",
+		"collect core dumps of crashed executors into this directory (changes the system core_pattern while running)")
+
+	coresDir     string
+	coresRestore func()
+	coresMu      sync.Mutex
+	statCores    uint64
+)
+
+// Executors dump cores into coresDir under names with this prefix,
+// collectCores renames them after the program that triggered the crash.
+const corePrefix = "core."
+
+func initCores() error {
+	dir, err := filepath.Abs(*flagCollectCores)
+	if err != nil {
+		return err
+	}
+	if err := osutil.MkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create -collect-cores dir: %v", err)
+	}
+	if coresRestore, err = enableCores(filepath.Join(dir, corePrefix+"%e.%p")); err != nil {
+		return fmt.Errorf("failed to enable core dumps: %v", err)
+	}
+	coresDir = dir
+	return nil
+}
+
+// finishCores restores the system core dump settings changed by initCores.
+func finishCores() {
+	if coresRestore != nil {
+		coresRestore()
+	}
+}
+
+// collectCores renames new core dumps in coresDir after p and saves p next to them.
+// It's called after an executor failure. Cores produced concurrently by executors
+// of other procs can't be told apart and are attributed to p as well.
+func collectCores(p *prog.Prog) {
+	coresMu.Lock()
+	defer coresMu.Unlock()
+	files, err := ioutil.ReadDir(coresDir)
+	if err != nil {
+		log.Logf(0, "failed to read -collect-cores dir: %v", err)
+		return
+	}
+	data := p.Serialize()
+	base := filepath.Join(coresDir, crashName("executor", data))
+	n := 0
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name(), corePrefix) {
+			continue
+		}
+		name := base
+		if n != 0 {
+			name = fmt.Sprintf("%v.%v", base, n)
+		}
+		if err := os.Rename(filepath.Join(coresDir, f.Name()), name+".core"); err != nil {
+			log.Logf(0, "failed to rename core dump: %v", err)
+			continue
+		}
+		if err := osutil.WriteFile(name+".prog", data); err != nil {
+			log.Logf(0, "failed to save program of core dump: %v", err)
+		}
+		log.Logf(0, "executor dumped core (%v), saved to %v.core", f.Name(), name)
+		atomic.AddUint64(&statCores, 1)
+		n++
+	}
+}
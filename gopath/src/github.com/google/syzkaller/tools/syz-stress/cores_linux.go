@@ -0,0 +1,45 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"syscall"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+const corePatternFile = "/proc/sys/kernel/core_pattern"
+
+// enableCores makes executors (which inherit our limits) dump cores according to pattern
+// and returns a function that restores the previous core_pattern.
+func enableCores(pattern string) (func(), error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &lim); err != nil {
+		return nil, err
+	}
+	lim.Cur = lim.Max
+	if err := syscall.Setrlimit(syscall.RLIMIT_CORE, &lim); err != nil {
+		return nil, err
+	}
+	if lim.Cur == 0 {
+		log.Logf(0, "-collect-cores: core size hard limit is 0, no cores will be dumped")
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_DUMPABLE, 1, 0); errno != 0 {
+		return nil, errno
+	}
+	old, err := ioutil.ReadFile(corePatternFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := osutil.WriteFile(corePatternFile, []byte(pattern)); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := osutil.WriteFile(corePatternFile, old); err != nil {
+			log.Logf(0, "failed to restore %v: %v", corePatternFile, err)
+		}
+	}, nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagSaveCorpus = flag.Bool("savecorpus", false,
+		"add executed programs that produce new signal to the in-memory corpus (requires -cover)")
+
+	statCorpusAdded uint64
+)
+
+func checkSaveCorpus() error {
+	if *flagSaveCorpus && *flagScheduler == "bandit" {
+		// The bandit scheduler keeps per-program rewards for the initial corpus only.
+		return fmt.Errorf("-savecorpus is not supported with -scheduler=bandit")
+	}
+	if *flagReprioritize != 0 && !*flagSaveCorpus {
+		return fmt.Errorf("-reprioritize-interval requires -savecorpus, otherwise the corpus never changes")
+	}
+	return nil
+}
+
+// getCorpus returns the current corpus. The corpus only grows,
+// so the result stays valid while programs are added.
+func (ft *fuzzTarget) getCorpus() []*prog.Prog {
+	ft.corpusMu.RLock()
+	defer ft.corpusMu.RUnlock()
+	return ft.corpus
+}
+
+// addCorpus appends p to the corpus and bumps corpusVersion.
+func (ft *fuzzTarget) addCorpus(p *prog.Prog) {
+	ft.corpusMu.Lock()
+	defer ft.corpusMu.Unlock()
+	ft.corpus = append(ft.corpus, p)
+	atomic.AddUint64(&ft.corpusVersion, 1)
+	atomic.AddUint64(&statCorpusAdded, 1)
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+)
+
+func TestAddCorpus(t *testing.T) {
+	ft := &fuzzTarget{corpus: []*prog.Prog{new(prog.Prog)}}
+	const procs, adds = 4, 100
+	var wg sync.WaitGroup
+	for i := 0; i < procs; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				ft.addCorpus(new(prog.Prog))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			prev := 0
+			for j := 0; j < adds; j++ {
+				corpus := ft.getCorpus()
+				if len(corpus) < prev {
+					t.Errorf("corpus shrank from %v to %v", prev, len(corpus))
+					return
+				}
+				prev = len(corpus)
+				for _, p := range corpus {
+					if p == nil {
+						t.Errorf("nil program in corpus")
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := len(ft.getCorpus()), 1+procs*adds; got != want {
+		t.Fatalf("corpus has %v programs, want %v", got, want)
+	}
+	if got, want := atomic.LoadUint64(&ft.corpusVersion), uint64(procs*adds); got != want {
+		t.Fatalf("corpus version %v, want %v", got, want)
+	}
+}
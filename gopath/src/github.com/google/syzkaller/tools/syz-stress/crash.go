@@ -0,0 +1,329 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/oob/targets"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/report"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagIgnoreWarnings = flag.String("ignore-warnings", "", "regexp for titles of kernel warnings that are counted but never saved")
+	flagIgnoreOutput   = flag.String("ignore-output-regex", "",
+		"regexp for executor output of known uninteresting crashes, matching crashes are counted but not saved")
+
+	reporter       report.Reporter
+	ignoreWarnings *regexp.Regexp
+	ignoreOutput   *regexp.Regexp
+	ignoredCrashes = newTitleStats()
+	crashes        = newTitleStats()
+	warnings       = newTitleStats()
+)
+
+// Classifier decides whether results of an execution are interesting and need to be saved,
+// and returns the tag (title) to account and save them under.
+type Classifier func(output []byte, hanged bool, err error) (save bool, tag string)
+
+// classify replaces the default classification (reports, hangs and errors are crashes) if set.
+var classify Classifier
+
+// Programs that trigger a kernel warning are saved only for the first few occurrences of each title.
+const maxWarningSaves = 3
+
+func initCrashes(target *prog.Target) {
+	if err := checkHashFlag(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkCrashdirRotate(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *flagCrashdir != "" {
+		if err := osutil.MkdirAll(*flagCrashdir); err != nil {
+			log.Fatalf("failed to create crashdir: %v", err)
+		}
+	}
+	if err := checkRetention(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *flagIgnoreWarnings != "" {
+		var err error
+		if ignoreWarnings, err = regexp.Compile(*flagIgnoreWarnings); err != nil {
+			log.Fatalf("bad -ignore-warnings: %v", err)
+		}
+	}
+	if *flagIgnoreOutput != "" {
+		var err error
+		if ignoreOutput, err = regexp.Compile(*flagIgnoreOutput); err != nil {
+			log.Fatalf("bad -ignore-output-regex: %v", err)
+		}
+	}
+	cfg := &mgrconfig.Config{
+		TargetOS:     target.OS,
+		TargetArch:   target.Arch,
+		TargetVMArch: target.Arch,
+	}
+	var err error
+	if reporter, err = report.NewReporter(cfg); err != nil {
+		log.Logf(0, "kernel reports will not be parsed: %v", err)
+		reporter = nil
+	}
+	if maxImageSize, err = parseSize(*flagMaxImageSize); err != nil {
+		log.Fatalf("bad -max-image-size: %v", err)
+	}
+}
+
+// handleResult accounts the results of a program execution and saves the program if necessary.
+// It returns true if the execution crashed.
+func handleResult(p *prog.Prog, output []byte, hanged bool, err error) bool {
+	crashed, _ := handleResultTitle(p, output, hanged, err)
+	return crashed
+}
+
+// handleResultTitle is handleResult that also returns the crash or kernel warning title.
+func handleResultTitle(p *prog.Prog, output []byte, hanged bool, err error) (bool, string) {
+	if classify != nil {
+		save, tag := classify(output, hanged, err)
+		if !save || ignoredCrash(tag, output) {
+			return false, ""
+		}
+		crashes.add(tag)
+		crashTypes.add(triageCrash(tag, output))
+		checkCrashStop()
+		if *flagCrashdir != "" {
+			saveCrash(p, output, tag)
+		}
+		return true, tag
+	}
+	var rep *report.Report
+	if reporter != nil {
+		rep = reporter.Parse(output)
+	}
+	if rep != nil && !hanged && err == nil && isWarning(rep.Title) {
+		n := warnings.add(rep.Title)
+		if n == 1 && !*flagQuiet {
+			log.Logf(0, "kernel warning: %v", rep.Title)
+		}
+		ignored := ignoreWarnings != nil && ignoreWarnings.MatchString(rep.Title)
+		if n <= maxWarningSaves && !ignored && *flagCrashdir != "" {
+			saveCrash(p, output, rep.Title)
+		}
+		return false, rep.Title
+	}
+	var title, sanTitle string
+	if rep == nil {
+		sanTitle = sanitizerTitle(output)
+	}
+	switch {
+	case rep != nil:
+		title = rep.Title
+	case sanTitle != "":
+		title = sanTitle
+	case hanged:
+		title = "hang"
+	case err != nil:
+		title = "executor failure"
+	default:
+		return false, ""
+	}
+	if ignoredCrash(title, output) {
+		return false, ""
+	}
+	crashes.add(title)
+	crashTypes.add(triageCrash(title, output))
+	checkCrashStop()
+	if *flagCrashdir != "" {
+		saveCrash(p, output, title)
+	}
+	return true, title
+}
+
+// ignoredCrash returns true if output matches -ignore-output-regex,
+// such crashes are only counted under their title.
+func ignoredCrash(title string, output []byte) bool {
+	if ignoreOutput == nil || !ignoreOutput.Match(output) {
+		return false
+	}
+	ignoredCrashes.add(title)
+	return true
+}
+
+func isWarning(title string) bool {
+	return strings.HasPrefix(title, "WARNING")
+}
+
+// saveCrash writes the program and the executor output into crashdir.
+func saveCrash(p *prog.Prog, output []byte, title string) {
+	category := triageCrash(title, output)
+	if !saveCrashType(category) {
+		return
+	}
+	unlock, err := lockCrashdir()
+	if err != nil {
+		log.Logf(0, "failed to lock crashdir: %v", err)
+		return
+	}
+	defer unlock()
+	data := p.Serialize()
+	name := rotateName(crashName(category, data))
+	base := filepath.Join(*flagCrashdir, name)
+	if err := osutil.MkdirAll(filepath.Dir(base)); err != nil {
+		log.Logf(0, "failed to create crashdir subdirectory: %v", err)
+		return
+	}
+	size := 0
+	n, err := writeArtifact(base+".prog", append(runIDComment(), data...))
+	if err != nil {
+		log.Logf(0, "failed to save crash program: %v", err)
+	}
+	size += n
+	n, err = writeArtifact(base+".log", output)
+	if err != nil {
+		log.Logf(0, "failed to save crash output: %v", err)
+	}
+	size += n
+	if *flagAnnotate {
+		n, err = writeArtifact(base+".annotated", p.SerializeAnnotated())
+		if err != nil {
+			log.Logf(0, "failed to save annotated program: %v", err)
+		}
+		size += n
+	}
+	n, err = writeArtifact(base+".args", p.DescribeArgs())
+	if err != nil {
+		log.Logf(0, "failed to save program arguments: %v", err)
+	}
+	size += n
+	if lin := programLineage(p); lin != nil {
+		n, err := writeArtifact(base+".lineage", lin)
+		if err != nil {
+			log.Logf(0, "failed to save program lineage: %v", err)
+		}
+		size += n
+	}
+	if conc := programConcurrent(p); conc != nil {
+		n, err := writeArtifact(base+".concurrent", conc)
+		if err != nil {
+			log.Logf(0, "failed to save concurrent programs: %v", err)
+		}
+		size += n
+	}
+	if *flagOOB {
+		if sites := parseOOB(output); len(sites) != 0 {
+			n, err := writeArtifact(base+".oob", []byte(strings.Join(sites, "\n")+"\n"))
+			if err != nil {
+				log.Logf(0, "failed to save OOB sites: %v", err)
+			}
+			size += n
+		}
+	}
+	if c, ok := parseCapability(output); ok {
+		n, err := writeArtifact(base+".targets", []byte(targets.Report(c, targets.Match(c))))
+		if err != nil {
+			log.Logf(0, "failed to save target objects: %v", err)
+		}
+		size += n
+	}
+	size += saveImages(p, base)
+	if *flagReproBundle {
+		writeReproBundle(p, base)
+	}
+	recordArtifact(title, name)
+	if err := addArtifact(title, category, name, size); err != nil {
+		log.Logf(0, "failed to update crashdir index: %v", err)
+	}
+	uploadArtifact(title, base)
+}
+
+// titleStats counts events by title.
+type titleStats struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newTitleStats() *titleStats {
+	return &titleStats{counts: make(map[string]int)}
+}
+
+// add increments the count for title and returns the new count.
+func (ts *titleStats) add(title string) int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.counts[title]++
+	return ts.counts[title]
+}
+
+func (ts *titleStats) total() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	total := 0
+	for _, n := range ts.counts {
+		total += n
+	}
+	return total
+}
+
+type titleCount struct {
+	title string
+	count int
+}
+
+// sorted returns titles ordered by decreasing count.
+func (ts *titleStats) sorted() []titleCount {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	var res []titleCount
+	for title, count := range ts.counts {
+		res = append(res, titleCount{title, count})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].count != res[j].count {
+			return res[i].count > res[j].count
+		}
+		return res[i].title < res[j].title
+	})
+	return res
+}
+
+// String returns the histogram of titles ordered by decreasing count.
+func (ts *titleStats) String() string {
+	buf := new(strings.Builder)
+	for _, tc := range ts.sorted() {
+		fmt.Fprintf(buf, "%6v %v\n", tc.count, tc.title)
+	}
+	return buf.String()
+}
+
+// parseSize parses sizes like 4096, 64K, 512M or 2G.
+func parseSize(s string) (uint64, error) {
+	shift := uint(0)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return v << shift, nil
+}
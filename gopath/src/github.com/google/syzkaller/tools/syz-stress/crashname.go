@@ -0,0 +1,50 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+)
+
+var (
+	flagHash          = flag.String("hash", "sha1", "hash of crash programs used in crashdir file names: sha1, sha256 or fnv")
+	flagHashTimestamp = flag.Bool("hash-timestamp", false, "prefix crashdir file names with the crash time")
+)
+
+func checkHashFlag() error {
+	switch *flagHash {
+	case "sha1", "sha256", "fnv":
+		return nil
+	}
+	return fmt.Errorf("unknown -hash %q, want sha1, sha256 or fnv", *flagHash)
+}
+
+// crashName returns the base name of crashdir files for a crash of the given category
+// with the serialized program data.
+func crashName(category string, data []byte) string {
+	var sum string
+	switch *flagHash {
+	case "sha256":
+		h := sha256.Sum256(data)
+		sum = hex.EncodeToString(h[:])
+	case "fnv":
+		h := fnv.New64a()
+		h.Write(data)
+		sum = fmt.Sprintf("%016x", h.Sum64())
+	default:
+		sum = hash.String(data)
+	}
+	name := category + "-" + sum + "-" + runID
+	if *flagHashTimestamp {
+		name = time.Now().Format("20060102-150405") + "-" + name
+	}
+	return name
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/list"
+	"flag"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/hash"
+)
+
+var (
+	flagDedup = flag.Bool("dedup", false, "skip programs identical to recently executed ones "+
+		"(programs that crashed are always re-executed)")
+	flagDedupCache = flag.Int("dedup-cache", 100000, "number of recently executed programs remembered for dedup")
+
+	statDedupHits    uint64
+	statDedupLookups uint64
+)
+
+// Result classes of executed programs.
+const (
+	resultClean = iota
+	resultCrash
+	resultHang
+)
+
+// Number of independently locked parts of the cache, so that procs rarely contend.
+const dedupShards = 64
+
+// resultCache is an LRU cache of results of recently executed programs.
+type resultCache struct {
+	shards [dedupShards]dedupShard
+}
+
+type dedupShard struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List // of hash.Sig, most recent first
+	elems map[hash.Sig]*list.Element
+	class map[hash.Sig]int
+}
+
+var dedup *resultCache
+
+func initDedup() {
+	if !*flagDedup || *flagDedupCache <= 0 {
+		return
+	}
+	dedup = new(resultCache)
+	size := (*flagDedupCache + dedupShards - 1) / dedupShards
+	for i := range dedup.shards {
+		shard := &dedup.shards[i]
+		shard.size = size
+		shard.lru = list.New()
+		shard.elems = make(map[hash.Sig]*list.Element)
+		shard.class = make(map[hash.Sig]int)
+	}
+}
+
+func (rc *resultCache) shard(sig hash.Sig) *dedupShard {
+	return &rc.shards[int(sig[0])%dedupShards]
+}
+
+// skip returns true if a program with the signature was recently executed
+// without crashing, so there is no point in executing it again.
+func (rc *resultCache) skip(sig hash.Sig) bool {
+	atomic.AddUint64(&statDedupLookups, 1)
+	shard := rc.shard(sig)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	elem := shard.elems[sig]
+	if elem == nil || shard.class[sig] == resultCrash {
+		return false
+	}
+	shard.lru.MoveToFront(elem)
+	atomic.AddUint64(&statDedupHits, 1)
+	return true
+}
+
+// add records the result class of an executed program.
+func (rc *resultCache) add(sig hash.Sig, class int) {
+	shard := rc.shard(sig)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.class[sig] = class
+	if elem := shard.elems[sig]; elem != nil {
+		shard.lru.MoveToFront(elem)
+		return
+	}
+	shard.elems[sig] = shard.lru.PushFront(sig)
+	if shard.lru.Len() > shard.size {
+		old := shard.lru.Remove(shard.lru.Back()).(hash.Sig)
+		delete(shard.elems, old)
+		delete(shard.class, old)
+	}
+}
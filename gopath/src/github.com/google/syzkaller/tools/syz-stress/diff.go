@@ -0,0 +1,108 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagDiffOpts = flag.String("diff-opts", "", "execute every program also with the given execution option "+
+		"toggled (threaded or collide) and report calls whose errno differs")
+	flagDiffAllow = flag.String("diff-allow", "", "comma-separated syscall name patterns (glob) "+
+		"whose results are expected to differ under -diff-opts")
+	flagDiffDir = flag.String("diff-dir", "", "directory to save programs with diverging results")
+
+	statDiffExec     uint64 // programs executed with both options
+	statDiffDiverged uint64
+
+	diffFlag  ipc.ExecFlags
+	diffAllow []string
+)
+
+func initDiff() error {
+	switch *flagDiffOpts {
+	case "threaded":
+		diffFlag = ipc.FlagThreaded
+	case "collide":
+		diffFlag = ipc.FlagCollide
+	default:
+		return fmt.Errorf("unknown -diff-opts %q, want threaded or collide", *flagDiffOpts)
+	}
+	if *flagDiffAllow != "" {
+		diffAllow = strings.Split(*flagDiffAllow, ",")
+		for _, pattern := range diffAllow {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("bad -diff-allow pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	if *flagDiffDir != "" {
+		if err := osutil.MkdirAll(*flagDiffDir); err != nil {
+			return fmt.Errorf("failed to create -diff-dir: %v", err)
+		}
+	}
+	return nil
+}
+
+// diffAllowed returns whether results of syscall name are expected to differ (-diff-allow).
+func diffAllowed(name string) bool {
+	for _, pattern := range diffAllow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// diffExec executes p with the baseline options and with -diff-opts toggled
+// and reports calls with diverging results.
+func (proc *proc) diffExec(p *prog.Prog) {
+	opts := *proc.execOpts
+	opts.Flags ^= diffFlag
+	var infos [2]*ipc.ProgInfo
+	for i, opts := range []*ipc.ExecOpts{proc.execOpts, &opts} {
+		recordProg(p)
+		_, info, hanged, err := proc.env.Exec(opts, p)
+		if err != nil || hanged || info == nil {
+			return
+		}
+		infos[i] = info
+	}
+	atomic.AddUint64(&statDiffExec, 1)
+	diffs := ipc.DiffErrnos(p, infos[0], infos[1], diffAllowed)
+	if len(diffs) == 0 {
+		return
+	}
+	atomic.AddUint64(&statDiffDiverged, 1)
+	buf := new(bytes.Buffer)
+	for _, d := range diffs {
+		fmt.Fprintf(buf, "call #%v %v: errno %v, with %v: errno %v\n", d.Call, d.Name, d.Errno0,
+			*flagDiffOpts, d.Errno1)
+	}
+	data := p.Serialize()
+	log.Logf(1, "proc %v: results diverge with %v:\n%s%s", proc.pid, *flagDiffOpts, buf.Bytes(), data)
+	if *flagDiffDir == "" {
+		return
+	}
+	base := filepath.Join(*flagDiffDir, hash.String(data))
+	if err := osutil.WriteFile(base+".prog", data); err != nil {
+		log.Logf(0, "failed to save diverging program: %v", err)
+	}
+	if err := osutil.WriteFile(base+".diff", buf.Bytes()); err != nil {
+		log.Logf(0, "failed to save diverging results: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var flagDrainTimeout = flag.Duration("drain-timeout", 10*time.Second,
+	"on shutdown wait this long for in-flight executions to finish")
+
+var (
+	// draining is set when shutdown starts, no new executions are started after that.
+	draining uint32
+	// inFlight is the number of executions that have started and not finished yet.
+	inFlight int64
+	// parked is the number of procs stopped by shutdown.
+	parked int64
+	// pauseMu is held for reading by procs while they execute programs,
+	// betweenExecs takes it for writing.
+	pauseMu sync.RWMutex
+)
+
+// betweenExecs runs f while no program executes, procs wait for f to finish.
+// Executions are bounded by the executor timeout, so procs are paused only briefly.
+func betweenExecs(f func()) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	f()
+}
+
+// holdPause prevents betweenExecs until releasePause, it's called around program executions.
+// If shutdown has already started, it blocks forever.
+func holdPause() {
+	pauseMu.RLock()
+	if atomic.LoadUint32(&draining) != 0 {
+		pauseMu.RUnlock()
+		atomic.AddInt64(&parked, 1)
+		select {}
+	}
+}
+
+func releasePause() {
+	pauseMu.RUnlock()
+}
+
+// enterExec and leaveExec count executions in flight, they're called under holdPause.
+func enterExec() {
+	atomic.AddInt64(&inFlight, 1)
+}
+
+func leaveExec() {
+	atomic.AddInt64(&inFlight, -1)
+}
+
+// drain stops starting new executions and waits up to timeout for the executions
+// that are in flight to finish: once it gets through the pause gate, none is left.
+func drain(timeout time.Duration) {
+	atomic.StoreUint32(&draining, 1)
+	log.Logf(0, "shutting down, %v executions in flight", atomic.LoadInt64(&inFlight))
+	drained := make(chan struct{})
+	go betweenExecs(func() {
+		close(drained)
+	})
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+		log.Logf(0, "%v executions still in flight after %v, exiting anyway",
+			atomic.LoadInt64(&inFlight), timeout)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	for _, timeout := range []bool{false, true} {
+		testDrain(t, timeout)
+	}
+}
+
+// testDrain shuts down while one of the procs executes a blocked program.
+// If timeout is set, the program finishes only after drain times out.
+func testDrain(t *testing.T, timeout bool) {
+	const procs, blocked = 2, 5
+	executing := make(chan struct{})
+	release := make(chan struct{})
+	fe := newFakeEnvs(func(n uint64) fakeResult {
+		if n == blocked {
+			close(executing)
+			<-release
+		}
+		return fakeClean
+	})
+	ft, stop := startFakeTarget(t, fe, nil)
+	defer stop()
+	parked0 := atomic.LoadInt64(&parked)
+	for pid := 0; pid < procs; pid++ {
+		proc := newProc(ft, pid)
+		go func() {
+			for i := 0; ; i++ {
+				ft.fuzzStep(i, proc.rnd, proc.executeAndReward)
+			}
+		}()
+	}
+	<-executing
+	drainTimeout := time.Minute
+	if timeout {
+		drainTimeout = 100 * time.Millisecond
+	}
+	drained := make(chan struct{})
+	go func() {
+		drain(drainTimeout)
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		if !timeout {
+			t.Fatalf("drain returned while a program is executing")
+		}
+	case <-time.After(time.Second):
+		if timeout {
+			t.Fatalf("drain did not time out")
+		}
+	}
+	close(release)
+	<-drained
+	// All procs stop before the next execution.
+	execs := atomic.LoadUint64(&fe.execs)
+	for deadline := time.Now().Add(10 * time.Second); atomic.LoadInt64(&parked)-parked0 != procs; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v/%v procs stopped after drain", atomic.LoadInt64(&parked)-parked0, procs)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadUint64(&fe.execs); n != execs {
+		t.Fatalf("%v programs were executed after drain", n-execs)
+	}
+	if n := atomic.LoadInt64(&inFlight); n != 0 {
+		t.Fatalf("%v executions in flight after drain", n)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagPrintEnabled = flag.String("print-enabled", "",
+	"write names of the enabled syscalls to this file, one per line, and continue")
+
+// writeEnabledCalls writes the sorted names of calls into file.
+// calls is the final set used for fuzzing, i.e. after -syscalls, transitive
+// enabling and zero -call-weights are applied.
+func writeEnabledCalls(file string, calls map[*prog.Syscall]bool) error {
+	var names []string
+	for c := range calls {
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		fmt.Fprintf(buf, "%v\n", name)
+	}
+	return osutil.WriteFile(file, buf.Bytes())
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagEnumerate = flag.String("enumerate", "",
+		"execute all combinations of the given argument values of the -seedprog program and exit,\n"+
+			"e.g. \"1.2=0..64;1.3=0x1|0x2|0x4\" (see prog.ArgSpec)")
+	flagEnumerateLimit = flag.Int("enumerate-limit", 10000, "maximum number of -enumerate variants")
+)
+
+// runEnumerate executes all variants of p and reports the values that crashed.
+// It returns the exit code for Run: 1 if any variant crashed.
+func runEnumerate(ft *fuzzTarget, p *prog.Prog, spec string) int {
+	specs, err := prog.ParseArgSpecs(spec, *flagEnumerateLimit)
+	if err != nil {
+		log.Fatalf("-enumerate: %v", err)
+	}
+	next, err := prog.EnumerateArgs(p, specs, *flagEnumerateLimit)
+	if err != nil {
+		log.Fatalf("-enumerate: %v", err)
+	}
+	gate = ipc.NewGate(2, nil)
+	proc := newProc(ft, 0)
+	crashedVals := make([]map[uint64]bool, len(specs))
+	for i := range crashedVals {
+		crashedVals[i] = make(map[uint64]bool)
+	}
+	variants, crashed := 0, 0
+	for variant, vals := next(); variant != nil; variant, vals = next() {
+		variants++
+		atomic.AddUint64(&statExec, 1)
+		output, _, hanged, err := proc.env.Exec(ft.execOpts, variant)
+		if handleResult(variant, output, hanged, err) {
+			crashed++
+			fmt.Printf("crashed with values %#x\n", vals)
+			for i, v := range vals {
+				crashedVals[i][v] = true
+			}
+		}
+		if err != nil || hanged {
+			proc.recycleEnv()
+		}
+	}
+	fmt.Printf("executed %v variants, %v crashed\n", variants, crashed)
+	for i, spec := range specs {
+		var vals []string
+		for _, v := range spec.Vals {
+			if crashedVals[i][v] {
+				vals = append(vals, fmt.Sprintf("%#x", v))
+			}
+		}
+		fmt.Printf("%v: crashing values: %v\n", spec.Spec, strings.Join(vals, " "))
+	}
+	if crashed != 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const envPrefix = "SYZSTRESS_"
+
+// flagEnvName returns the name of the environment variable that provides
+// the default value for flag name, e.g. SYZSTRESS_CRASHDIR for -crashdir.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// setFlagsFromEnv sets flags from the corresponding environment variables.
+// It must be called before flag.Parse so that flags given on the command line win.
+func setFlagsFromEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		val, ok := os.LookupEnv(flagEnvName(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		if err1 := fs.Set(f.Name, val); err1 != nil {
+			err = fmt.Errorf("bad value of %v: %v", flagEnvName(f.Name), err1)
+		}
+	})
+	return err
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// executorComm returns the command name (as in /proc/PID/comm) of the executor processes of proc pid.
+// ipc runs the executor of every Env through a hard link named <executor>.<pid>,
+// so that crash reports identify the proc, and processes forked by the executor inherit the name.
+// If ipc fails to create the link, the executor runs under its own name and processes
+// of different procs can't be told apart, then nothing is found by name.
+func executorComm(executor string, pid int) string {
+	base := filepath.Base(strings.Split(executor, " ")[0])
+	suffix := fmt.Sprintf(".%v", pid)
+	// TASK_COMM_LEN is 16 including the terminating 0, ipc cuts the beginning of the name to fit.
+	const maxLen = 16
+	if len(base)+len(suffix) >= maxLen {
+		base = base[len(base)+len(suffix)-maxLen+1:]
+	}
+	return base + suffix
+}
+
+// executorProcs returns the running executor processes of the proc.
+func (proc *proc) executorProcs() []executorProc {
+	return findExecutorProcs(executorComm(proc.config.Executor, proc.pid))
+}
+
+// Namespaces (by name as in /proc/PID/ns) that are compared with those of syz-stress.
+var executorNamespaces = []string{"user", "mnt", "uts", "ipc", "net", "pid", "cgroup"}
+
+// executorProc is a process that runs an executor binary.
+type executorProc struct {
+	pid int
+	// cwd is the current working directory of the process.
+	cwd string
+	// ns is the set of namespaces (by name as in /proc/PID/ns) that differ from those of syz-stress.
+	ns map[string]bool
+}
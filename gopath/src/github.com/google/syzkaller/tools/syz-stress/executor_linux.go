@@ -0,0 +1,48 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// findExecutorProcs returns all processes with the command name comm.
+func findExecutorProcs(comm string) []executorProc {
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var res []executorProc
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/comm", pid))
+		if err != nil || strings.TrimSpace(string(data)) != comm {
+			continue
+		}
+		ep := executorProc{pid: pid, ns: make(map[string]bool)}
+		ep.cwd, _ = os.Readlink(fmt.Sprintf("/proc/%v/cwd", pid))
+		for _, ns := range executorNamespaces {
+			own, err1 := os.Readlink("/proc/self/ns/" + ns)
+			their, err2 := os.Readlink(fmt.Sprintf("/proc/%v/ns/%v", pid, ns))
+			if err1 == nil && err2 == nil && own != their {
+				ep.ns[ns] = true
+			}
+		}
+		res = append(res, ep)
+	}
+	return res
+}
+
+// executorAlive returns true if process pid is alive and has the command name comm.
+func executorAlive(pid int, comm string) bool {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/comm", pid))
+	return err == nil && strings.TrimSpace(string(data)) == comm
+}
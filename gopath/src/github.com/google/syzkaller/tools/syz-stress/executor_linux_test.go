@@ -0,0 +1,52 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindExecutorProcs(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir, err := ioutil.TempDir("", "syz-stress-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The command name of a process comes from the name it was executed with,
+	// so a link with the executor name looks like an executor of proc 7.
+	bin := filepath.Join(dir, "syz-executor.7")
+	if err := os.Symlink(sleep, bin); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(bin, "100")
+	cmd.Dir = dir
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	procs := findExecutorProcs(executorComm("/syz-executor", 7))
+	if len(procs) != 1 || procs[0].pid != cmd.Process.Pid {
+		t.Fatalf("found %+v, want pid %v", procs, cmd.Process.Pid)
+	}
+	if want, _ := filepath.EvalSymlinks(dir); procs[0].cwd != want {
+		t.Errorf("cwd %q, want %q", procs[0].cwd, want)
+	}
+	if len(procs[0].ns) != 0 {
+		t.Errorf("process runs in own namespaces %v", procs[0].ns)
+	}
+	if procs := findExecutorProcs(executorComm("/syz-executor", 8)); len(procs) != 0 {
+		t.Errorf("found executors of another proc: %+v", procs)
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+func findExecutorProcs(comm string) []executorProc {
+	return nil
+}
+
+func executorAlive(pid int, comm string) bool {
+	return false
+}
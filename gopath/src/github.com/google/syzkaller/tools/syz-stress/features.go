@@ -0,0 +1,73 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/csource"
+	"github.com/google/syzkaller/pkg/host"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagStrictFeatures = flag.Bool("strict-features", false, "treat conflicting features as a fatal error")
+
+// featureConflicts returns descriptions of enabled features that have no effect
+// with the host features and the enabled calls. The rules are:
+//   - tun/net_dev is enabled but not supported by the host (it's silently dropped);
+//   - tun is enabled but no call injects packets (syz_emit_ethernet, syz_extract_tcp_res);
+//   - net_reset is enabled but no socket calls are enabled;
+//   - cgroups is enabled but no calls use cgroup files;
+//   - binfmt_misc is enabled but no execve calls are enabled.
+func featureConflicts(featuresFlags csource.Features, features *host.Features,
+	calls map[*prog.Syscall]bool) []string {
+	enabled := func(prefixes ...string) bool {
+		for c := range calls {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(c.Name, prefix) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	var conflicts []string
+	if featuresFlags["tun"].Enabled {
+		if !features[host.FeatureNetworkInjection].Enabled {
+			conflicts = append(conflicts, fmt.Sprintf("tun is enabled, but not supported by the host: %v",
+				features[host.FeatureNetworkInjection].Reason))
+		} else if !enabled("syz_emit_ethernet", "syz_extract_tcp_res") {
+			conflicts = append(conflicts, "tun is enabled, but no packet injection calls "+
+				"(syz_emit_ethernet, syz_extract_tcp_res) are enabled")
+		}
+	}
+	if featuresFlags["net_dev"].Enabled && !features[host.FeatureNetworkDevices].Enabled {
+		conflicts = append(conflicts, fmt.Sprintf("net_dev is enabled, but not supported by the host: %v",
+			features[host.FeatureNetworkDevices].Reason))
+	}
+	if featuresFlags["net_reset"].Enabled && !enabled("socket") {
+		conflicts = append(conflicts, "net_reset is enabled, but no socket calls are enabled")
+	}
+	if featuresFlags["cgroups"].Enabled && !enabled("openat$cgroup", "mkdirat$cgroup") {
+		conflicts = append(conflicts, "cgroups is enabled, but no calls using cgroup files are enabled")
+	}
+	if featuresFlags["binfmt_misc"].Enabled && !enabled("execve", "execveat") {
+		conflicts = append(conflicts, "binfmt_misc is enabled, but no execve calls are enabled")
+	}
+	return conflicts
+}
+
+func checkFeatureConflicts(featuresFlags csource.Features, features *host.Features,
+	calls map[*prog.Syscall]bool) {
+	conflicts := featureConflicts(featuresFlags, features, calls)
+	for _, conflict := range conflicts {
+		log.Logf(0, "warning: %v", conflict)
+	}
+	if len(conflicts) != 0 && *flagStrictFeatures {
+		log.Fatalf("%v feature conflicts with -strict-features", len(conflicts))
+	}
+}
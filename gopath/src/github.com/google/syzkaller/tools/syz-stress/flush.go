@@ -0,0 +1,70 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagFlushBetween = flag.Bool("flush-between", false, "flush KASAN quarantine of slab caches after each execution")
+	flagFlushCaches  = flag.String("flush-caches", "*", "glob of slab cache names flushed by -flush-between")
+
+	statFlushes   uint64
+	statFlushNsec uint64
+
+	// flushFiles are the shrink files of slab caches flushed by -flush-between.
+	flushFiles []string
+	flushing   uint32
+)
+
+// initFlush finds slab caches to flush. Shrinking a slab cache also drains
+// KASAN quarantine for the cache, so freed objects are actually reused
+// by the following programs. This requires SLUB with sysfs.
+func initFlush() error {
+	files, err := filepath.Glob(filepath.Join("/sys/kernel/slab", *flagFlushCaches, "shrink"))
+	if err != nil {
+		return fmt.Errorf("bad -flush-caches: %v", err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("-flush-between: no slab caches match %q in /sys/kernel/slab", *flagFlushCaches)
+	}
+	flushFiles = files
+	log.Logf(0, "flushing %v slab caches after each execution", len(files))
+	return nil
+}
+
+// flushQuarantine shrinks the slab caches. Flushes are global, so if another proc
+// is already flushing, it's not repeated.
+func flushQuarantine() {
+	if !atomic.CompareAndSwapUint32(&flushing, 0, 1) {
+		return
+	}
+	defer atomic.StoreUint32(&flushing, 0)
+	start := time.Now()
+	for _, file := range flushFiles {
+		if err := ioutil.WriteFile(file, []byte("1"), 0); err != nil {
+			log.Logf(1, "failed to shrink %v: %v", file, err)
+		}
+	}
+	atomic.AddUint64(&statFlushes, 1)
+	atomic.AddUint64(&statFlushNsec, uint64(time.Since(start)))
+}
+
+// flushOverhead returns the total time spent flushing and the average time per flush.
+func flushOverhead() (total, avg time.Duration) {
+	n := atomic.LoadUint64(&statFlushes)
+	total = time.Duration(atomic.LoadUint64(&statFlushNsec))
+	if n != 0 {
+		avg = total / time.Duration(n)
+	}
+	return
+}
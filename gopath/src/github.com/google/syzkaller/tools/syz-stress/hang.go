@@ -0,0 +1,41 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagHangRetries = flag.Int("hang-retries", 0, "re-execute a hanged program this many times "+
+		"and report the hang only if it hangs every time")
+
+	statTransientHangs uint64
+)
+
+// confirmHang re-executes p that hanged and returns true if it hangs on every retry.
+// A retry that fails to execute stops the retries: the hang is not confirmed
+// and the execution error is returned.
+func (proc *proc) confirmHang(p *prog.Prog) (bool, error) {
+	for i := 0; i < *flagHangRetries; i++ {
+		// Every retry may take the whole executor timeout, the watchdog must not consider the proc stuck.
+		proc.beat()
+		recordProg(p)
+		_, _, hanged, err := proc.env.Exec(proc.execOpts, p)
+		if err != nil {
+			return false, err
+		}
+		if !hanged {
+			atomic.AddUint64(&statTransientHangs, 1)
+			log.Logf(1, "proc %v: hang did not reproduce on retry %v, not reporting it:\n%s",
+				proc.pid, i+1, p.Serialize())
+			return false, nil
+		}
+	}
+	return true, nil
+}
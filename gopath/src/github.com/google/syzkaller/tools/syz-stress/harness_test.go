@@ -0,0 +1,547 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/csource"
+	"github.com/google/syzkaller/pkg/host"
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/prog"
+)
+
+// fakeResult is a scripted result of a single execution.
+type fakeResult int
+
+const (
+	fakeClean fakeResult = iota
+	fakeHang
+	fakeCrash
+	fakeBrokenPipe // the executor died, writes to it fail with EPIPE
+	fakeStuck      // the execution does not finish until the worker watchdog fires
+	fakeKilled     // the executor is killed, this and all later executions on the Env fail with EPIPE
+	numFakeResults
+)
+
+const fakeCrashOutput = "BUG: KASAN: slab-out-of-bounds in foo+0x12/0x40\n" +
+	"Write of size 8 at addr ffff88806a0c8a18 by task syz-executor.0/7011\n"
+
+// Executor binary name used by tests, procs look for executor processes by it
+// and must not find any.
+const fakeExecutorBin = "syz-stress-test-fake"
+
+// fakeEnvs creates fake execution environments that return scripted results.
+type fakeEnvs struct {
+	// script returns the result of the n-th execution (starting from 1) over all environments.
+	script func(n uint64) fakeResult
+	// check, if set, returns whether the executor accepts p, rejected programs count as errors.
+	check func(p *prog.Prog) bool
+
+	execs   uint64
+	results [numFakeResults]uint64
+	made    uint64
+	closed  uint64
+	// errors counts misuses of environments, e.g. Exec after Close.
+	errors uint64
+	// done is closed at the end of a test, executions block forever after that,
+	// so that procs left running by the test stop.
+	done chan struct{}
+}
+
+func newFakeEnvs(script func(n uint64) fakeResult) *fakeEnvs {
+	return &fakeEnvs{
+		script: script,
+		done:   make(chan struct{}),
+	}
+}
+
+func (fe *fakeEnvs) makeEnv(config *ipc.Config, pid int) (executor, error) {
+	atomic.AddUint64(&fe.made, 1)
+	return &fakeEnv{fe: fe}, nil
+}
+
+type fakeEnv struct {
+	fe     *fakeEnvs
+	inExec uint32
+	closed uint32
+	killed bool
+}
+
+func (env *fakeEnv) Exec(opts *ipc.ExecOpts, p *prog.Prog) (output []byte, info *ipc.ProgInfo,
+	hanged bool, err error) {
+	fe := env.fe
+	select {
+	case <-fe.done:
+		select {}
+	default:
+	}
+	if atomic.LoadUint32(&env.closed) != 0 || !atomic.CompareAndSwapUint32(&env.inExec, 0, 1) {
+		atomic.AddUint64(&fe.errors, 1)
+	}
+	defer atomic.StoreUint32(&env.inExec, 0)
+	if fe.check != nil && !fe.check(p) {
+		atomic.AddUint64(&fe.errors, 1)
+	}
+	if env.killed {
+		// The proc must replace an Env with a dead executor.
+		atomic.AddUint64(&fe.errors, 1)
+		return nil, nil, false, fmt.Errorf("failed to write control pipe: %v", syscall.EPIPE)
+	}
+	n := atomic.AddUint64(&fe.execs, 1)
+	res := fe.script(n)
+	atomic.AddUint64(&fe.results[res], 1)
+	info = &ipc.ProgInfo{Calls: make([]ipc.CallInfo, len(p.Calls))}
+	for i := range info.Calls {
+		info.Calls[i].Flags = ipc.CallExecuted | ipc.CallFinished
+		info.Calls[i].Signal = []uint32{uint32(n)<<4 | uint32(i)}
+	}
+	switch res {
+	case fakeHang:
+		hanged = true
+	case fakeCrash:
+		output = []byte(fakeCrashOutput)
+	case fakeKilled:
+		env.killed = true
+		fallthrough
+	case fakeBrokenPipe:
+		info = nil
+		err = fmt.Errorf("failed to write control pipe: %v", syscall.EPIPE)
+	case fakeStuck:
+		// The watchdog can't find the fake executor process to kill,
+		// so the execution finishes once the watchdog has noticed it.
+		stuck := atomic.LoadUint64(&statStuck)
+		for deadline := time.Now().Add(10 * time.Second); atomic.LoadUint64(&statStuck) == stuck &&
+			time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return
+}
+
+func (env *fakeEnv) Close() error {
+	if !atomic.CompareAndSwapUint32(&env.closed, 0, 1) || atomic.LoadUint32(&env.inExec) != 0 {
+		atomic.AddUint64(&env.fe.errors, 1)
+	}
+	atomic.AddUint64(&env.fe.closed, 1)
+	return nil
+}
+
+// setFlags sets command line flags, the returned function restores them.
+func setFlags(t *testing.T, flags map[string]string) func() {
+	old := make(map[string]string)
+	for name, val := range flags {
+		f := flag.Lookup(name)
+		if f == nil {
+			t.Fatalf("unknown flag -%v", name)
+		}
+		old[name] = f.Value.String()
+		if err := f.Value.Set(val); err != nil {
+			t.Fatalf("bad value for -%v: %v", name, err)
+		}
+	}
+	return func() {
+		for name, val := range old {
+			flag.Set(name, val)
+		}
+	}
+}
+
+// testFlags are flags every harness test uses: the test target, so that the host is not probed
+// for supported syscalls, and coverage so that executions produce signal.
+var testFlags = map[string]string{
+	"os":    "test",
+	"arch":  "64",
+	"cover": "true",
+}
+
+// resetRunState resets the global state that a run leaves behind (stop conditions, shutdown,
+// registered workers), so that tests can run in any order and more than once.
+// Procs of earlier runs stay parked or blocked in the fake executor and don't see the reset.
+func resetRunState() {
+	stopped = make(chan struct{})
+	stopOnce = sync.Once{}
+	stopReason = ""
+	atomic.StoreUint32(&draining, 0)
+	atomic.StoreInt64(&lastNewSignal, time.Now().UnixNano())
+	workersMu.Lock()
+	workers = nil
+	workersMu.Unlock()
+}
+
+// startFakeTarget sets up a fuzz target for the test target that executes programs with fe.
+// The returned function stops procs started for the target.
+func startFakeTarget(t *testing.T, fe *fakeEnvs, flags map[string]string) (*fuzzTarget, func()) {
+	resetRunState()
+	all := make(map[string]string)
+	for name, val := range testFlags {
+		all[name] = val
+	}
+	for name, val := range flags {
+		all[name] = val
+	}
+	restoreFlags := setFlags(t, all)
+	target, err := prog.GetTarget(*flagOS, *flagArch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	featuresFlags, err := csource.ParseFeaturesFlags("none", "none", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ft := setupTarget(target, nil, featuresFlags, new(host.Features))
+	ft.config.Executor = fakeExecutorBin
+	makeEnv = fe.makeEnv
+	gate = ipc.NewGate(64, nil)
+	return ft, func() {
+		close(fe.done)
+		resetRunState()
+		restoreFlags()
+	}
+}
+
+// fuzzCounters are global stats that the harness tests check.
+type fuzzCounters struct {
+	execs, hangs, execErrors, stuck uint64
+	crashes                         int
+}
+
+func loadFuzzCounters() fuzzCounters {
+	return fuzzCounters{
+		execs:      atomic.LoadUint64(&statExec),
+		hangs:      atomic.LoadUint64(&statHangs),
+		execErrors: atomic.LoadUint64(&statExecErrors),
+		stuck:      atomic.LoadUint64(&statStuck),
+		crashes:    crashes.total(),
+	}
+}
+
+func (c fuzzCounters) sub(c0 fuzzCounters) fuzzCounters {
+	return fuzzCounters{
+		execs:      c.execs - c0.execs,
+		hangs:      c.hangs - c0.hangs,
+		execErrors: c.execErrors - c0.execErrors,
+		stuck:      c.stuck - c0.stuck,
+		crashes:    c.crashes - c0.crashes,
+	}
+}
+
+// cycleScript returns every result in turn, and clean results in between.
+func cycleScript(n uint64) fakeResult {
+	switch n % 8 {
+	case 3:
+		return fakeCrash
+	case 5:
+		return fakeHang
+	case 7:
+		return fakeBrokenPipe
+	}
+	return fakeClean
+}
+
+func TestFuzzStep(t *testing.T) {
+	fe := newFakeEnvs(cycleScript)
+	ft, stop := startFakeTarget(t, fe, nil)
+	defer stop()
+	before := loadFuzzCounters()
+	proc := newProc(ft, 0)
+	for i := 0; i < 100; i++ {
+		ft.fuzzStep(i, proc.rnd, proc.executeAndReward)
+	}
+	got := loadFuzzCounters().sub(before)
+	execs := atomic.LoadUint64(&fe.execs)
+	if execs == 0 {
+		t.Fatalf("no programs were executed")
+	}
+	broken := fe.results[fakeBrokenPipe]
+	want := fuzzCounters{
+		execs:      execs,
+		hangs:      fe.results[fakeHang],
+		execErrors: broken,
+		crashes:    int(fe.results[fakeCrash] + fe.results[fakeHang] + broken),
+	}
+	if got != want {
+		t.Errorf("got counters %+v, want %+v", got, want)
+	}
+	if atomic.LoadUint64(&proc.execs) != execs {
+		t.Errorf("proc executed %v programs, the executor %v", proc.execs, execs)
+	}
+	// Every broken pipe replaces the Env with a fresh one, other results don't.
+	if fe.made != 1+broken || fe.closed != broken {
+		t.Errorf("%v broken pipes: made %v envs, closed %v", broken, fe.made, fe.closed)
+	}
+	if fe.errors != 0 {
+		t.Errorf("%v misuses of execution environments", fe.errors)
+	}
+	signalMu.Lock()
+	signal := len(maxSignal)
+	signalMu.Unlock()
+	if signal == 0 {
+		t.Errorf("no signal was accounted")
+	}
+}
+
+// TestProcsRace runs procs concurrently with the worker watchdog and Env recycling.
+// It's meant to be run with -race.
+func TestProcsRace(t *testing.T) {
+	const procs, steps = 4, 50
+	var stuckOnce uint32
+	fe := newFakeEnvs(func(n uint64) fakeResult {
+		if n > 20 && atomic.CompareAndSwapUint32(&stuckOnce, 0, 1) {
+			return fakeStuck
+		}
+		return cycleScript(n)
+	})
+	dir, err := ioutil.TempDir("", "syz-stress-harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The watchdog saves goroutines of stuck procs into crashdir.
+	ft, stop := startFakeTarget(t, fe, map[string]string{"crashdir": dir})
+	defer stop()
+	before := loadFuzzCounters()
+	currentProgs = make([]atomic.Value, procs)
+	startWorkerWatchdog(procs, 100*time.Millisecond)
+	done := make(chan bool)
+	statsDone := make(chan bool)
+	go func() {
+		defer close(statsDone)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				statsLine()
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for pid := 0; pid < procs; pid++ {
+		proc := newProc(ft, pid)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < steps; i++ {
+				ft.fuzzStep(i, proc.rnd, proc.executeAndReward)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-statsDone
+	got := loadFuzzCounters().sub(before)
+	if got.execs != fe.execs {
+		t.Errorf("counted %v executions, the executor did %v", got.execs, fe.execs)
+	}
+	if got.stuck != 1 || fe.results[fakeStuck] != 1 {
+		t.Fatalf("%v stuck procs, %v stuck executions", got.stuck, fe.results[fakeStuck])
+	}
+	// A stuck proc and every broken pipe replace the Env.
+	if recycled := fe.results[fakeBrokenPipe] + 1; fe.made != procs+recycled || fe.closed != recycled {
+		t.Errorf("%v recycles: made %v envs, closed %v", recycled, fe.made, fe.closed)
+	}
+	if n := atomic.LoadUint64(&fe.errors); n != 0 {
+		t.Errorf("%v misuses of execution environments", n)
+	}
+}
+
+// TestKilledExecutor checks that a proc replaces the Env of a killed executor
+// and continues fuzzing with the new one.
+func TestKilledExecutor(t *testing.T) {
+	fe := newFakeEnvs(func(n uint64) fakeResult {
+		if n == 3 || n == 10 {
+			return fakeKilled
+		}
+		return fakeClean
+	})
+	ft, stop := startFakeTarget(t, fe, nil)
+	defer stop()
+	before := loadFuzzCounters()
+	proc := newProc(ft, 0)
+	for i := 0; fe.execs < 20; i++ {
+		ft.fuzzStep(i, proc.rnd, proc.executeAndReward)
+	}
+	got := loadFuzzCounters().sub(before)
+	if got.execErrors != 2 || got.execs != fe.execs {
+		t.Errorf("got counters %+v after %v executions", got, fe.execs)
+	}
+	if fe.made != 3 || fe.closed != 2 {
+		t.Errorf("2 killed executors: made %v envs, closed %v", fe.made, fe.closed)
+	}
+	if fe.errors != 0 {
+		t.Errorf("%v executions on a killed executor or other misuses", fe.errors)
+	}
+}
+
+// TestCorpusRegression checks that a regression run executes every corpus program once
+// and fails only if some of them crash.
+func TestCorpusRegression(t *testing.T) {
+	for _, test := range []struct {
+		script func(n uint64) fakeResult
+		status int
+	}{
+		{func(n uint64) fakeResult { return fakeClean }, 0},
+		{func(n uint64) fakeResult {
+			if n == 2 {
+				return fakeCrash
+			}
+			return fakeClean
+		}, 1},
+	} {
+		fe := newFakeEnvs(test.script)
+		ft, stop := startFakeTarget(t, fe, map[string]string{"quiet": "true"})
+		rs := rand.NewSource(0)
+		for i := 0; i < 5; i++ {
+			ft.corpus = append(ft.corpus, ft.target.Generate(rs, 3, ft.target.DefaultChoiceTable()))
+		}
+		status := runCorpusRegression(ft)
+		stop()
+		if status != test.status {
+			t.Errorf("exit status %v, want %v", status, test.status)
+		}
+		if fe.execs != uint64(len(ft.corpus)) {
+			t.Errorf("executed %v programs, corpus has %v", fe.execs, len(ft.corpus))
+		}
+	}
+}
+
+// TestHangRetries checks that hangs are reported only if every retry hangs,
+// and that a retry that fails to execute is an execution error rather than a hang.
+func TestHangRetries(t *testing.T) {
+	for _, test := range []struct {
+		script     []fakeResult
+		hangs      uint64
+		execErrors uint64
+		transient  uint64
+	}{
+		{[]fakeResult{fakeHang, fakeHang, fakeHang}, 1, 0, 0},
+		{[]fakeResult{fakeHang, fakeHang, fakeClean}, 0, 0, 1},
+		{[]fakeResult{fakeHang, fakeBrokenPipe}, 0, 1, 0},
+	} {
+		var proc *proc
+		var heartbeats []int64
+		script := test.script
+		fe := newFakeEnvs(func(n uint64) fakeResult {
+			heartbeats = append(heartbeats, atomic.LoadInt64(&proc.heartbeat))
+			return script[n-1]
+		})
+		ft, stop := startFakeTarget(t, fe, map[string]string{"hang-retries": "2"})
+		before := loadFuzzCounters()
+		transient := atomic.LoadUint64(&statTransientHangs)
+		proc = newProc(ft, 0)
+		proc.execute(ft.target.Generate(rand.NewSource(0), 3, ft.target.DefaultChoiceTable()))
+		stop()
+		got := loadFuzzCounters().sub(before)
+		if got.hangs != test.hangs || got.execErrors != test.execErrors ||
+			atomic.LoadUint64(&statTransientHangs)-transient != test.transient {
+			t.Errorf("script %v: got counters %+v, %v transient hangs", script, got,
+				atomic.LoadUint64(&statTransientHangs)-transient)
+		}
+		if fe.execs != uint64(len(script)) {
+			t.Errorf("script %v: executed %v times", script, fe.execs)
+		}
+		for i := 1; i < len(heartbeats); i++ {
+			if heartbeats[i] <= heartbeats[i-1] {
+				t.Errorf("script %v: no heartbeat before retry %v", script, i)
+			}
+		}
+	}
+}
+
+func TestIsBrokenPipe(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	r.Close()
+	// Go ignores SIGPIPE for pipes other than stdout/stderr, the write fails with EPIPE.
+	_, err = w.Write([]byte("x"))
+	if !isBrokenPipe(err) {
+		t.Errorf("write to a closed pipe: %v is not a broken pipe", err)
+	}
+	for _, err := range []error{nil, fmt.Errorf("executor 0 failed 11 times: exit status 67")} {
+		if isBrokenPipe(err) {
+			t.Errorf("%v is a broken pipe", err)
+		}
+	}
+}
+
+// TestRun runs syz-stress end to end until it's stopped after a few crashes.
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syz-stress-harness")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fe := newFakeEnvs(cycleScript)
+	// Crashes of the previous tests are counted too.
+	before := loadFuzzCounters()
+	_, stop := startFakeTarget(t, fe, map[string]string{
+		"procs":              "4",
+		"crashdir":           dir,
+		"stop-after-crashes": fmt.Sprint(before.crashes + 10),
+		"drain-timeout":      "10s",
+		"quiet":              "true",
+	})
+	defer stop()
+	parked0 := atomic.LoadInt64(&parked)
+	var corpusTarget *prog.Target
+	status := Run(&RunConfig{
+		MakeEnv: fe.makeEnv,
+		SetupHost: func(target *prog.Target) (*host.Features, error) {
+			return new(host.Features), nil
+		},
+		LoadCorpus: func(target *prog.Target) []*prog.Prog {
+			corpusTarget = target
+			return nil
+		},
+		Shutdown: make(chan struct{}),
+	})
+	if status != exitStopCondition {
+		t.Fatalf("exit status %v, want %v (stopped by %q)", status, exitStopCondition, stopReason)
+	}
+	if corpusTarget == nil || corpusTarget.OS != "test" {
+		t.Fatalf("corpus was not loaded for the test target")
+	}
+	got := loadFuzzCounters().sub(before)
+	if execs := atomic.LoadUint64(&fe.execs); got.crashes < 10 || got.execs == 0 || got.execs > execs {
+		t.Fatalf("bad counters %+v after %v executions", got, execs)
+	}
+	titles := readRunIndex(dir, func(msg string, args ...interface{}) {
+		t.Errorf("bad crash index: "+msg, args...)
+	})
+	if len(titles) == 0 {
+		t.Fatalf("no crashes in the crash index")
+	}
+	for title, hashes := range titles {
+		for hash := range hashes {
+			matches, err := filepath.Glob(filepath.Join(dir, "*"+hash+"*.prog"))
+			if err != nil || len(matches) == 0 {
+				t.Errorf("%v: no program saved for %v", title, hash)
+			}
+		}
+	}
+	if n := atomic.LoadUint64(&fe.errors); n != 0 {
+		t.Errorf("%v misuses of execution environments", n)
+	}
+	for deadline := time.Now().Add(10 * time.Second); atomic.LoadInt64(&parked)-parked0 != 4; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%v/4 procs stopped after Run", atomic.LoadInt64(&parked)-parked0)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
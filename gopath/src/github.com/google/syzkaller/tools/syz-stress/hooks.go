@@ -0,0 +1,134 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagPreCmd = flag.String("pre-cmd", "", "shell command to run before each execution (gets the program on stdin),"+
+		" with the namespace sandbox it runs in the namespaces of the executor (requires nsenter)")
+	flagPostCmd      = flag.String("post-cmd", "", "same as -pre-cmd, but runs after each execution")
+	flagHookTimeout  = flag.Duration("hook-timeout", 10*time.Second, "timeout for -pre-cmd/-post-cmd")
+	flagHookFailures = flag.Int("hook-failures", 10, "pause a proc after this many consecutive hook failures")
+	flagHookPause    = flag.Duration("hook-pause", time.Minute, "how long to pause a proc after repeated hook failures")
+
+	statHookFail uint64
+	// hookHostNSWarned is set once a hook ran outside of the executor namespaces.
+	hookHostNSWarned uint32
+)
+
+func checkHooks(config *ipc.Config) error {
+	if *flagPreCmd == "" && *flagPostCmd == "" || config.Flags&ipc.FlagSandboxNamespace == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath("nsenter"); err != nil {
+		return fmt.Errorf("-pre-cmd/-post-cmd with the namespace sandbox require nsenter: %v", err)
+	}
+	return nil
+}
+
+// runHook runs command with the serialized program on stdin and counts consecutive failures.
+// It does not block on failures, the proc backs off in hookBackoff between fuzzing steps.
+func (proc *proc) runHook(command string, p *prog.Prog) {
+	if command == "" {
+		return
+	}
+	cmd := proc.hookCommand(command)
+	cmd.Stdin = bytes.NewReader(p.Serialize())
+	cmd.Env = append(os.Environ(), fmt.Sprintf("SYZ_STRESS_PID=%v", proc.pid))
+	if _, err := osutil.Run(*flagHookTimeout, cmd); err != nil {
+		atomic.AddUint64(&statHookFail, 1)
+		proc.hookFailures++
+		log.Logf(1, "proc %v: hook %q failed: %v", proc.pid, command, err)
+		return
+	}
+	proc.hookFailures = 0
+}
+
+// hooksFailing returns true if hooks failed too many times in a row,
+// the proc must not execute programs until it backs off.
+func (proc *proc) hooksFailing() bool {
+	return *flagHookFailures > 0 && proc.hookFailures >= *flagHookFailures
+}
+
+// hookBackoff pauses the proc after too many consecutive hook failures. It's called between
+// fuzzing steps, when the proc does not hold the exec gates and is not watched by the watchdog.
+func (proc *proc) hookBackoff() {
+	if !proc.hooksFailing() {
+		return
+	}
+	log.Logf(0, "proc %v: %v consecutive hook failures, pausing for %v",
+		proc.pid, proc.hookFailures, *flagHookPause)
+	time.Sleep(*flagHookPause)
+	proc.hookFailures = 0
+}
+
+// hookCommand returns the command that runs the hook. With the namespace sandbox, the hook
+// runs in the namespaces of the executor of the proc, which it enters with nsenter(1).
+// Hooks that run before the first execution, when the executor has not created its
+// namespaces yet, run in the namespaces of syz-stress.
+func (proc *proc) hookCommand(command string) *exec.Cmd {
+	if proc.config.Flags&ipc.FlagSandboxNamespace != 0 {
+		if ep := proc.sandboxExecutor(); ep != nil {
+			return exec.Command("nsenter", append(nsenterArgs(ep), "sh", "-c", command)...)
+		}
+		if atomic.CompareAndSwapUint32(&hookHostNSWarned, 0, 1) {
+			log.Logf(0, "proc %v: executor namespaces not found, running hooks in the namespaces of syz-stress",
+				proc.pid)
+		}
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// sandboxExecutor returns the sandboxed executor process of the proc. The process is cached
+// while it's alive, so that /proc is not scanned for every hook.
+func (proc *proc) sandboxExecutor() *executorProc {
+	if ep := proc.hookExecutor; ep != nil && executorAlive(ep.pid, executorComm(proc.config.Executor, proc.pid)) {
+		return ep
+	}
+	proc.hookExecutor = sandboxProc(proc.executorProcs())
+	return proc.hookExecutor
+}
+
+// sandboxProc returns the executor process in the largest number of own namespaces,
+// i.e. the one that runs programs inside the sandbox, or nil if none is sandboxed.
+func sandboxProc(procs []executorProc) *executorProc {
+	var best *executorProc
+	for i := range procs {
+		ep := &procs[i]
+		if len(ep.ns) != 0 && (best == nil || len(ep.ns) > len(best.ns) ||
+			len(ep.ns) == len(best.ns) && ep.pid < best.pid) {
+			best = ep
+		}
+	}
+	return best
+}
+
+// nsenterArgs returns nsenter arguments that enter the namespaces of ep that differ from ours.
+// The namespaces we share can't be entered: setns fails for the current user namespace.
+func nsenterArgs(ep *executorProc) []string {
+	args := []string{"--target", fmt.Sprint(ep.pid)}
+	for _, ns := range executorNamespaces {
+		if ep.ns[ns] {
+			if ns == "mnt" {
+				ns = "mount"
+			}
+			args = append(args, "--"+ns)
+		}
+	}
+	return args
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/prog"
+)
+
+func TestExecutorComm(t *testing.T) {
+	tests := []struct {
+		executor string
+		pid      int
+		want     string
+	}{
+		{"/syz-executor", 3, "syz-executor.3"},
+		{"./bin/linux_amd64/syz-executor", 12, "syz-executor.12"},
+		{"syz-executor", 123, "yz-executor.123"},
+		{"qemu-mipsel /syz-executor", 1, "qemu-mipsel.1"},
+	}
+	for _, test := range tests {
+		if got := executorComm(test.executor, test.pid); got != test.want {
+			t.Errorf("executorComm(%q, %v) = %q, want %q", test.executor, test.pid, got, test.want)
+		}
+	}
+}
+
+func TestHookNamespaces(t *testing.T) {
+	ns := func(names ...string) map[string]bool {
+		res := make(map[string]bool)
+		for _, name := range names {
+			res[name] = true
+		}
+		return res
+	}
+	procs := []executorProc{
+		// The executor itself runs in the namespaces of syz-stress.
+		{pid: 100, ns: ns()},
+		// The sandbox process and a program it forked.
+		{pid: 102, ns: ns("user", "mnt", "ipc", "net", "pid")},
+		{pid: 101, ns: ns("user", "mnt", "ipc", "net", "pid")},
+		{pid: 103, ns: ns("user")},
+	}
+	ep := sandboxProc(procs)
+	if ep == nil || ep.pid != 101 {
+		t.Fatalf("sandboxProc returned %+v, want pid 101", ep)
+	}
+	want := []string{"--target", "101", "--user", "--mount", "--ipc", "--net", "--pid"}
+	if got := nsenterArgs(ep); !reflect.DeepEqual(got, want) {
+		t.Fatalf("nsenterArgs: got %q, want %q", got, want)
+	}
+	if ep := sandboxProc(procs[:1]); ep != nil {
+		t.Fatalf("sandboxProc returned %+v for an executor without own namespaces", ep)
+	}
+}
+
+// Hook failures must not block the proc inside of the execution,
+// it backs off between fuzzing steps.
+func TestHookFailures(t *testing.T) {
+	defer func(failures int, pause time.Duration) {
+		*flagHookFailures, *flagHookPause = failures, pause
+	}(*flagHookFailures, *flagHookPause)
+	*flagHookFailures = 2
+	*flagHookPause = time.Hour
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &prog.Prog{Target: target}
+	proc := &proc{fuzzTarget: &fuzzTarget{config: &ipc.Config{}}, pid: 1}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		proc.runHook("false", p)
+	}
+	if time.Since(start) > time.Minute {
+		t.Fatalf("runHook paused the proc")
+	}
+	if !proc.hooksFailing() {
+		t.Fatalf("3 failures with -hook-failures=2 are not reported")
+	}
+	*flagHookPause = time.Millisecond
+	proc.hookBackoff()
+	if proc.hooksFailing() || proc.hookFailures != 0 {
+		t.Fatalf("failures are not reset after the pause: %v", proc.hookFailures)
+	}
+	proc.runHook("false", p)
+	proc.runHook("true", p)
+	if proc.hookFailures != 0 {
+		t.Fatalf("failures are not reset after a successful hook: %v", proc.hookFailures)
+	}
+}
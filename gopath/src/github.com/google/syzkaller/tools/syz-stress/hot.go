@@ -0,0 +1,60 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagHotArgs = flag.Float64("hot-args", 0, "probability to re-execute a program collecting comparisons "+
+		"and mutate arguments compared by the kernel (hot arguments)")
+
+	statHotMutations uint64
+	statHotSignal    uint64
+	statHotCrashes   uint64
+)
+
+// Max number of hot argument mutants executed per probed program.
+const maxHotMutants = 8
+
+// callComps returns comparisons collected for each call of a program.
+func callComps(info *ipc.ProgInfo) []prog.CompMap {
+	comps := make([]prog.CompMap, len(info.Calls))
+	for i, inf := range info.Calls {
+		comps[i] = inf.Comps
+	}
+	return comps
+}
+
+// probeHotArgs executes p collecting comparisons and then executes a few mutants of p
+// where a hot argument is replaced with a value the kernel compared it with.
+func (proc *proc) probeHotArgs(p *prog.Prog) {
+	opts := *proc.execOpts
+	opts.Flags |= ipc.FlagCollectComps
+	recordProg(p)
+	_, info, hanged, err := proc.env.Exec(&opts, p)
+	if err != nil || hanged || info == nil {
+		return
+	}
+	comps := callComps(info)
+	n := len(p.HotArgs(comps))
+	if n > maxHotMutants {
+		n = maxHotMutants
+	}
+	for i := 0; i < n; i++ {
+		mutant := p.Clone()
+		mutant.MutateHotArg(proc.rnd, comps)
+		atomic.AddUint64(&statHotMutations, 1)
+		newSignal := proc.execute(mutant)
+		atomic.AddUint64(&statHotSignal, uint64(newSignal))
+		if proc.lastCrashed {
+			atomic.AddUint64(&statHotCrashes, 1)
+		}
+	}
+}
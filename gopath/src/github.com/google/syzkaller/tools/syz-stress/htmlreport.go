@@ -0,0 +1,282 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var flagReport = flag.String("report", "", "write a self-contained HTML report of the run into this file on exit")
+
+var (
+	startTime = time.Now()
+
+	samplesMu sync.Mutex
+	samples   []statsSample
+
+	artifactsMu sync.Mutex
+	// lastArtifacts holds the name of the last artifact saved for every title.
+	lastArtifacts = make(map[string]string)
+)
+
+// Tables longer than this are truncated in the report, full versions go to sibling CSV files.
+const maxReportRows = 200
+
+type statsSample struct {
+	Time   time.Time
+	Exec   uint64
+	Signal int
+}
+
+func recordSample() {
+	s := statsSample{
+		Time:   time.Now(),
+		Exec:   atomic.LoadUint64(&statExec),
+		Signal: signalSize(),
+	}
+	samplesMu.Lock()
+	samples = append(samples, s)
+	samplesMu.Unlock()
+}
+
+func recordArtifact(title, name string) {
+	artifactsMu.Lock()
+	lastArtifacts[title] = name
+	artifactsMu.Unlock()
+}
+
+type reportData struct {
+	Start       time.Time
+	Duration    time.Duration
+	Command     string
+	Targets     string
+	Procs       int
+	Exec        uint64
+	Signal      int
+	ExecRate    svgChart
+	Signals     svgChart
+	Crashes     []crashRow
+	CrashesCSV  string
+	Syscalls    []syscallRow
+	SyscallsCSV string
+}
+
+type crashRow struct {
+	Title string
+	Count int
+	Link  string
+}
+
+type syscallRow struct {
+	Name   string
+	Exec   uint64
+	Signal uint64
+}
+
+type svgChart struct {
+	Points string
+	Max    float64
+}
+
+const (
+	chartWidth  = 600
+	chartHeight = 200
+)
+
+func makeChart(vals []float64) svgChart {
+	chart := svgChart{}
+	for _, v := range vals {
+		if chart.Max < v {
+			chart.Max = v
+		}
+	}
+	var points []string
+	for i, v := range vals {
+		x := float64(chartWidth)
+		if len(vals) > 1 {
+			x = float64(i) * chartWidth / float64(len(vals)-1)
+		}
+		y := float64(chartHeight)
+		if chart.Max != 0 {
+			y -= v / chart.Max * chartHeight
+		}
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	chart.Points = strings.Join(points, " ")
+	return chart
+}
+
+func writeReport(file string, targets []*fuzzTarget) error {
+	data := &reportData{
+		Start:    startTime,
+		Duration: time.Since(startTime).Round(time.Second),
+		Command:  strings.Join(os.Args, " "),
+		Procs:    numExecProcs() * len(targets),
+		Exec:     atomic.LoadUint64(&statExec),
+		Signal:   signalSize(),
+	}
+	var names []string
+	for _, ft := range targets {
+		names = append(names, ft.target.OS+"/"+ft.target.Arch)
+	}
+	data.Targets = strings.Join(names, ", ")
+
+	samplesMu.Lock()
+	var rates, signals []float64
+	for i, s := range samples {
+		signals = append(signals, float64(s.Signal))
+		if i != 0 {
+			prev := samples[i-1]
+			rates = append(rates, float64(s.Exec-prev.Exec)/s.Time.Sub(prev.Time).Seconds())
+		}
+	}
+	samplesMu.Unlock()
+	data.ExecRate = makeChart(rates)
+	data.Signals = makeChart(signals)
+
+	base := strings.TrimSuffix(file, filepath.Ext(file))
+	artifactsMu.Lock()
+	var crashRows []crashRow
+	for _, tc := range crashes.sorted() {
+		row := crashRow{Title: tc.title, Count: tc.count}
+		if name := lastArtifacts[tc.title]; name != "" {
+			row.Link = reportLink(file, filepath.Join(*flagCrashdir, name+".prog"+artifactSuffix()))
+		}
+		crashRows = append(crashRows, row)
+	}
+	artifactsMu.Unlock()
+	data.Crashes = crashRows
+	if len(crashRows) > maxReportRows {
+		data.Crashes = crashRows[:maxReportRows]
+		data.CrashesCSV = base + "-crashes.csv"
+		records := [][]string{{"title", "count"}}
+		for _, row := range crashRows {
+			records = append(records, []string{row.Title, fmt.Sprint(row.Count)})
+		}
+		if err := writeCSV(data.CrashesCSV, records); err != nil {
+			return err
+		}
+	}
+
+	var syscallRows []syscallRow
+	for _, ft := range targets {
+		for id, c := range ft.target.Syscalls {
+			exec := atomic.LoadUint64(&ft.callExecs[id])
+			if exec == 0 {
+				continue
+			}
+			name := c.Name
+			if len(targets) > 1 {
+				name = ft.target.Arch + ":" + name
+			}
+			syscallRows = append(syscallRows, syscallRow{
+				Name:   name,
+				Exec:   exec,
+				Signal: atomic.LoadUint64(&ft.callSignal[id]),
+			})
+		}
+	}
+	sort.Slice(syscallRows, func(i, j int) bool {
+		if syscallRows[i].Signal != syscallRows[j].Signal {
+			return syscallRows[i].Signal > syscallRows[j].Signal
+		}
+		return syscallRows[i].Exec > syscallRows[j].Exec
+	})
+	data.Syscalls = syscallRows
+	if len(syscallRows) > maxReportRows {
+		data.Syscalls = syscallRows[:maxReportRows]
+		data.SyscallsCSV = base + "-syscalls.csv"
+		records := [][]string{{"syscall", "executions", "signal"}}
+		for _, row := range syscallRows {
+			records = append(records, []string{row.Name, fmt.Sprint(row.Exec), fmt.Sprint(row.Signal)})
+		}
+		if err := writeCSV(data.SyscallsCSV, records); err != nil {
+			return err
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := reportTemplate.Execute(buf, data); err != nil {
+		return err
+	}
+	return osutil.WriteFile(file, buf.Bytes())
+}
+
+func writeCSV(file string, records [][]string) error {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	if err := w.WriteAll(records); err != nil {
+		return err
+	}
+	return osutil.WriteFile(file, buf.Bytes())
+}
+
+// reportLink returns path to the artifact relative to the report file if possible.
+func reportLink(reportFile, artifact string) string {
+	if rel, err := filepath.Rel(filepath.Dir(reportFile), artifact); err == nil {
+		return rel
+	}
+	return artifact
+}
+
+var reportTemplate = template.Must(template.New("").Parse(`<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>syz-stress report</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 20px; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+svg { border: 1px solid #ccc; margin-bottom: 20px; }
+polyline { fill: none; stroke: #36c; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>syz-stress report</h1>
+<table>
+<tr><th>started</th><td>{{.Start.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th>duration</th><td>{{.Duration}}</td></tr>
+<tr><th>targets</th><td>{{.Targets}}</td></tr>
+<tr><th>procs</th><td>{{.Procs}}</td></tr>
+<tr><th>executed</th><td>{{.Exec}}</td></tr>
+<tr><th>signal</th><td>{{.Signal}}</td></tr>
+<tr><th>command</th><td><code>{{.Command}}</code></td></tr>
+</table>
+
+<h2>Executions per second (max {{printf "%.1f" .ExecRate.Max}})</h2>
+<svg width="600" height="200"><polyline points="{{.ExecRate.Points}}"/></svg>
+
+<h2>Signal (max {{printf "%.0f" .Signals.Max}})</h2>
+<svg width="600" height="200"><polyline points="{{.Signals.Points}}"/></svg>
+
+<h2>Crashes</h2>
+{{if .CrashesCSV}}<p>Top rows only, see <a href="{{.CrashesCSV}}">{{.CrashesCSV}}</a> for the full table.</p>{{end}}
+<table>
+<tr><th>count</th><th>title</th></tr>
+{{range .Crashes}}<tr><td>{{.Count}}</td><td>{{if .Link}}<a href="{{.Link}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Syscalls</h2>
+{{if .SyscallsCSV}}<p>Top rows only, see <a href="{{.SyscallsCSV}}">{{.SyscallsCSV}}</a> for the full table.</p>{{end}}
+<table>
+<tr><th>syscall</th><th>executions</th><th>signal</th></tr>
+{{range .Syscalls}}<tr><td>{{.Name}}</td><td>{{.Exec}}</td><td>{{.Signal}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
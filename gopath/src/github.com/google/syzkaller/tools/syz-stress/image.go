@@ -0,0 +1,141 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagMaxImageSize = flag.String("max-image-size", "16M",
+		"filesystem images of crashing syz_mount_image calls larger than this are not saved")
+
+	maxImageSize uint64
+)
+
+// fsImage is a filesystem image assembled from segments of a syz_mount_image call.
+type fsImage struct {
+	call int
+	fs   string
+	size uint64
+	data []byte // nil if the image is larger than the limit
+}
+
+// namedArg returns the first argument named name among args and their
+// sub-arguments (following pointers, structs and unions), or nil.
+func namedArg(args []prog.Arg, name string) prog.Arg {
+	var res prog.Arg
+	for _, arg := range args {
+		prog.WalkArg(arg, func(a prog.Arg, _ int) bool {
+			if res == nil && a.Type().FieldName() == name {
+				res = a
+			}
+			return res == nil
+		})
+	}
+	return res
+}
+
+func constVal(arg prog.Arg) (uint64, bool) {
+	c, ok := prog.DerefArg(arg).(*prog.ConstArg)
+	if !ok {
+		return 0, false
+	}
+	return c.Val, true
+}
+
+func dataVal(arg prog.Arg) []byte {
+	d, ok := prog.DerefArg(arg).(*prog.DataArg)
+	if !ok {
+		return nil
+	}
+	return d.Data()
+}
+
+// fsImages extracts filesystem images mounted by syz_mount_image calls of p.
+// Images are assembled from the data/offset segments into a buffer of the image size,
+// images above maxSize are returned without data.
+func fsImages(p *prog.Prog, maxSize uint64) []*fsImage {
+	var images []*fsImage
+	for i, c := range p.Calls {
+		if c.Meta.CallName != "syz_mount_image" {
+			continue
+		}
+		size, ok := constVal(namedArg(c.Args, "size"))
+		if !ok {
+			continue
+		}
+		img := &fsImage{
+			call: i,
+			fs:   strings.TrimRight(string(dataVal(namedArg(c.Args, "fs"))), "\x00"),
+			size: size,
+		}
+		images = append(images, img)
+		if size > maxSize {
+			continue
+		}
+		img.data = make([]byte, size)
+		segments, _ := prog.DerefArg(namedArg(c.Args, "segments")).(*prog.GroupArg)
+		if segments == nil {
+			continue
+		}
+		for _, seg := range segments.Inner {
+			data := dataVal(namedArg([]prog.Arg{seg}, "data"))
+			offset, _ := constVal(namedArg([]prog.Arg{seg}, "offset"))
+			if offset < size {
+				copy(img.data[offset:], data)
+			}
+		}
+	}
+	return images
+}
+
+// saveImages writes filesystem images mounted by p into the base.images directory
+// along with a script that loop-mounts them. It returns the number of bytes written.
+func saveImages(p *prog.Prog, base string) int {
+	images := fsImages(p, maxImageSize)
+	if len(images) == 0 {
+		return 0
+	}
+	dir := base + ".images"
+	if err := osutil.MkdirAll(dir); err != nil {
+		log.Logf(0, "failed to create images dir: %v", err)
+		return 0
+	}
+	script := new(bytes.Buffer)
+	fmt.Fprintf(script, "#!/bin/sh\n# Loop-mounts filesystem images of the program read-only, run as root in this"+
+		" directory.\n# Unmount with: umount mnt*\nset -e\n")
+	total := 0
+	for _, img := range images {
+		name := fmt.Sprintf("image%v", img.call)
+		if img.data == nil {
+			fmt.Fprintf(script, "# call %v: %v image of %v bytes exceeds -max-image-size, not saved\n",
+				img.call, img.fs, img.size)
+			continue
+		}
+		n, err := writeArtifact(filepath.Join(dir, name), img.data)
+		if err != nil {
+			log.Logf(0, "failed to save filesystem image: %v", err)
+			continue
+		}
+		total += n
+		fmt.Fprintf(script, "\n# call %v: %v image of %v bytes\n", img.call, img.fs, img.size)
+		if suffix := artifactSuffix(); suffix != "" {
+			fmt.Fprintf(script, "gunzip -kf %v%v\n", name, suffix)
+		}
+		fmt.Fprintf(script, "mkdir -p mnt%v\nmount -t %v -o loop,ro %v mnt%v\n", img.call, img.fs, name, img.call)
+	}
+	if err := osutil.WriteExecFile(filepath.Join(dir, "mount.sh"), script.Bytes()); err != nil {
+		log.Logf(0, "failed to save mount script: %v", err)
+	}
+	return total + script.Len()
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagDumpInflight = flag.Bool("dump-inflight", false, "dump programs executed by procs to stderr "+
+		"on SIGQUIT and before exiting due to executor failures")
+
+	// lastProgs holds the *inflightProg that each proc executed last.
+	lastProgs []atomic.Value
+	// currentStarts holds start times (UnixNano) of programs in currentProgs.
+	currentStarts []int64
+	dumpMu        sync.Mutex
+)
+
+// inflightProg is a completed execution of a serialized program.
+type inflightProg struct {
+	data       []byte
+	start, end int64 // UnixNano
+}
+
+// initInflight starts tracking of programs executed by procs if anything uses them.
+// Tracking serializes every executed program, so it's off by default.
+// With -dump-inflight the programs are dumped to stderr on SIGQUIT, e.g. when the kernel
+// is about to lock up and there is little time left to look at the console.
+func initInflight(procs int) {
+	if !*flagDumpInflight && !*flagSaveConcurrent && *flagWorkerTimeout == 0 && *flagProgressTimeout == 0 {
+		return
+	}
+	initCurrentProgs(procs)
+	lastProgs = make([]atomic.Value, procs)
+	currentStarts = make([]int64, procs)
+	if !*flagDumpInflight {
+		return
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGQUIT)
+	go func() {
+		for range c {
+			dumpInflight()
+		}
+	}()
+}
+
+// dumpInflight synchronously writes the current and the last completed program of every proc to stderr.
+func dumpInflight() {
+	if lastProgs == nil {
+		return
+	}
+	dumpMu.Lock()
+	defer dumpMu.Unlock()
+	buf := new(bytes.Buffer)
+	for pid := range lastProgs {
+		cur, _ := currentProgs[pid].Load().([]byte)
+		last, _ := lastProgs[pid].Load().(*inflightProg)
+		if len(cur) == 0 && last == nil {
+			continue
+		}
+		if len(cur) != 0 {
+			fmt.Fprintf(buf, "proc %v is executing:\n%s\n", pid, cur)
+		} else {
+			fmt.Fprintf(buf, "proc %v is not executing\n", pid)
+		}
+		if last != nil {
+			fmt.Fprintf(buf, "proc %v last executed:\n%s\n", pid, last.data)
+		}
+	}
+	os.Stderr.Write(buf.Bytes())
+}
+
+// startInflight records that proc pid started executing data at start.
+func startInflight(pid int, data []byte, start time.Time) {
+	atomic.StoreInt64(&currentStarts[pid], start.UnixNano())
+	currentProgs[pid].Store(data)
+}
+
+// finishInflight records that proc pid finished executing p (serialized as data).
+// With -save-concurrent it also captures programs that other procs executed
+// concurrently with it in case p turns out to be a crash.
+func finishInflight(pid int, p *prog.Prog, data []byte, start time.Time) {
+	end := time.Now()
+	if *flagSaveConcurrent {
+		concurrentSets.Store(p, snapshotConcurrent(pid, data, start, end))
+	}
+	lastProgs[pid].Store(&inflightProg{data, start.UnixNano(), end.UnixNano()})
+	currentProgs[pid].Store([]byte{})
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagInitPrograms = flag.String("init-programs", "", "programs executed in order on every new executor "+
+		"before fuzzing (corpus .db ordered by sequence number, or a file with programs separated by empty lines)")
+
+	statInitFail uint64
+)
+
+// loadInitPrograms reads -init-programs for target.
+func loadInitPrograms(target *prog.Target, file string) ([]*prog.Prog, error) {
+	var datas [][]byte
+	if filepath.Ext(file) == ".db" {
+		progDB, err := db.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open init programs: %v", err)
+		}
+		var keys []string
+		for key := range progDB.Records {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			ri, rj := progDB.Records[keys[i]], progDB.Records[keys[j]]
+			if ri.Seq != rj.Seq {
+				return ri.Seq < rj.Seq
+			}
+			return keys[i] < keys[j]
+		})
+		for _, key := range keys {
+			datas = append(datas, progDB.Records[key].Val)
+		}
+	} else {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read init programs: %v", err)
+		}
+		for _, data := range bytes.Split(data, []byte("\n\n")) {
+			if len(bytes.TrimSpace(data)) != 0 {
+				datas = append(datas, data)
+			}
+		}
+	}
+	var progs []*prog.Prog
+	for i, data := range datas {
+		p, err := target.Deserialize(data, prog.NonStrict)
+		if err != nil {
+			return nil, fmt.Errorf("init program %v: %v", i, err)
+		}
+		progs = append(progs, p)
+	}
+	return progs, nil
+}
+
+// runInitPrograms executes init programs on the current executor of proc.
+func (proc *proc) runInitPrograms() {
+	for i, p := range proc.initProgs {
+		recordProg(p)
+		output, _, hanged, err := proc.env.Exec(proc.execOpts, p)
+		if err != nil || hanged {
+			atomic.AddUint64(&statInitFail, 1)
+			log.Logf(0, "proc %v: init program %v failed (hanged=%v, err=%v):\n%s\n%s",
+				proc.pid, i, hanged, err, p.Serialize(), output)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagTimeoutJitter = flag.Float64("timeout-jitter", 0, "randomize the executor timeout within this fraction "+
+		"of the configured value (e.g. 0.3 for +-30%), a new timeout is chosen for every execution")
+
+	// Executions and crashes with timeouts below (index 0) and above (index 1) the configured timeout.
+	statJitterExecs   [2]uint64
+	statJitterCrashes [2]uint64
+)
+
+// Jittered timeouts never go below this, shorter timeouts cause spurious hangs.
+const minJitterTimeout = 2 * time.Second
+
+// jitterConfig returns the config executors are created with. ipc fixes the timeout
+// when an executor is started, so with -timeout-jitter executors get the longest
+// timeout of the band and every execution is cut at its own timeout by armTimeout.
+func jitterConfig(config *ipc.Config) *ipc.Config {
+	if *flagTimeoutJitter == 0 || config.Timeout == 0 {
+		return config
+	}
+	jittered := *config
+	jittered.Timeout = time.Duration(float64(config.Timeout) * (1 + *flagTimeoutJitter))
+	return &jittered
+}
+
+// pickTimeout chooses the timeout of the next execution and records whether it's
+// above the configured one. It returns 0 if -timeout-jitter is not used.
+func (proc *proc) pickTimeout() time.Duration {
+	if *flagTimeoutJitter == 0 || proc.config.Timeout == 0 {
+		return 0
+	}
+	delta := (proc.rnd.Float64()*2 - 1) * *flagTimeoutJitter
+	timeout := time.Duration(float64(proc.config.Timeout) * (1 + delta))
+	if timeout < minJitterTimeout {
+		timeout = minJitterTimeout
+	}
+	proc.longTimeout = delta > 0
+	return timeout
+}
+
+// armTimeout kills the executor of proc if the current execution does not finish
+// within timeout (no limit if it's 0). The returned function must be called when
+// Exec returns, it reports whether the executor was killed.
+// Executor processes are found via /proc, so elsewhere only the executor timeout applies.
+func (proc *proc) armTimeout(timeout time.Duration) func() bool {
+	if timeout == 0 {
+		return func() bool { return false }
+	}
+	var killed uint32
+	t := time.AfterFunc(timeout, func() {
+		if proc.killExecutor() != 0 {
+			atomic.StoreUint32(&killed, 1)
+		}
+	})
+	return func() bool {
+		t.Stop()
+		return atomic.LoadUint32(&killed) != 0
+	}
+}
+
+func checkTimeoutJitter(config *ipc.Config) error {
+	if *flagTimeoutJitter < 0 || *flagTimeoutJitter >= 1 {
+		return fmt.Errorf("-timeout-jitter must be in [0, 1)")
+	}
+	if *flagTimeoutJitter != 0 && config.Timeout == 0 {
+		log.Logf(0, "executor timeout is not configured, -timeout-jitter has no effect")
+	}
+	return nil
+}
+
+func (proc *proc) accountJitter(crashed bool) {
+	if *flagTimeoutJitter == 0 {
+		return
+	}
+	band := 0
+	if proc.longTimeout {
+		band = 1
+	}
+	atomic.AddUint64(&statJitterExecs[band], 1)
+	if crashed {
+		atomic.AddUint64(&statJitterCrashes[band], 1)
+	}
+}
+
+// jitterSummary returns crash yield for executions with shorter and longer timeouts.
+func jitterSummary() string {
+	yield := func(band int) string {
+		execs := atomic.LoadUint64(&statJitterExecs[band])
+		if execs == 0 {
+			return "no executions"
+		}
+		crashes := atomic.LoadUint64(&statJitterCrashes[band])
+		return fmt.Sprintf("%v crashes in %v executions (%.2f per 1M)", crashes, execs,
+			float64(crashes)*1e6/float64(execs))
+	}
+	return fmt.Sprintf("shorter timeouts: %v\nlonger timeouts: %v\n", yield(0), yield(1))
+}
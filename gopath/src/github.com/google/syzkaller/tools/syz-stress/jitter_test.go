@@ -0,0 +1,59 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+)
+
+func TestPickTimeout(t *testing.T) {
+	defer func(old float64) { *flagTimeoutJitter = old }(*flagTimeoutJitter)
+	config := &ipc.Config{Timeout: 10 * time.Second}
+	proc := &proc{
+		fuzzTarget: &fuzzTarget{config: config},
+		rnd:        rand.New(rand.NewSource(0)),
+	}
+	*flagTimeoutJitter = 0
+	if timeout := proc.pickTimeout(); timeout != 0 {
+		t.Fatalf("picked timeout %v without -timeout-jitter", timeout)
+	}
+	*flagTimeoutJitter = 0.5
+	if got := jitterConfig(config).Timeout; got != 15*time.Second {
+		t.Fatalf("executor timeout is %v, want 15s", got)
+	}
+	seen := make(map[bool]bool)
+	for i := 0; i < 100; i++ {
+		timeout := proc.pickTimeout()
+		if timeout < 5*time.Second || timeout > 15*time.Second {
+			t.Fatalf("picked timeout %v, want 5s..15s", timeout)
+		}
+		if proc.longTimeout != (timeout > config.Timeout) {
+			t.Fatalf("timeout %v, longTimeout %v", timeout, proc.longTimeout)
+		}
+		seen[proc.longTimeout] = true
+	}
+	if len(seen) != 2 {
+		t.Errorf("timeouts are not picked on both sides of the configured one")
+	}
+}
+
+func TestArmTimeout(t *testing.T) {
+	proc := &proc{
+		fuzzTarget: &fuzzTarget{config: &ipc.Config{Executor: fakeExecutorBin}},
+		pid:        1000,
+	}
+	if proc.armTimeout(0)() {
+		t.Fatalf("executor killed without a timeout")
+	}
+	// The proc has no executor processes, so nothing is killed when the timer fires.
+	disarm := proc.armTimeout(time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	if disarm() {
+		t.Fatalf("reported a kill with no executor processes")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/kversion"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagKernelVersions = flag.String("kernel-versions", "",
+		"file with 'NAME VERSION' lines giving the kernel version that introduced syscalls and ioctl commands "+
+			"(see pkg/kversion)")
+	flagMinKernel = flag.String("min-kernel", "",
+		"check -corpus programs against this kernel version using -kernel-versions (e.g. 5.4)")
+	flagMinKernelPolicy = flag.String("min-kernel-policy", "drop",
+		"handling of -corpus programs incompatible with -min-kernel: drop or flag (log and keep)")
+)
+
+// filterKernelVersion checks corpus against -min-kernel and drops or flags incompatible programs.
+// Counts of programs per offending syscall are logged so that gaps in the table are visible.
+func filterKernelVersion(target *prog.Target, corpus []*prog.Prog) ([]*prog.Prog, error) {
+	if *flagKernelVersions == "" {
+		return nil, fmt.Errorf("-min-kernel requires -kernel-versions")
+	}
+	if *flagMinKernelPolicy != "drop" && *flagMinKernelPolicy != "flag" {
+		return nil, fmt.Errorf("unknown -min-kernel-policy %q", *flagMinKernelPolicy)
+	}
+	version, err := kversion.ParseVersion(*flagMinKernel)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(*flagKernelVersions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel versions: %v", err)
+	}
+	table, err := kversion.Parse(target, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kernel versions: %v", err)
+	}
+	offending := newTitleStats()
+	var res []*prog.Prog
+	incompatible := 0
+	for _, p := range corpus {
+		missing := table.Check(p, version)
+		if len(missing) == 0 {
+			res = append(res, p)
+			continue
+		}
+		incompatible++
+		// Count each offending syscall once per program.
+		seen := make(map[string]bool)
+		var names []string
+		for _, m := range missing {
+			if !seen[m.Name] {
+				seen[m.Name] = true
+				offending.add(fmt.Sprintf("%v (%v)", m.Name, m.Version))
+				names = append(names, m.Name)
+			}
+		}
+		log.Logf(1, "program %v is incompatible with kernel %v (score %.2f): %v",
+			callNames(p), version, table.Score(p, version), strings.Join(names, ", "))
+		if *flagMinKernelPolicy == "flag" {
+			res = append(res, p)
+		}
+	}
+	if incompatible != 0 {
+		verb := "dropped"
+		if *flagMinKernelPolicy == "flag" {
+			verb = "flagged"
+		}
+		log.Logf(0, "%v %v/%v corpus programs incompatible with kernel %v, programs per syscall:\n%v",
+			verb, incompatible, len(corpus), version, offending)
+	}
+	return res, nil
+}
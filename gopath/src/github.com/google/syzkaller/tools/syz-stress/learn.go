@@ -0,0 +1,141 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagNoLearn    = flag.Bool("no-learn", false, "don't disable syscalls that fail as unsupported at runtime")
+	flagLearnExecs = flag.Int("learn-execs", 20,
+		"disable a syscall if this many of its first executions fail with ENOSYS, EPERM or ENODEV")
+	flagLearnFile = flag.String("learn-file", "",
+		"file with learned unsupported syscalls, read on start and appended to when a syscall is disabled")
+
+	learnFileMu sync.Mutex
+)
+
+// callLearner detects syscalls that are unsupported in this environment
+// although host detection says otherwise (e.g. inside containers):
+// a call is disabled if all of its first -learn-execs executions failed with
+// an errno that means the call is not supported at all. Any other result proves
+// the call works, other errors (e.g. EINVAL or EBADF) are part of normal operation.
+type callLearner struct {
+	ft     *fuzzTarget
+	fails  []uint32 // indexed by syscall ID
+	proven []uint32 // set to 1 once a call does not fail as unsupported
+	mu     sync.Mutex
+}
+
+func newCallLearner(ft *fuzzTarget) *callLearner {
+	return &callLearner{
+		ft:     ft,
+		fails:  make([]uint32, len(ft.target.Syscalls)),
+		proven: make([]uint32, len(ft.target.Syscalls)),
+	}
+}
+
+func isUnsupportedErrno(errno int) bool {
+	switch syscall.Errno(errno) {
+	case syscall.ENOSYS, syscall.EPERM, syscall.ENODEV:
+		return true
+	}
+	return false
+}
+
+// add accounts the result of an execution of call c.
+func (l *callLearner) add(c *prog.Syscall, info *ipc.CallInfo) {
+	if info.Flags&ipc.CallExecuted == 0 || atomic.LoadUint32(&l.proven[c.ID]) != 0 {
+		return
+	}
+	if info.Flags&ipc.CallFinished == 0 || !isUnsupportedErrno(info.Errno) {
+		atomic.StoreUint32(&l.proven[c.ID], 1)
+		return
+	}
+	if atomic.AddUint32(&l.fails[c.ID], 1) == uint32(*flagLearnExecs) {
+		l.disable(c, syscall.Errno(info.Errno))
+	}
+}
+
+// disable removes c (and calls that depend on it) from the enabled calls
+// and rebuilds the choice table.
+func (l *callLearner) disable(c *prog.Syscall, errno syscall.Errno) {
+	ft := l.ft
+	ft.callsMu.Lock()
+	defer ft.callsMu.Unlock()
+	calls := make(map[*prog.Syscall]bool)
+	for call := range ft.calls {
+		if call != c {
+			calls[call] = true
+		}
+	}
+	calls, disabled := ft.target.TransitivelyEnabledCalls(calls)
+	if len(calls) == 0 {
+		log.Logf(0, "%v fails with %v, but it's the last enabled syscall", c.Name, errno)
+		return
+	}
+	log.Logf(0, "disabling %v: first %v executions failed with %v", c.Name, *flagLearnExecs, errno)
+	for call, reason := range disabled {
+		log.Logf(0, "transitively disabled: %v: %v", call.Name, reason)
+	}
+	ft.calls = calls
+	ft.ct.Store(ft.target.BuildChoiceTable(ft.calculatePriorities(), ft.calls))
+	if *flagLearnFile != "" {
+		if err := appendLearned(*flagLearnFile, c.Name); err != nil {
+			log.Logf(0, "failed to save learned syscalls: %v", err)
+		}
+	}
+}
+
+func appendLearned(file, name string) error {
+	learnFileMu.Lock()
+	defer learnFileMu.Unlock()
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%v\n", name)
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// disableLearned removes calls listed in the learned file (if it exists) from calls
+// and returns the remaining transitively enabled calls.
+func disableLearned(target *prog.Target, calls map[*prog.Syscall]bool, file string) map[*prog.Syscall]bool {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Fatalf("failed to read -learn-file: %v", err)
+		}
+		return calls
+	}
+	n := 0
+	for _, name := range strings.Fields(string(bytes.TrimSpace(data))) {
+		if c := target.SyscallMap[name]; c != nil && calls[c] {
+			delete(calls, c)
+			n++
+		}
+	}
+	calls, disabled := target.TransitivelyEnabledCalls(calls)
+	for c, reason := range disabled {
+		log.Logf(0, "transitively disabled by -learn-file: %v: %v", c.Name, reason)
+	}
+	log.Logf(0, "disabled %v syscalls learned as unsupported by previous runs", n)
+	return calls
+}
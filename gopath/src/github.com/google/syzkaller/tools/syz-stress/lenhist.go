@@ -0,0 +1,86 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+var flagLenHistogram = flag.Bool("len-histogram", false, "include program length percentiles in periodic stats")
+
+// Programs of maxHistLen calls and longer share the last bucket of lenHist.
+const maxHistLen = 64
+
+// lenHist counts executed programs by their number of calls.
+var lenHist [maxHistLen + 1]uint64
+
+func recordProgLen(ncalls int) {
+	if ncalls > maxHistLen {
+		ncalls = maxHistLen
+	}
+	atomic.AddUint64(&lenHist[ncalls], 1)
+}
+
+func loadLenHist() (hist [maxHistLen + 1]uint64, total uint64) {
+	for i := range lenHist {
+		hist[i] = atomic.LoadUint64(&lenHist[i])
+		total += hist[i]
+	}
+	return
+}
+
+// lenPercentiles returns a short summary of the length distribution for the periodic stats.
+func lenPercentiles() string {
+	hist, total := loadLenHist()
+	if total == 0 {
+		return "no programs"
+	}
+	var sum uint64
+	for n, count := range hist {
+		sum += uint64(n) * count
+	}
+	percentile := func(p float64) int {
+		want := uint64(p * float64(total))
+		var seen uint64
+		for n, count := range hist {
+			if seen += count; seen > want {
+				return n
+			}
+		}
+		return maxHistLen
+	}
+	return fmt.Sprintf("mean %.1f, p50 %v, p90 %v, p99 %v", float64(sum)/float64(total),
+		percentile(0.5), percentile(0.9), percentile(0.99))
+}
+
+// lenHistTable returns the histogram of lengths of executed programs.
+func lenHistTable() string {
+	hist, total := loadLenHist()
+	if total == 0 {
+		return ""
+	}
+	var max uint64
+	for _, count := range hist {
+		if count > max {
+			max = count
+		}
+	}
+	const width = 40
+	buf := new(strings.Builder)
+	for n, count := range hist {
+		if count == 0 {
+			continue
+		}
+		name := fmt.Sprint(n)
+		if n == maxHistLen {
+			name += "+"
+		}
+		fmt.Fprintf(buf, "%4v %10v %5.1f%% %v\n", name, count, 100*float64(count)/float64(total),
+			strings.Repeat("#", int((count*width+max-1)/max)))
+	}
+	return buf.String()
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagLineage = flag.Bool("lineage", false, "save lineage (root program and all mutants) of crashing programs to crashdir")
+
+	// lineages maps programs being executed to their lineage.
+	lineages sync.Map
+	// corpusKeys maps corpus programs to their database keys, filled only with -lineage.
+	corpusKeys = make(map[*prog.Prog]string)
+)
+
+// lineage accumulates serializations of the steps that produce a program.
+type lineage struct {
+	data []byte
+	step int
+}
+
+// add appends p produced by step what to the lineage and returns the lineage so far,
+// or nil if -lineage is not given. The returned slice is not changed by subsequent calls.
+func (lin *lineage) add(p *prog.Prog, what string) []byte {
+	if !*flagLineage {
+		return nil
+	}
+	lin.data = append(lin.data, fmt.Sprintf("# step %v: %v\n", lin.step, what)...)
+	lin.data = append(lin.data, p.Serialize()...)
+	lin.step++
+	return lin.data[:len(lin.data):len(lin.data)]
+}
+
+func corpusOrigin(p *prog.Prog, idx int) string {
+	if key := corpusKeys[p]; key != "" {
+		return fmt.Sprintf("corpus program %v (record %v)", idx, key)
+	}
+	return fmt.Sprintf("corpus program %v", idx)
+}
+
+// programLineage returns the lineage of the program being executed, or nil.
+func programLineage(p *prog.Prog) []byte {
+	lin, ok := lineages.Load(p)
+	if !ok {
+		return nil
+	}
+	data := lin.([]byte)
+	return append(data[:len(data):len(data)], "# the last step crashed\n"...)
+}
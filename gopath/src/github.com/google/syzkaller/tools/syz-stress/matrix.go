@@ -0,0 +1,71 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagCoverageMatrix = flag.String("coverage-matrix", "", "write per-proc per-syscall execution counts to this csv file on exit")
+
+// writeCallMatrix writes a csv file with a row per proc and a column per syscall
+// executed by any proc. The cell is the number of executions of the syscall by the proc.
+func writeCallMatrix(file string) error {
+	workersMu.Lock()
+	procs := append([]*proc{}, workers...)
+	workersMu.Unlock()
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].pid < procs[j].pid
+	})
+	type column struct {
+		target *prog.Target
+		call   *prog.Syscall
+	}
+	var columns []column
+	seen := make(map[*prog.Syscall]bool)
+	for _, proc := range procs {
+		for id := range proc.callExecs {
+			call := proc.target.Syscalls[id]
+			if atomic.LoadUint64(&proc.callExecs[id]) != 0 && !seen[call] {
+				seen[call] = true
+				columns = append(columns, column{proc.target, call})
+			}
+		}
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if columns[i].target != columns[j].target {
+			return columns[i].target.Arch < columns[j].target.Arch
+		}
+		return columns[i].call.Name < columns[j].call.Name
+	})
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "proc")
+	for _, col := range columns {
+		name := col.call.Name
+		if len(procs) != 0 && col.target != procs[0].target {
+			name = col.target.Arch + ":" + name
+		}
+		fmt.Fprintf(buf, ",%v", name)
+	}
+	fmt.Fprintf(buf, "\n")
+	for _, proc := range procs {
+		fmt.Fprintf(buf, "%v", proc.pid)
+		for _, col := range columns {
+			n := uint64(0)
+			if col.target == proc.target {
+				n = atomic.LoadUint64(&proc.callExecs[col.call.ID])
+			}
+			fmt.Fprintf(buf, ",%v", n)
+		}
+		fmt.Fprintf(buf, "\n")
+	}
+	return osutil.WriteFile(file, buf.Bytes())
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagMemCap = flag.String("memcap", "", "limit estimated total memory of concurrently executing programs (e.g. 8G)")
+
+	memGate *memSemaphore
+	// statMemWait is the number of executions that had to wait for memory.
+	statMemWait uint64
+)
+
+// Estimated memory footprint of an executor without the program's own mappings
+// (binary, shared memory regions and the data area).
+const executorBaseMem = 32 << 20
+
+// memSemaphore is a weighted semaphore that admits executions while their total
+// estimated memory stays within the cap.
+type memSemaphore struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	cap  uint64
+	used uint64
+}
+
+func initMemCap() {
+	size, err := parseSize(*flagMemCap)
+	if err != nil {
+		log.Fatalf("bad -memcap: %v", err)
+	}
+	memGate = &memSemaphore{cap: size}
+	memGate.cond = sync.NewCond(&memGate.mu)
+}
+
+// acquire blocks until mem can be used without exceeding the cap and returns
+// the amount to pass to release. Programs larger than the cap run alone.
+func (s *memSemaphore) acquire(mem uint64) uint64 {
+	if mem > s.cap {
+		mem = s.cap
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used+mem > s.cap {
+		atomic.AddUint64(&statMemWait, 1)
+		for s.used+mem > s.cap {
+			s.cond.Wait()
+		}
+	}
+	s.used += mem
+	return mem
+}
+
+func (s *memSemaphore) release(mem uint64) {
+	s.mu.Lock()
+	s.used -= mem
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// progMemEstimate estimates memory used by execution of p: the executor footprint
+// plus the lengths of all mmap/mremap calls in the program. The executor does not
+// report RSS, so this is a crude upper bound of what the program can touch.
+func progMemEstimate(p *prog.Prog) uint64 {
+	mem := uint64(executorBaseMem)
+	for _, c := range p.Calls {
+		switch c.Meta.CallName {
+		case "mmap", "mremap":
+			if len(c.Args) < 2 {
+				continue
+			}
+			if arg, ok := c.Args[1].(*prog.ConstArg); ok {
+				mem += arg.Val
+			}
+		}
+	}
+	return mem
+}
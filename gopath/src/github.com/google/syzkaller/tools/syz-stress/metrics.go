@@ -0,0 +1,74 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var flagHTTP = flag.String("http", "", "serve metrics in Prometheus text format on this address (e.g. localhost:8080), see metrics.go for the list")
+
+var (
+	statExecErrors uint64 // executor failures
+	statHangs      uint64 // hanged programs
+)
+
+// serveMetrics serves /metrics in Prometheus text format on addr.
+// Exported metrics (per-proc metrics are labeled with the proc pid):
+//
+//	syzstress_info{run_id="ID"}           always 1, labeled with the run id
+//	syzstress_exec_total                  executed programs
+//	syzstress_exec_errors_total           executor failures
+//	syzstress_hangs_total                 hanged programs
+//	syzstress_crashes_total               crashes
+//	syzstress_proc_exec_total{pid="N"}    programs executed by proc N
+//	syzstress_proc_executing{pid="N"}     1 if proc N is executing a program now, 0 otherwise
+func serveMetrics(addr string) {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	go func() {
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			log.Fatalf("failed to serve metrics on %v: %v", addr, err)
+		}
+	}()
+	log.Logf(0, "serving metrics on http://%v/metrics", addr)
+}
+
+func writeMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP syzstress_info Information about the run.\n# TYPE syzstress_info gauge\n")
+	fmt.Fprintf(w, "syzstress_info{run_id=%q} 1\n", runID)
+	counter := func(name, help string, val uint64) {
+		fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v counter\n%v %v\n", name, help, name, name, val)
+	}
+	counter("syzstress_exec_total", "Executed programs.", atomic.LoadUint64(&statExec))
+	counter("syzstress_exec_errors_total", "Executor failures.", atomic.LoadUint64(&statExecErrors))
+	counter("syzstress_hangs_total", "Hanged programs.", atomic.LoadUint64(&statHangs))
+	counter("syzstress_crashes_total", "Crashes.", uint64(crashes.total()))
+
+	workersMu.Lock()
+	procs := append([]*proc{}, workers...)
+	workersMu.Unlock()
+	fmt.Fprintf(w, "# HELP syzstress_proc_exec_total Programs executed by the proc.\n")
+	fmt.Fprintf(w, "# TYPE syzstress_proc_exec_total counter\n")
+	for _, proc := range procs {
+		fmt.Fprintf(w, "syzstress_proc_exec_total{pid=\"%v\"} %v\n", proc.pid, atomic.LoadUint64(&proc.execs))
+	}
+	fmt.Fprintf(w, "# HELP syzstress_proc_executing Whether the proc is executing a program now.\n")
+	fmt.Fprintf(w, "# TYPE syzstress_proc_executing gauge\n")
+	for _, proc := range procs {
+		executing := 0
+		if atomic.LoadInt64(&proc.heartbeat) != 0 {
+			executing = 1
+		}
+		fmt.Fprintf(w, "syzstress_proc_executing{pid=\"%v\"} %v\n", proc.pid, executing)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagMigrate = flag.String("migrate", "", "file with syscall renames applied to corpus programs, "+
+		"one 'old new [new...]' per line")
+	flagMigratePolicy = flag.String("migrate-policy", "first",
+		"handling of renames to several calls: first (use the first one), all (a program per variant), drop")
+
+	// migration is the -migrate rename table, nil if -migrate is not given.
+	migration *prog.Migration
+)
+
+// Programs with ambiguous renames produce at most this many variants with -migrate-policy=all.
+const maxMigrateVariants = 16
+
+func loadMigrations(target *prog.Target, file string) error {
+	switch *flagMigratePolicy {
+	case "first", "all", "drop":
+	default:
+		return fmt.Errorf("unknown -migrate-policy %q", *flagMigratePolicy)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if migration, err = target.ParseMigration(data); err != nil {
+		return fmt.Errorf("%v: %v", file, err)
+	}
+	return nil
+}
+
+// migrateProg deserializes the program data applying the -migrate renames.
+// It returns the resulting program variants (none if the program is dropped due to
+// an ambiguous rename) and the number of renamed calls keyed by the old name.
+// Must not be called concurrently with anything else that uses the target.
+func migrateProg(data []byte) (progs []*prog.Prog, renamed map[string]int, err error) {
+	p, renamed, err := migration.Deserialize(data, prog.NonStrict)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ambiguous := migration.Ambiguous(renamed); len(ambiguous) != 0 {
+		switch *flagMigratePolicy {
+		case "drop":
+			return nil, renamed, nil
+		case "all":
+			return migration.Variants(data, prog.NonStrict, ambiguous, maxMigrateVariants), renamed, nil
+		}
+	}
+	return []*prog.Prog{p}, renamed, nil
+}
+
+// migrationCounts formats per-rename counts for logging.
+func migrationCounts(renamed map[string]int) string {
+	var res []string
+	for old, n := range renamed {
+		res = append(res, fmt.Sprintf("%v: %v", old, n))
+	}
+	sort.Strings(res)
+	return strings.Join(res, ", ")
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+)
+
+func TestMigrateProg(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p *prog.Prog
+	for rs := rand.NewSource(0); p == nil || len(p.Calls) < 2; {
+		p = target.Generate(rs, 5, target.DefaultChoiceTable())
+	}
+	want := p.Serialize()
+	meta := p.Calls[0].Meta
+	other := target.Syscalls[(meta.ID+1)%len(target.Syscalls)]
+	const old = "migrate$old"
+	// The old name replaces the name of the first call only, the rest of the program must not change.
+	data := bytes.Replace(want, []byte(meta.Name+"("), []byte(old+"("), 1)
+
+	file, err := ioutil.TempFile("", "syz-stress-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	fmt.Fprintf(file, "# renames\n%v %v %v\n", old, meta.Name, other.Name)
+	file.Close()
+	defer func(policy string) {
+		*flagMigratePolicy = policy
+		migration = nil
+	}(*flagMigratePolicy)
+
+	tests := []struct {
+		policy string
+		data   []byte
+		// Expected syscalls of the first call of all resulting programs.
+		metas   []*prog.Syscall
+		renamed int
+	}{
+		{"first", data, []*prog.Syscall{meta}, 1},
+		{"all", data, []*prog.Syscall{meta, other}, 1},
+		{"drop", data, nil, 1},
+		{"first", want, []*prog.Syscall{meta}, 0},
+	}
+	for i, test := range tests {
+		*flagMigratePolicy = test.policy
+		if err := loadMigrations(target, file.Name()); err != nil {
+			t.Fatal(err)
+		}
+		progs, renamed, err := migrateProg(test.data)
+		if err != nil {
+			t.Fatalf("#%v: %v", i, err)
+		}
+		if target.SyscallMap[old] != nil {
+			t.Fatalf("#%v: old syscall name is left in the target", i)
+		}
+		if renamed[old] != test.renamed || len(renamed) > 1 {
+			t.Errorf("#%v: renamed %v, want %v: %v", i, renamed, old, test.renamed)
+		}
+		if len(progs) != len(test.metas) {
+			t.Fatalf("#%v: got %v programs, want %v", i, len(progs), len(test.metas))
+		}
+		for j, p1 := range progs {
+			if p1.Calls[0].Meta != test.metas[j] {
+				t.Errorf("#%v: program %v: first call is %v, want %v",
+					i, j, p1.Calls[0].Meta.Name, test.metas[j].Name)
+			}
+			if err := validateProg(p1); err != nil {
+				t.Errorf("#%v: program %v is invalid: %v", i, j, err)
+			}
+		}
+		if len(progs) != 0 {
+			if got := progs[0].Serialize(); !bytes.Equal(got, want) {
+				t.Errorf("#%v: migrated program:\n%s\nwant:\n%s", i, got, want)
+			}
+		}
+	}
+}
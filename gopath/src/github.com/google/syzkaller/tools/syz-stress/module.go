@@ -0,0 +1,89 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var (
+	flagCycleModule = flag.String("cycle-module", "", "name:interval, periodically unload and reload "+
+		"the kernel module (e.g. vivid:30s)")
+
+	statModuleCycles     uint64
+	statModuleUnloadFail uint64
+
+	// moduleSeq is the sequence number of the last module load/unload transition,
+	// moduleTime is its time (UnixNano).
+	moduleSeq  uint64
+	moduleTime int64
+)
+
+const (
+	moduleCmdTimeout = time.Minute
+	// Crashes saved within this time after a module transition reference the transition.
+	moduleCrashWindow = 10 * time.Second
+)
+
+func startModuleCycle(spec string) error {
+	colon := strings.LastIndexByte(spec, ':')
+	if colon <= 0 {
+		return fmt.Errorf("bad -cycle-module %q, want name:interval", spec)
+	}
+	name := spec[:colon]
+	interval, err := time.ParseDuration(spec[colon+1:])
+	if err != nil || interval <= 0 {
+		return fmt.Errorf("bad -cycle-module interval %q", spec[colon+1:])
+	}
+	go func() {
+		for range time.NewTicker(interval).C {
+			// All procs are paused between executions while the module is cycled.
+			betweenExecs(func() {
+				cycleModule(name)
+			})
+		}
+	}()
+	return nil
+}
+
+// cycleModule unloads and loads back the module. Modules are global for the kernel,
+// so this affects executors in all sandboxes. A module that is busy is counted
+// and left loaded.
+func cycleModule(name string) {
+	atomic.AddUint64(&statModuleCycles, 1)
+	if _, err := osutil.Run(moduleCmdTimeout, exec.Command("modprobe", "-r", name)); err != nil {
+		atomic.AddUint64(&statModuleUnloadFail, 1)
+		log.Logf(1, "module %v: failed to unload: %v", name, err)
+	} else {
+		log.Logf(0, "module transition %v: unloaded %v", moduleTransition(), name)
+	}
+	if _, err := osutil.Run(moduleCmdTimeout, exec.Command("modprobe", name)); err != nil {
+		log.Logf(0, "module %v: failed to load: %v", name, err)
+		return
+	}
+	log.Logf(0, "module transition %v: loaded %v", moduleTransition(), name)
+}
+
+func moduleTransition() uint64 {
+	atomic.StoreInt64(&moduleTime, time.Now().UnixNano())
+	return atomic.AddUint64(&moduleSeq, 1)
+}
+
+// recentModuleTransition returns the sequence number of the last module transition
+// if it happened recently, or 0.
+func recentModuleTransition() uint64 {
+	t := atomic.LoadInt64(&moduleTime)
+	if t == 0 || time.Since(time.Unix(0, t)) > moduleCrashWindow {
+		return 0
+	}
+	return atomic.LoadUint64(&moduleSeq)
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagNgram = flag.Int("ngram", 0, "bias generation towards call bigrams (2) or bigrams and trigrams (3) "+
+		"frequent in the corpus (0 - disabled)")
+	flagNgramWeight = flag.Float64("ngram-weight", 1, "priority of the most frequent -ngram is multiplied by 1+weight")
+)
+
+// N-grams that occur in fewer corpus programs are ignored as noise.
+const ngramMinCount = 2
+
+// ngramTable counts corpus programs that contain each sequence of adjacent calls.
+// Keys are syscall IDs, bigrams have -1 in the first element.
+type ngramTable struct {
+	counts map[[3]int]int
+	max2   int
+	max3   int
+	nprogs int
+	target *prog.Target
+}
+
+func checkNgramFlag() error {
+	if *flagNgram != 0 && *flagNgram != 2 && *flagNgram != 3 {
+		return fmt.Errorf("bad -ngram %v: want 0, 2 or 3", *flagNgram)
+	}
+	if *flagNgramWeight < 0 {
+		return fmt.Errorf("bad -ngram-weight %v: must not be negative", *flagNgramWeight)
+	}
+	return nil
+}
+
+func buildNgrams(target *prog.Target, corpus []*prog.Prog, n int) *ngramTable {
+	t := &ngramTable{
+		counts: make(map[[3]int]int),
+		nprogs: len(corpus),
+		target: target,
+	}
+	for _, p := range corpus {
+		seen := make(map[[3]int]bool)
+		for i := 1; i < len(p.Calls); i++ {
+			seen[[3]int{-1, p.Calls[i-1].Meta.ID, p.Calls[i].Meta.ID}] = true
+			if n == 3 && i >= 2 {
+				seen[[3]int{p.Calls[i-2].Meta.ID, p.Calls[i-1].Meta.ID, p.Calls[i].Meta.ID}] = true
+			}
+		}
+		for key := range seen {
+			t.counts[key]++
+		}
+	}
+	for key, count := range t.counts {
+		if key[0] == -1 && count > t.max2 {
+			t.max2 = count
+		}
+		if key[0] != -1 && count > t.max3 {
+			t.max3 = count
+		}
+	}
+	return t
+}
+
+// apply raises prios of frequent n-grams in proportion to their frequency.
+// The choice table picks the next call based on a random earlier call of the program,
+// so bigram a,b raises prios[a][b] and trigram a,b,c raises prios[a][c]
+// which makes c more likely to follow the a,b bigram.
+func (t *ngramTable) apply(prios [][]float32, weight float64) {
+	for key, count := range t.counts {
+		if count < ngramMinCount {
+			continue
+		}
+		if key[0] == -1 {
+			prios[key[1]][key[2]] *= float32(1 + weight*float64(count)/float64(t.max2))
+		} else {
+			prios[key[0]][key[2]] *= float32(1 + weight*float64(count)/float64(t.max3))
+		}
+	}
+}
+
+// top returns the n most frequent n-grams, one per line.
+func (t *ngramTable) top(n int) string {
+	var keys [][3]int
+	for key, count := range t.counts {
+		if count >= ngramMinCount {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if t.counts[keys[i]] != t.counts[keys[j]] {
+			return t.counts[keys[i]] > t.counts[keys[j]]
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	buf := new(strings.Builder)
+	for _, key := range keys {
+		var names []string
+		for _, id := range key {
+			if id != -1 {
+				names = append(names, t.target.Syscalls[id].Name)
+			}
+		}
+		fmt.Fprintf(buf, "%6v/%v %v\n", t.counts[key], t.nprogs, strings.Join(names, " -> "))
+	}
+	return buf.String()
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/oob/targets"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagOOB = flag.Bool("oob", false, "collect distinct out-of-bounds access sites reported in executor output")
+
+	oobMu    sync.Mutex
+	oobSites = make(map[string]int)
+
+	oobBugRe    = regexp.MustCompile(`BUG: KASAN: ([a-z-]*out-of-bounds) in (\S+)`)
+	oobAccessRe = regexp.MustCompile(`(Read|Write) of size (\d+) at addr`)
+	oobCacheRe  = regexp.MustCompile(`belongs to the cache (\S+) of size (\d+)`)
+	oobRightRe  = regexp.MustCompile(`located (\d+) bytes to the right of\s+(\d+)-byte region`)
+	kernelRe    = regexp.MustCompile(`(?i)tainted:?[ A-Z]*? (\d+\.\d+)`)
+
+	// oobFilter, if set, selects reports that are taken into account.
+	oobFilter *regexp.Regexp
+)
+
+// parseOOB extracts out-of-bounds access sites from KASAN reports in output.
+// A site is identified by the bug type, access type, faulting PC and the accessed object cache.
+func parseOOB(output []byte) []string {
+	var sites []string
+	bugs := oobBugRe.FindAllSubmatchIndex(output, -1)
+	for i, bug := range bugs {
+		end := len(output)
+		if i+1 < len(bugs) {
+			end = bugs[i+1][0]
+		}
+		rep := output[bug[0]:end]
+		if oobFilter != nil && !oobFilter.Match(rep) {
+			continue
+		}
+		access := "access"
+		if m := oobAccessRe.FindSubmatch(rep); m != nil {
+			access = fmt.Sprintf("%s of size %s", m[1], m[2])
+		}
+		cache := "unknown cache"
+		if m := oobCacheRe.FindSubmatch(rep); m != nil {
+			cache = string(m[1])
+		}
+		sites = append(sites, fmt.Sprintf("%s %v in %s (%v)",
+			output[bug[2]:bug[3]], access, output[bug[4]:bug[5]], cache))
+	}
+	return sites
+}
+
+// handleOOB accounts OOB sites found in output. crashed is set if the program was
+// already handled as a crash, then the sites are attached to the saved artifact
+// (see saveCrash) and the program is not saved again. Otherwise the program is saved
+// for the first new site.
+func handleOOB(p *prog.Prog, output []byte, crashed bool) {
+	var newSite string
+	for _, site := range parseOOB(output) {
+		oobMu.Lock()
+		oobSites[site]++
+		first := oobSites[site] == 1
+		oobMu.Unlock()
+		if !first {
+			continue
+		}
+		log.Logf(0, "new OOB site: %v", site)
+		if newSite == "" {
+			newSite = site
+		}
+	}
+	if newSite != "" && !crashed && *flagCrashdir != "" {
+		saveCrash(p, output, "OOB: "+newSite)
+	}
+}
+
+// parseCapability extracts the out-of-bounds access capability from the first KASAN
+// report in output that accesses memory past the end of a slab object.
+func parseCapability(output []byte) (targets.Capability, bool) {
+	var c targets.Capability
+	bug := oobBugRe.FindIndex(output)
+	if bug == nil {
+		return c, false
+	}
+	rep := output[bug[0]:]
+	access := oobAccessRe.FindSubmatch(rep)
+	right := oobRightRe.FindSubmatch(rep)
+	cache := oobCacheRe.FindSubmatch(rep)
+	if access == nil || right == nil || cache == nil {
+		return c, false
+	}
+	c.Write = string(access[1]) == "Write"
+	c.Size, _ = strconv.Atoi(string(access[2]))
+	c.Cache = string(cache[1])
+	c.CacheSize, _ = strconv.Atoi(string(cache[2]))
+	past, _ := strconv.Atoi(string(right[1]))
+	region, _ := strconv.Atoi(string(right[2]))
+	c.Offset = region + past - c.CacheSize
+	if m := kernelRe.FindSubmatch(output); m != nil {
+		c.Kernel = string(m[1])
+	}
+	return c, true
+}
+
+func oobSiteCount() int {
+	oobMu.Lock()
+	defer oobMu.Unlock()
+	return len(oobSites)
+}
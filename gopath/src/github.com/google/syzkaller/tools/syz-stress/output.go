@@ -0,0 +1,35 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	flagOutputTo = flag.String("output-to", "stdout",
+		"where executed programs and executor output are written: stdout, stderr or a file path\n"+
+			"(the file is appended to, the summary is always printed to stdout)")
+
+	// progOutput receives program dumps and executor output.
+	progOutput io.Writer = os.Stdout
+)
+
+func initOutput() error {
+	switch *flagOutputTo {
+	case "stdout", "":
+	case "stderr":
+		progOutput = os.Stderr
+	default:
+		f, err := os.OpenFile(*flagOutputTo, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open -output-to file: %v", err)
+		}
+		progOutput = f
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+)
+
+// The group is executed as a single program (see prog.Group), so the setup calls run
+// before every attack mutant: ipc runs each program in a fresh process forked by the executor.
+var flagPair = flag.String("pair", "", "file with a setup+attack program group, only the attack part is mutated")
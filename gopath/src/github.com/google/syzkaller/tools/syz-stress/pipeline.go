@@ -0,0 +1,73 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"math/rand"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagGenProcs  = flag.Int("genprocs", 0, "number of goroutines generating programs (default -procs), enables generation/execution pipeline")
+	flagExecProcs = flag.Int("execprocs", 0, "number of processes executing programs (default -procs), enables generation/execution pipeline")
+)
+
+// execJob is a program passed from a generator to an executor.
+type execJob struct {
+	p         *prog.Prog
+	corpusIdx int
+	lineage   []byte
+}
+
+// numExecProcs returns the number of executing procs per target.
+func numExecProcs() int {
+	if *flagExecProcs != 0 {
+		return *flagExecProcs
+	}
+	return *flagProcs
+}
+
+// startProcs starts n procs with pids starting at pid0 for ft. By default every proc
+// both generates and executes programs. If -genprocs or -execprocs is given,
+// generation and execution are decoupled: generators pass programs to the executing
+// procs over a bounded channel.
+func startProcs(ft *fuzzTarget, pid0, n int) {
+	if *flagGenProcs == 0 && *flagExecProcs == 0 {
+		for pid := pid0; pid < pid0+n; pid++ {
+			go newProc(ft, pid).loop()
+		}
+		return
+	}
+	genProcs := *flagGenProcs
+	if genProcs == 0 {
+		genProcs = *flagProcs
+	}
+	jobs := make(chan execJob, 2*n)
+	for i := 0; i < genProcs; i++ {
+		// Negative ids give generators seeds different from the executing procs.
+		rs := newRandSource(-1 - pid0 - i)
+		go ft.produce(rs, jobs)
+	}
+	for pid := pid0; pid < pid0+n; pid++ {
+		go newProc(ft, pid).consume(jobs)
+	}
+}
+
+func (ft *fuzzTarget) produce(rs rand.Source, jobs chan<- execJob) {
+	rnd := rand.New(rs)
+	send := func(p *prog.Prog, corpusIdx int, lin []byte) {
+		jobs <- execJob{p.Clone(), corpusIdx, lin}
+	}
+	for i := 0; ; i++ {
+		ft.fuzzStep(i, rnd, send)
+	}
+}
+
+func (proc *proc) consume(jobs <-chan execJob) {
+	for job := range jobs {
+		proc.executeAndReward(job.p, job.corpusIdx, job.lineage)
+	}
+}
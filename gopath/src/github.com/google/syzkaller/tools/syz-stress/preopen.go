@@ -0,0 +1,129 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// flagPreopen lists files opened before fuzzing. They are not ipc-level external resources:
+// ipc has no way to register resources with the executor, and pkg/ipc and the executor
+// are not part of this tree. Instead the files are opened at fixed fds without close-on-exec,
+// so every executor inherits them, and programs refer to them by fd number (see usePreopenFds).
+// The executor does not know about them, e.g. they are not reset between programs.
+var flagPreopen stringList
+
+func init() {
+	flag.Var(&flagPreopen, "preopen", "path:flags (e.g. /dev/kvm:rdwr), open the file so that executors inherit it "+
+		"at fd 200 and up and let programs use the fd, flags are |-separated rdonly, wronly, rdwr, nonblock "+
+		"(can be repeated)")
+}
+
+const (
+	// Preopened files are inherited by executors at fds starting from preopenFdBase.
+	// The executor uses 3 and 4 for shmem, kCoverFd..kMaxFd-1 (232..249) for
+	// coverage and control pipes, and close_fds in the executor closes 3..29
+	// between programs. So 200..231 is the only range that neither collides with
+	// executor-owned fds nor is closed under the program. Any other fd inherited
+	// from our parent is marked close-on-exec by initPreopen.
+	preopenFdBase = 200
+	maxPreopen    = 32
+	// Probability to replace an fd argument that does not refer to another call with a preopened fd.
+	preopenProb = 0.25
+)
+
+// preopenFds are fds of preopened files.
+var preopenFds []uint64
+
+func initPreopen() error {
+	if len(flagPreopen) > maxPreopen {
+		return fmt.Errorf("too many -preopen files, at most %v are supported", maxPreopen)
+	}
+	for i, spec := range flagPreopen {
+		colon := strings.LastIndexByte(spec, ':')
+		if colon <= 0 {
+			return fmt.Errorf("bad -preopen %q, want path:flags", spec)
+		}
+		file := spec[:colon]
+		mode, err := parseOpenFlags(spec[colon+1:])
+		if err != nil {
+			return fmt.Errorf("bad -preopen %q: %v", spec, err)
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("bad -preopen %q: %v", spec, err)
+		}
+		fd := preopenFdBase + i
+		if err := openInherited(file, mode, fd); err != nil {
+			return fmt.Errorf("failed to preopen %v: %v", file, err)
+		}
+		log.Logf(0, "preopened %v as fd %v", file, fd)
+		preopenFds = append(preopenFds, uint64(fd))
+	}
+	if len(preopenFds) != 0 {
+		keep := make(map[int]bool)
+		for _, fd := range preopenFds {
+			keep[int(fd)] = true
+		}
+		if err := closeInheritedFds(keep); err != nil {
+			return fmt.Errorf("failed to close inherited fds: %v", err)
+		}
+	}
+	return nil
+}
+
+func parseOpenFlags(s string) (int, error) {
+	mode := 0
+	for _, f := range strings.Split(s, "|") {
+		switch f {
+		case "rdonly":
+			mode |= syscall.O_RDONLY
+		case "wronly":
+			mode |= syscall.O_WRONLY
+		case "rdwr":
+			mode |= syscall.O_RDWR
+		case "nonblock":
+			mode |= syscall.O_NONBLOCK
+		default:
+			return 0, fmt.Errorf("unknown flag %q", f)
+		}
+	}
+	return mode, nil
+}
+
+// usePreopenFds randomly replaces fd arguments of p that use a special value
+// (rather than a result of another call) with preopened fds.
+func usePreopenFds(p *prog.Prog, rnd *rand.Rand) {
+	for _, c := range p.Calls {
+		prog.ForeachArg(c, func(arg prog.Arg, _ *prog.ArgCtx) {
+			res, ok := arg.(*prog.ResultArg)
+			if !ok || res.Res != nil || res.Type().Dir() == prog.DirOut {
+				return
+			}
+			typ, ok := res.Type().(*prog.ResourceType)
+			if !ok || len(typ.Desc.Kind) == 0 || typ.Desc.Kind[0] != "fd" || rnd.Float64() >= preopenProb {
+				return
+			}
+			res.Val = preopenFds[rnd.Intn(len(preopenFds))]
+		})
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"syscall"
+)
+
+// openInherited opens file as fd without O_CLOEXEC, so that executors inherit it.
+func openInherited(file string, mode, fd int) error {
+	tmp, err := syscall.Open(file, mode, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(tmp)
+	return syscall.Dup3(tmp, fd, 0)
+}
+
+// closeInheritedFds marks all fds above stderr except keep as close-on-exec,
+// so that executors see only preopened files and the fds ipc passes explicitly.
+// Fds opened by Go are already close-on-exec, this catches fds leaked by our parent.
+func closeInheritedFds(keep map[int]bool) error {
+	entries, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return err
+	}
+	for _, ent := range entries {
+		fd, err := strconv.Atoi(ent.Name())
+		if err != nil || fd <= 2 || keep[fd] {
+			continue
+		}
+		// The fd used to read the directory is already closed, ignore EBADF.
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD,
+			syscall.FD_CLOEXEC); errno != 0 && errno != syscall.EBADF {
+			return errno
+		}
+	}
+	return nil
+}
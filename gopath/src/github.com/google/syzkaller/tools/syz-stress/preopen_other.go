@@ -0,0 +1,19 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+func openInherited(file string, mode, fd int) error {
+	return fmt.Errorf("-preopen is supported only on linux")
+}
+
+func closeInheritedFds(keep map[int]bool) error {
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var flagPrewarm = flag.Bool("prewarm", false, "load the executor binary into the page cache and lock it there "+
+	"before starting procs, so that the first executions on a cold machine are not slowed down")
+
+// prewarmExecutor maps the executor binary and locks its pages in memory, which faults them in.
+// The mapping is never unmapped, so the pages stay resident for the lifetime of syz-stress.
+// If locking is not permitted (RLIMIT_MEMLOCK), the file is only read into the page cache.
+func prewarmExecutor(bin string) {
+	if bin == "" {
+		log.Logf(0, "warning: -prewarm: executor binary is not set in the config, skipping")
+		return
+	}
+	file := bin
+	if !strings.Contains(bin, "/") {
+		var err error
+		if file, err = exec.LookPath(bin); err != nil {
+			log.Logf(0, "warning: -prewarm: can't resolve executor binary %v: %v", bin, err)
+			return
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		log.Logf(0, "warning: -prewarm: %v", err)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		log.Logf(0, "warning: -prewarm: %v", err)
+		return
+	}
+	if st.Size() == 0 {
+		log.Logf(0, "warning: -prewarm: executor binary %v is empty, skipping", file)
+		return
+	}
+	mem, err := syscall.Mmap(int(f.Fd()), 0, int(st.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		log.Logf(0, "warning: -prewarm: failed to map %v: %v", file, err)
+		return
+	}
+	locked := "locked"
+	if err := mlock(mem); err != nil {
+		syscall.Munmap(mem)
+		if _, err := io.Copy(ioutil.Discard, f); err != nil {
+			log.Logf(0, "warning: -prewarm: failed to read %v: %v", file, err)
+			return
+		}
+		locked = "not locked: " + err.Error()
+	}
+	log.Logf(0, "prewarmed executor %v (%v KB, %v)", file, st.Size()>>10, locked)
+}
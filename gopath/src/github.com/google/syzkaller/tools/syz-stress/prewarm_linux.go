@@ -0,0 +1,12 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"syscall"
+)
+
+func mlock(b []byte) error {
+	return syscall.Mlock(b)
+}
@@ -0,0 +1,416 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagMutateWithCorpus = flag.Bool("mutate-with-corpus", true, "pass corpus to mutation as context for splicing")
+
+// proc is a single fuzzing worker with its own execution environment.
+type proc struct {
+	*fuzzTarget
+	pid          int
+	env          executor
+	rs           rand.Source
+	rnd          *rand.Rand
+	hookFailures int // number of consecutive hook failures
+	// hookExecutor is the cached executor process whose namespaces hooks enter.
+	hookExecutor *executorProc
+	collapse     collapseDetector
+	// heartbeat is the time the proc started the current execution (UnixNano),
+	// or 0 if it's not executing anything. It's updated atomically.
+	heartbeat int64
+	// stuck is set by the worker watchdog if it killed the executor of the proc.
+	stuck uint32
+	// Per-syscall number of executions by this proc, maintained only for -coverage-matrix.
+	callExecs []uint64
+	// lastCrashed/lastHanged are set if the last executed program crashed/hanged.
+	lastCrashed bool
+	lastHanged  bool
+	// workspaceGen is the last seen value of global workspaceGen.
+	workspaceGen uint64
+	// recycleWorkdir is set atomically if the working directory of the executor exceeds -workdir-quota.
+	recycleWorkdir uint32
+	// longTimeout is set if -timeout-jitter chose a timeout above the configured one
+	// for the last execution.
+	longTimeout bool
+	// execBuf is used to check that programs fit into the executor input region.
+	execBuf []byte
+	// execs is the number of programs executed by this proc.
+	execs uint64
+}
+
+// executor is the part of ipc.Env used by procs.
+type executor interface {
+	Exec(opts *ipc.ExecOpts, p *prog.Prog) (output []byte, info *ipc.ProgInfo, hanged bool, err error)
+	Close() error
+}
+
+// makeEnv creates the execution environment of a proc, it's set from RunConfig.MakeEnv.
+var makeEnv = makeIPCEnv
+
+func makeIPCEnv(config *ipc.Config, pid int) (executor, error) {
+	env, err := ipc.MakeEnv(config, pid)
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func newProc(ft *fuzzTarget, pid int) *proc {
+	env, err := makeEnv(jitterConfig(ft.config), pid)
+	if err != nil {
+		dumpInflight()
+		log.Fatalf("failed to create execution environment: %v", err)
+	}
+	rs := newRandSource(pid)
+	proc := &proc{
+		fuzzTarget: ft,
+		pid:        pid,
+		env:        env,
+		rs:         rs,
+		rnd:        rand.New(rs),
+		collapse: collapseDetector{
+			enabled: *flagCollapseFraction != 0 && ft.config.Flags&ipc.FlagSignal != 0,
+		},
+	}
+	if *flagCoverageMatrix != "" {
+		proc.callExecs = make([]uint64, len(ft.target.Syscalls))
+	}
+	registerWorker(proc)
+	proc.runInitPrograms()
+	return proc
+}
+
+func newRandSource(id int) rand.Source {
+	return rand.NewSource(shardSeed(time.Now().UnixNano() + int64(id)*1e12))
+}
+
+func (proc *proc) loop() {
+	for i := 0; ; i++ {
+		proc.fuzzStep(i, proc.rnd, proc.executeAndReward)
+		proc.hookBackoff()
+	}
+}
+
+// fuzzStep generates or mutates the next few programs and passes each of them to exec
+// along with the index of the corpus program it is derived from (-1 if none) and,
+// with -lineage, serializations of all steps that led to the program.
+// The program may be changed after exec returns.
+func (ft *fuzzTarget) fuzzStep(i int, rnd *rand.Rand, exec func(p *prog.Prog, corpusIdx int, lin []byte)) {
+	ct, corpus := ft.choiceTable(), ft.getCorpus()
+	// Corpus passed to Mutate as context for splicing.
+	mutateCorpus := corpus
+	if !*flagMutateWithCorpus {
+		mutateCorpus = nil
+	}
+	mutate := func(p *prog.Prog) bool {
+		return guardGen("mutation", rnd.Int63(), p, func(rs rand.Source) {
+			p.Mutate(rs, progLen(), ct, mutateCorpus)
+		})
+	}
+	var lin lineage
+	if ft.pair != nil {
+		g := ft.pair.Clone()
+		if guardGen("pair mutation", rnd.Int63(), g.Prog, func(rs rand.Source) {
+			g.Mutate(rs, progLen(), ct, mutateCorpus)
+		}) {
+			lin.add(ft.pair.Prog, "-pair program")
+			exec(g.Prog, -1, lin.add(g.Prog, "mutation"))
+		}
+		return
+	}
+	if !ft.mutateOnly && (*flagGenerate && len(corpus) == 0 || i%4 != 0) {
+		var p *prog.Prog
+		if !guardGen("generation", rnd.Int63(), nil, func(rs rand.Source) {
+			p = ft.generate(rs)
+		}) {
+			return
+		}
+		if p == nil {
+			atomic.AddUint64(&statGenFail, 1)
+			return
+		}
+		if seenFilter != nil && seenBefore(p, rnd) {
+			return
+		}
+		exec(p, -1, lin.add(p, "generated"))
+		if mutate(p) {
+			exec(p, -1, lin.add(p, "mutation 1"))
+		}
+	} else {
+		idx := ft.chooseCorpus(rnd, corpus)
+		p := corpus[idx].Clone()
+		lin.add(p, corpusOrigin(corpus[idx], idx))
+		if *flagSplice != 0 && rnd.Float64() < *flagSplice {
+			idx2 := ft.chooseCorpus(rnd, corpus)
+			lin.add(corpus[idx2], corpusOrigin(corpus[idx2], idx2))
+			sp := ft.spliceProgs(p, corpus[idx2], rnd)
+			if sp == nil || *flagSpliceResources == "regenerate" && !mutate(sp) {
+				return
+			}
+			exec(sp, idx, lin.add(sp, "splice"))
+			return
+		}
+		if !mutate(p) {
+			return
+		}
+		exec(p, idx, lin.add(p, "mutation 1"))
+		if mutate(p) {
+			exec(p, idx, lin.add(p, "mutation 2"))
+		}
+	}
+}
+
+// guardGen runs a generation or mutation step f with a random source created from seed.
+// If f panics, it logs the seed and the program being mutated (if any) for reproduction
+// and returns false.
+func guardGen(what string, seed int64, p *prog.Prog, f func(rs rand.Source)) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&statGenFail, 1)
+			log.Logf(0, "%v failed with seed %v: %v\n%s\nprogram:\n%s", what, seed, r, debug.Stack(), safeSerialize(p))
+			ok = false
+		}
+	}()
+	f(rand.NewSource(seed))
+	return true
+}
+
+// safeSerialize serializes p that may be left inconsistent by a failed mutation.
+func safeSerialize(p *prog.Prog) (data []byte) {
+	if p == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			data = []byte(fmt.Sprintf("failed to serialize: %v", r))
+		}
+	}()
+	return p.Serialize()
+}
+
+// executeAndReward executes the program and rewards the corpus program it is derived from.
+func (proc *proc) executeAndReward(p *prog.Prog, corpusIdx int, lin []byte) {
+	if proc.hooksFailing() {
+		// The rest of the fuzzing step is skipped, the proc backs off after it.
+		return
+	}
+	if lin != nil {
+		lineages.Store(p, lin)
+		defer lineages.Delete(p)
+	}
+	if err := proc.truncate(p); err != nil {
+		// The program was not executed, this is not an executor failure.
+		if atomic.AddUint64(&statTooLarge, 1) == 1 {
+			log.Logf(0, "proc %v: %v, such programs are skipped", proc.pid, err)
+		}
+		return
+	}
+	if hangRules != nil {
+		avoidHangs(p)
+	}
+	if preopenFds != nil {
+		usePreopenFds(p, proc.rnd)
+	}
+	var sig hash.Sig
+	if dedup != nil {
+		if sig = hash.Hash(p.Serialize()); dedup.skip(sig) {
+			return
+		}
+	}
+	proc.checkWorkspace()
+	waitBurst()
+	acquireExec()
+	if memGate != nil {
+		defer memGate.release(memGate.acquire(progMemEstimate(p)))
+	}
+	holdPause()
+	enterExec()
+	proc.beat()
+	newSignal := proc.execute(p)
+	if *flagSaveCorpus && newSignal != 0 && !proc.lastCrashed && !proc.lastHanged {
+		// p may be changed by the caller after it returns.
+		proc.addCorpus(p.Clone())
+	}
+	if dedup != nil {
+		class := resultClean
+		if proc.lastHanged {
+			class = resultHang
+		} else if proc.lastCrashed {
+			class = resultCrash
+		}
+		dedup.add(sig, class)
+	}
+	if *flagHotArgs != 0 && proc.rnd.Float64() < *flagHotArgs {
+		proc.probeHotArgs(p)
+	}
+	if diffFlag != 0 {
+		proc.diffExec(p)
+	}
+	if flushFiles != nil {
+		flushQuarantine()
+	}
+	proc.idle()
+	leaveExec()
+	releasePause()
+	releaseExec()
+	if corpusIdx >= 0 && proc.sched != nil {
+		proc.sched.reward(corpusIdx, newSignal)
+	}
+}
+
+// isBrokenPipe returns true if err is caused by writing to a pipe of a dead executor.
+// ipc does not wrap errors, so the error is recognized by its text.
+func isBrokenPipe(err error) bool {
+	return err != nil && strings.Contains(err.Error(), syscall.EPIPE.Error())
+}
+
+// recycleEnv replaces the execution environment with a fresh one.
+func (proc *proc) recycleEnv() {
+	if err := proc.env.Close(); err != nil {
+		log.Logf(0, "proc %v: failed to close execution environment: %v", proc.pid, err)
+	}
+	proc.replaceEnv()
+}
+
+// replaceEnv creates a new execution environment without closing the old one.
+func (proc *proc) replaceEnv() {
+	env, err := makeEnv(jitterConfig(proc.config), proc.pid)
+	if err != nil {
+		dumpInflight()
+		log.Fatalf("failed to create execution environment: %v", err)
+	}
+	proc.env = env
+	proc.runInitPrograms()
+}
+
+var outMu sync.Mutex
+
+// execute executes the program and returns the amount of new signal it produced.
+func (proc *proc) execute(p *prog.Prog) int {
+	pid := proc.pid
+	proc.lastCrashed, proc.lastHanged = false, false
+	if *flagValidate {
+		if err := validateProg(p); err != nil {
+			atomic.AddUint64(&statInvalid, 1)
+			log.Logf(0, "proc %v: skipping invalid program: %v\n%s", pid, err, p.Serialize())
+			return 0
+		}
+	}
+	atomic.AddUint64(&statExec, 1)
+	atomic.AddUint64(&proc.execs, 1)
+	if *flagLogProg {
+		ticket := gate.Enter()
+		defer gate.Leave(ticket)
+		outMu.Lock()
+		fmt.Fprintf(progOutput, "executing program %v\n%s\n", pid, p.Serialize())
+		outMu.Unlock()
+	}
+	proc.runHook(*flagPreCmd, p)
+	recordProg(p)
+	var data []byte
+	start := time.Now()
+	if lastProgs != nil {
+		data = p.Serialize()
+		startInflight(pid, data, start)
+	}
+	disarm := proc.armTimeout(proc.pickTimeout())
+	output, info, hanged, err := proc.env.Exec(proc.execOpts, p)
+	elapsed := time.Since(start)
+	timedOut := disarm()
+	if timedOut {
+		// The executor was killed when the jittered timeout expired.
+		hanged, err = true, nil
+	}
+	if lastProgs != nil {
+		finishInflight(pid, p, data, start)
+		if *flagSaveConcurrent {
+			defer concurrentSets.Delete(p)
+		}
+	}
+	stats := p.Stats()
+	accountProgStats(stats)
+	recordExecTime(stats.Calls, elapsed)
+	recordProgLen(stats.Calls)
+	checkSlowProg(p, elapsed)
+	recycled := false
+	if atomic.LoadUint32(&proc.stuck) != 0 {
+		// The worker watchdog has killed the executor. The Env is closed only now
+		// that Exec has returned and no longer uses its shared memory.
+		proc.recycleEnv()
+		recycled = true
+		atomic.StoreUint32(&proc.stuck, 0)
+	}
+	if timedOut && !recycled {
+		proc.recycleEnv()
+		recycled = true
+	}
+	proc.accountCalls(p, info)
+	if proc.callExecs != nil {
+		for _, c := range p.Calls {
+			atomic.AddUint64(&proc.callExecs[c.Meta.ID], 1)
+		}
+	}
+	proc.runHook(*flagPostCmd, p)
+	if err != nil {
+		atomic.AddUint64(&statExecErrors, 1)
+		fmt.Fprintf(progOutput, "failed to execute executor: %v\n", err)
+		if coresDir != "" {
+			collectCores(p)
+		}
+	}
+	if hanged && *flagHangRetries != 0 {
+		var retryErr error
+		if hanged, retryErr = proc.confirmHang(p); retryErr != nil {
+			atomic.AddUint64(&statExecErrors, 1)
+			fmt.Fprintf(progOutput, "failed to execute executor on hang retry: %v\n", retryErr)
+			err = retryErr
+		}
+	}
+	if hanged {
+		atomic.AddUint64(&statHangs, 1)
+	}
+	if isBrokenPipe(err) && !recycled {
+		// The executor died mid-write, start from a clean environment.
+		proc.recycleEnv()
+	}
+	crashed, title := handleResultTitle(p, output, hanged, err)
+	if streamListener != nil {
+		streamResult(pid, p, crashed, hanged, err, title)
+	}
+	proc.lastCrashed = crashed
+	proc.lastHanged = hanged
+	proc.accountJitter(crashed)
+	if *flagOOB {
+		handleOOB(p, output, crashed)
+	}
+	if crashed || *flagOutput && !*flagQuiet || watchedCalls != nil && watched(p) {
+		fmt.Fprintf(progOutput, "PROGRAM:\n%s%s\n", runIDComment(), p.Serialize())
+		progOutput.Write(output)
+	}
+	if proc.collapse.enabled && proc.collapse.add(progSignal(info)) {
+		proc.handleCollapse()
+	}
+	newSignal := addSignal(info)
+	if adaptive != nil {
+		adaptive.add(stats.Calls, newSignal, crashed)
+	}
+	return newSignal
+}
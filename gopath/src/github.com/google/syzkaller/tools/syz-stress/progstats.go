@@ -0,0 +1,41 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/prog"
+)
+
+// Totals of prog.Stats over all executed programs.
+var progStatsTotal struct {
+	n, calls, size, resources, blobBytes, depth uint64
+}
+
+func accountProgStats(st prog.Stats) {
+	t := &progStatsTotal
+	atomic.AddUint64(&t.n, 1)
+	atomic.AddUint64(&t.calls, uint64(st.Calls))
+	atomic.AddUint64(&t.size, uint64(st.Size))
+	atomic.AddUint64(&t.resources, uint64(st.Resources))
+	atomic.AddUint64(&t.blobBytes, uint64(st.BlobBytes))
+	atomic.AddUint64(&t.depth, uint64(st.Depth))
+}
+
+// progStatsSummary returns averages of program metrics over all executed programs.
+func progStatsSummary() string {
+	t := &progStatsTotal
+	n := float64(atomic.LoadUint64(&t.n))
+	if n == 0 {
+		return ""
+	}
+	avg := func(v *uint64) float64 {
+		return float64(atomic.LoadUint64(v)) / n
+	}
+	return fmt.Sprintf("average program: %.1f calls, %.0f bytes serialized, %.1f resources,"+
+		" %.0f blob bytes, nesting depth %.1f\n",
+		avg(&t.calls), avg(&t.size), avg(&t.resources), avg(&t.blobBytes), avg(&t.depth))
+}
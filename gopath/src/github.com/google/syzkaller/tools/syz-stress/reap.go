@@ -0,0 +1,55 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagReapInterval = flag.Duration("reap-interval", 0, "periodically pause execution and clean up kernel "+
+		"resources leaked by executors: stale mounts, loop devices and stray processes (0 - disabled)")
+
+	statReapedMounts uint64
+	statReapedLoops  uint64
+	statReapedProcs  uint64
+)
+
+// reapResult is the number of resources released by a single reap pass.
+type reapResult struct {
+	mounts int
+	loops  int
+	procs  int
+}
+
+func startReaper(interval time.Duration) error {
+	if interval < 0 {
+		return fmt.Errorf("bad -reap-interval %v", interval)
+	}
+	if err := checkReap(); err != nil {
+		return err
+	}
+	go func() {
+		for range time.NewTicker(interval).C {
+			start := time.Now()
+			var res reapResult
+			betweenExecs(func() {
+				res = reapHost()
+			})
+			atomic.AddUint64(&statReapedMounts, uint64(res.mounts))
+			atomic.AddUint64(&statReapedLoops, uint64(res.loops))
+			atomic.AddUint64(&statReapedProcs, uint64(res.procs))
+			if res != (reapResult{}) {
+				log.Logf(0, "reaped %v mounts, %v loop devices, %v processes in %v",
+					res.mounts, res.loops, res.procs, time.Since(start).Round(time.Millisecond))
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+const (
+	// Executors create per-proc cgroups syz0, syz1, ... under each of the controllers mounted here.
+	reapCgroupRoot = "/syzcgroup"
+	// syz_mount_image attaches loop devices to memfds with this name.
+	reapLoopBacking = "syzkaller"
+	loopClrFd       = 0x4c01 // LOOP_CLR_FD
+)
+
+func checkReap() error {
+	if os.Getuid() != 0 {
+		return fmt.Errorf("-reap-interval requires root")
+	}
+	return nil
+}
+
+// reapHost releases kernel resources that executors leaked. It runs while no program executes,
+// so anything left in the executor working directories and cgroups is stale.
+func reapHost() reapResult {
+	return reapResult{
+		mounts: reapMounts(),
+		loops:  reapLoops(),
+		procs:  reapProcs(),
+	}
+}
+
+// reapMounts lazily unmounts everything mounted inside executor working directories,
+// such mounts also prevent removal of the directories when executors are recycled.
+func reapMounts() int {
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Logf(1, "reap: %v", err)
+		return 0
+	}
+	data, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		log.Logf(1, "reap: %v", err)
+		return 0
+	}
+	var stale []string
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mnt := unescapeMountPath(fields[4])
+		rel, err := filepath.Rel(cwd, mnt)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if ok, _ := filepath.Match(workdirPattern, strings.Split(rel, string(filepath.Separator))[0]); ok {
+			stale = append(stale, mnt)
+		}
+	}
+	// Unmount nested mounts first.
+	sort.Slice(stale, func(i, j int) bool {
+		return len(stale[i]) > len(stale[j])
+	})
+	reaped := 0
+	for _, mnt := range stale {
+		if err := syscall.Unmount(mnt, syscall.MNT_DETACH); err != nil {
+			log.Logf(1, "reap: failed to unmount %v: %v", mnt, err)
+			continue
+		}
+		log.Logf(1, "reap: unmounted %v", mnt)
+		reaped++
+	}
+	return reaped
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space etc) used in mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	buf := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				buf.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// reapLoops detaches loop devices that are still attached to syz_mount_image memfds.
+// Devices that are still mounted are only marked for autoclear by the kernel and are not counted.
+func reapLoops() int {
+	files, _ := filepath.Glob("/sys/block/loop*/loop/backing_file")
+	reaped := 0
+	for _, file := range files {
+		backing, err := ioutil.ReadFile(file)
+		if err != nil || !bytes.Contains(backing, []byte(reapLoopBacking)) {
+			continue
+		}
+		dev := filepath.Join("/dev", filepath.Base(filepath.Dir(filepath.Dir(file))))
+		f, err := os.Open(dev)
+		if err != nil {
+			log.Logf(1, "reap: %v", err)
+			continue
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), loopClrFd, 0)
+		f.Close()
+		if errno != 0 {
+			log.Logf(1, "reap: failed to detach %v: %v", dev, errno)
+			continue
+		}
+		log.Logf(1, "reap: detached %v from %s", dev, bytes.TrimSpace(backing))
+		reaped++
+	}
+	return reaped
+}
+
+// reapProcs kills orphaned processes in the executor cgroups. Executors themselves join
+// the cgroups too, but they are our children, while stray processes are reparented to init.
+func reapProcs() int {
+	files, _ := filepath.Glob(filepath.Join(reapCgroupRoot, "*", "syz*", "cgroup.procs"))
+	// A process is listed in the cgroups of all controllers.
+	killed := make(map[int]bool)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, str := range strings.Fields(string(data)) {
+			pid, err := strconv.Atoi(str)
+			if err != nil || killed[pid] || !isOrphan(pid) {
+				continue
+			}
+			if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+				continue
+			}
+			log.Logf(1, "reap: killed process %v in %v", pid, filepath.Dir(file))
+			killed[pid] = true
+		}
+	}
+	return len(killed)
+}
+
+func isOrphan(pid int) bool {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%v/status", pid))
+	if err != nil {
+		return false
+	}
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		if ppid := strings.TrimPrefix(s.Text(), "PPid:"); ppid != s.Text() {
+			return strings.TrimSpace(ppid) == "1"
+		}
+	}
+	return false
+}
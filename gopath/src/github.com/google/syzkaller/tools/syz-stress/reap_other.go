@@ -0,0 +1,19 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+func checkReap() error {
+	return fmt.Errorf("-reap-interval is supported only on linux")
+}
+
+func reapHost() reapResult {
+	return reapResult{}
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/ipc"
+)
+
+var flagCorpusRegression = flag.Bool("corpus-regression", false,
+	"execute every -corpus program once without mutation and exit with non-zero status if any crash or hang")
+
+// runCorpusRegression executes every corpus program exactly once and reports
+// programs that crash, hang or fail to execute. Indices refer to the corpus
+// sorted by database key, so they are stable across runs.
+// It returns the exit code for Run: 1 if any program regressed.
+func runCorpusRegression(ft *fuzzTarget) int {
+	gate = ipc.NewGate(2, nil)
+	proc := newProc(ft, 0)
+	var regressed []int
+	for i, p := range ft.corpus {
+		atomic.AddUint64(&statExec, 1)
+		output, _, hanged, err := proc.env.Exec(ft.execOpts, p)
+		if handleResult(p, output, hanged, err) {
+			regressed = append(regressed, i)
+			fmt.Fprintf(progOutput, "program %v regressed:\n%s\n", i, p.Serialize())
+			progOutput.Write(output)
+		}
+		if err != nil || hanged {
+			proc.recycleEnv()
+		}
+	}
+	if len(regressed) != 0 {
+		fmt.Printf("FAIL: %v/%v programs regressed: %v\n", len(regressed), len(ft.corpus), regressed)
+		return 1
+	}
+	fmt.Printf("PASS: %v programs\n", len(ft.corpus))
+	return 0
+}
@@ -0,0 +1,346 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagREPL = flag.Bool("repl", false, "read programs and commands from stdin interactively and exit (see repl.go)")
+
+// The REPL reads commands from stdin one per line. Any line that is not a command
+// starts a serialized program that continues up to an empty line and replaces the current one.
+// Arguments are selected with the -enumerate path syntax CALL.ARG[.FIELD]...,
+// where ARG and FIELDs can also be given by field name (e.g. 2.fd).
+const replHelp = `commands:
+  run                 execute the current program
+  mutate [N]          mutate the current program N times (default 1)
+  freeze PATH         keep the current value of the argument across mutations
+  unfreeze [PATH]     unfreeze the argument (all arguments if PATH is omitted)
+  enum PATH VALUES    execute the program with the argument set to VALUES (A..B, A,B,C or A|B|C)
+  show                print the current program
+  save FILE           write the current program to FILE
+  history             print previous commands
+  !N                  repeat command N from history
+  help                print this help
+  quit                exit
+`
+
+// Mutations that drop a frozen argument are retried this many times.
+const replMutateAttempts = 100
+
+type repl struct {
+	ft      *fuzzTarget
+	proc    *proc
+	in      *bufio.Scanner
+	out     io.Writer
+	p       *prog.Prog
+	frozen  []*frozenArg
+	history []string
+}
+
+// frozenArg is an argument that mutations must leave intact.
+type frozenArg struct {
+	spec *prog.ArgSpec
+	meta *prog.Syscall // call the argument belongs to, so that shifted calls are noticed
+	val  uint64
+}
+
+// runREPL runs the interactive mode, all programs are executed by a single proc.
+// p is the initial program (-seedprog), it may be nil.
+func runREPL(ft *fuzzTarget, p *prog.Prog) {
+	gate = ipc.NewGate(2, nil)
+	r := &repl{
+		ft:   ft,
+		proc: newProc(ft, 0),
+		in:   bufio.NewScanner(os.Stdin),
+		out:  os.Stdout,
+		p:    p,
+	}
+	r.in.Buffer(nil, 1<<20)
+	fmt.Fprintf(r.out, "syz-stress repl, type 'help' for the list of commands\n")
+	for r.prompt(); r.in.Scan(); r.prompt() {
+		line := strings.TrimSpace(r.in.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(r.history) {
+				fmt.Fprintf(r.out, "no command %v in history\n", line[1:])
+				continue
+			}
+			line = r.history[n-1]
+			fmt.Fprintf(r.out, "%v\n", line)
+		}
+		if !r.command(line) {
+			return
+		}
+	}
+	if err := r.in.Err(); err != nil {
+		log.Fatalf("failed to read stdin: %v", err)
+	}
+}
+
+func (r *repl) prompt() {
+	fmt.Fprintf(r.out, "> ")
+}
+
+// command executes a single input line and returns false if the REPL needs to exit.
+func (r *repl) command(line string) bool {
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+	var err error
+	switch cmd {
+	case "quit", "exit":
+		return false
+	case "help":
+		fmt.Fprint(r.out, replHelp)
+		return true
+	case "history":
+		for i, cmd := range r.history {
+			fmt.Fprintf(r.out, "%4v  %v\n", i+1, cmd)
+		}
+		return true
+	case "run", "mutate", "freeze", "unfreeze", "enum", "show", "save":
+		if r.p == nil {
+			err = fmt.Errorf("no program, paste a serialized program first")
+			break
+		}
+		switch cmd {
+		case "run":
+			r.run(r.p)
+		case "mutate":
+			err = r.mutate(args)
+		case "freeze":
+			err = r.freeze(args)
+		case "unfreeze":
+			err = r.unfreeze(args)
+		case "enum":
+			err = r.enumerate(args)
+		case "show":
+			fmt.Fprintf(r.out, "%s", r.p.Serialize())
+		case "save":
+			err = r.save(args)
+		}
+	default:
+		r.readProg(line)
+		return true
+	}
+	r.history = append(r.history, line)
+	if err != nil {
+		fmt.Fprintf(r.out, "%v: %v\n", cmd, err)
+	}
+	return true
+}
+
+// readProg reads a program that starts with line and replaces the current program if it parses.
+func (r *repl) readProg(line string) {
+	data := []byte(line + "\n")
+	for r.in.Scan() && strings.TrimSpace(r.in.Text()) != "" {
+		data = append(data, r.in.Text()...)
+		data = append(data, '\n')
+	}
+	p, err := r.ft.target.Deserialize(data, prog.Strict)
+	if err != nil {
+		fmt.Fprintf(r.out, "failed to parse program: %v\n", err)
+		return
+	}
+	if c := disabledCall(r.ft, p); c != "" {
+		fmt.Fprintf(r.out, "program uses disabled syscall %v\n", c)
+		return
+	}
+	r.p = p
+	r.frozen = nil
+	fmt.Fprintf(r.out, "loaded program with %v calls\n", len(p.Calls))
+}
+
+// run executes p and prints per-call results.
+func (r *repl) run(p *prog.Prog) bool {
+	atomic.AddUint64(&statExec, 1)
+	output, info, hanged, err := r.proc.env.Exec(r.ft.execOpts, p)
+	crashed := handleResult(p, output, hanged, err)
+	for i, c := range p.Calls {
+		fmt.Fprintf(r.out, "%3v %-40v ", i, c.Meta.Name)
+		if info == nil || i >= len(info.Calls) {
+			fmt.Fprintf(r.out, "no info\n")
+			continue
+		}
+		ci := &info.Calls[i]
+		fmt.Fprintf(r.out, "errno %-4v signal %-6v %v\n", ci.Errno, len(ci.Signal), callFlagsString(ci.Flags))
+	}
+	switch {
+	case crashed:
+		fmt.Fprintf(r.out, "crashed, output:\n%s\n", output)
+	case hanged:
+		fmt.Fprintf(r.out, "hanged\n")
+	case err != nil:
+		fmt.Fprintf(r.out, "executor failed: %v\n", err)
+	}
+	if err != nil || hanged {
+		r.proc.recycleEnv()
+	}
+	return crashed
+}
+
+func callFlagsString(flags ipc.CallFlags) string {
+	var res []string
+	for _, f := range []struct {
+		flag ipc.CallFlags
+		name string
+	}{
+		{ipc.CallExecuted, "executed"},
+		{ipc.CallFinished, "finished"},
+		{ipc.CallBlocked, "blocked"},
+		{ipc.CallFaultInjected, "fault-injected"},
+	} {
+		if flags&f.flag != 0 {
+			res = append(res, f.name)
+		}
+	}
+	if len(res) == 0 {
+		return "not executed"
+	}
+	return strings.Join(res, ",")
+}
+
+// mutate applies N mutations to the current program keeping frozen arguments intact.
+func (r *repl) mutate(args []string) error {
+	n := 1
+	if len(args) != 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			return fmt.Errorf("bad count %q", args[0])
+		}
+	}
+	ct := r.ft.choiceTable()
+	for i := 0; i < n; i++ {
+		var p *prog.Prog
+		for attempt := 0; p == nil; attempt++ {
+			if attempt == replMutateAttempts {
+				return fmt.Errorf("all %v mutations dropped a frozen argument", replMutateAttempts)
+			}
+			p = r.p.Clone()
+			if !guardGen("mutation", r.proc.rnd.Int63(), p, func(rs rand.Source) {
+				p.Mutate(rs, progLen(), ct, r.ft.getCorpus())
+			}) || !r.restoreFrozen(p) {
+				p = nil
+			}
+		}
+		r.p = p
+	}
+	fmt.Fprintf(r.out, "%s", r.p.Serialize())
+	return nil
+}
+
+// restoreFrozen sets frozen arguments of p to their frozen values,
+// it returns false if the mutation removed or moved any of them.
+func (r *repl) restoreFrozen(p *prog.Prog) bool {
+	for _, f := range r.frozen {
+		if f.spec.Call >= len(p.Calls) || p.Calls[f.spec.Call].Meta != f.meta {
+			return false
+		}
+		arg, err := f.spec.Resolve(p)
+		if err != nil {
+			return false
+		}
+		arg.Val = f.val
+	}
+	return true
+}
+
+func (r *repl) freeze(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: freeze PATH")
+	}
+	spec, err := prog.ParseArgPath(r.p, args[0])
+	if err != nil {
+		return err
+	}
+	arg, err := spec.Resolve(r.p)
+	if err != nil {
+		return err
+	}
+	r.unfreezePath(spec)
+	r.frozen = append(r.frozen, &frozenArg{
+		spec: spec,
+		meta: r.p.Calls[spec.Call].Meta,
+		val:  arg.Val,
+	})
+	fmt.Fprintf(r.out, "froze %v = %#x\n", spec.Spec, arg.Val)
+	return nil
+}
+
+func (r *repl) unfreeze(args []string) error {
+	if len(args) == 0 {
+		r.frozen = nil
+		return nil
+	}
+	spec, err := prog.ParseArgPath(r.p, args[0])
+	if err != nil {
+		return err
+	}
+	if !r.unfreezePath(spec) {
+		return fmt.Errorf("%v is not frozen", args[0])
+	}
+	return nil
+}
+
+// unfreezePath removes the frozen argument with the same path as spec and returns true if there was one.
+func (r *repl) unfreezePath(spec *prog.ArgSpec) bool {
+	for i, f := range r.frozen {
+		if f.spec.Call == spec.Call && fmt.Sprint(f.spec.Path) == fmt.Sprint(spec.Path) {
+			r.frozen = append(r.frozen[:i], r.frozen[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// enumerate executes all variants of the current program with the selected argument set to the given values.
+func (r *repl) enumerate(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: enum PATH VALUES")
+	}
+	spec, err := prog.ParseArgPath(r.p, args[0])
+	if err != nil {
+		return err
+	}
+	if err := spec.SetValues(args[1], *flagEnumerateLimit); err != nil {
+		return err
+	}
+	next, err := prog.EnumerateArgs(r.p, []*prog.ArgSpec{spec}, *flagEnumerateLimit)
+	if err != nil {
+		return err
+	}
+	var crashedVals []string
+	for variant, vals := next(); variant != nil; variant, vals = next() {
+		fmt.Fprintf(r.out, "%v = %#x:\n", spec.Spec, vals[0])
+		if r.run(variant) {
+			crashedVals = append(crashedVals, fmt.Sprintf("%#x", vals[0]))
+		}
+	}
+	fmt.Fprintf(r.out, "executed %v variants, crashing values: %v\n", len(spec.Vals), strings.Join(crashedVals, " "))
+	return nil
+}
+
+func (r *repl) save(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: save FILE")
+	}
+	return osutil.WriteFile(args[0], r.p.Serialize())
+}
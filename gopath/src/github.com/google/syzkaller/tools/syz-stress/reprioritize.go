@@ -0,0 +1,37 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var flagReprioritize = flag.Duration("reprioritize-interval", 0,
+	"periodically recompute call priorities over the current corpus and rebuild the choice table")
+
+// startReprioritize periodically rebuilds the choice table of ft from the current corpus.
+// Recomputation is skipped while the corpus does not change.
+func startReprioritize(ft *fuzzTarget, interval time.Duration) {
+	go func() {
+		last := atomic.LoadUint64(&ft.corpusVersion)
+		for range time.NewTicker(interval).C {
+			version := atomic.LoadUint64(&ft.corpusVersion)
+			if version == last {
+				continue
+			}
+			last = version
+			start := time.Now()
+			prios := ft.calculatePriorities()
+			ft.callsMu.Lock()
+			ft.ct.Store(ft.target.BuildChoiceTable(prios, ft.calls))
+			ft.callsMu.Unlock()
+			log.Logf(0, "%v/%v: rebuilt choice table for %v corpus programs in %v",
+				ft.target.OS, ft.target.Arch, len(ft.getCorpus()), time.Since(start))
+		}
+	}()
+}
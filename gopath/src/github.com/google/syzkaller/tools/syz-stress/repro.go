@@ -0,0 +1,76 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/google/syzkaller/pkg/csource"
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagReproBundle = flag.Bool("repro-bundle", false, "also save C reproducer variants for crashes to crashdir/<hash>/")
+
+	// reproOpts are the base C reproducer options matching the execution settings.
+	reproOpts csource.Options
+)
+
+// initReproOpts derives base reproducer options from the execution settings of ft.
+func initReproOpts(ft *fuzzTarget) {
+	flags := ft.config.Flags
+	opts := csource.Options{
+		Threaded:         ft.execOpts.Flags&ipc.FlagThreaded != 0,
+		Collide:          ft.execOpts.Flags&ipc.FlagCollide != 0,
+		Procs:            1,
+		Sandbox:          "none",
+		EnableTun:        flags&ipc.FlagEnableTun != 0,
+		EnableNetDev:     flags&ipc.FlagEnableNetDev != 0,
+		EnableNetReset:   flags&ipc.FlagEnableNetReset != 0,
+		EnableCgroups:    flags&ipc.FlagEnableCgroups != 0,
+		EnableBinfmtMisc: flags&ipc.FlagEnableBinfmtMisc != 0,
+		EnableCloseFds:   flags&ipc.FlagEnableCloseFds != 0,
+		UseTmpDir:        true,
+		HandleSegv:       true,
+		Repro:            true,
+	}
+	switch {
+	case flags&ipc.FlagSandboxSetuid != 0:
+		opts.Sandbox = "setuid"
+	case flags&ipc.FlagSandboxNamespace != 0:
+		opts.Sandbox = "namespace"
+	case flags&ipc.FlagSandboxAndroid != 0:
+		opts.Sandbox = "android"
+	}
+	reproOpts = opts
+}
+
+// writeReproBundle writes C reproducer variants for p to dir,
+// along with a README that lists the variants and the skipped ones.
+func writeReproBundle(p *prog.Prog, dir string) {
+	if err := osutil.MkdirAll(dir); err != nil {
+		log.Logf(0, "failed to create repro bundle dir: %v", err)
+		return
+	}
+	srcs, skipped := csource.WriteBundle(p, reproOpts)
+	readme := ""
+	for _, variant := range csource.BundleVariants {
+		if src := srcs[variant.Name]; src != nil {
+			readme += fmt.Sprintf("%v.c: %v\n", variant.Name, variant.Description)
+			if _, err := writeArtifact(filepath.Join(dir, variant.Name+".c"), src); err != nil {
+				log.Logf(0, "failed to save reproducer: %v", err)
+			}
+		} else {
+			readme += fmt.Sprintf("%v: skipped: %v\n", variant.Name, skipped[variant.Name])
+		}
+	}
+	if _, err := writeArtifact(filepath.Join(dir, "README"), []byte(readme)); err != nil {
+		log.Logf(0, "failed to save reproducer README: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagResourceTypes = flag.String("resource-types", "",
+	"comma-separated resource types that programs may create (e.g. sock), including their subtypes;\n"+
+		"calls that create other resources are disabled")
+
+// restrictResources removes calls that create resources of types not in allowed
+// and returns the remaining transitively enabled calls.
+// A resource is allowed if its type or one of its parent types is listed,
+// e.g. "sock" allows sock_inet, but not fd returned by open.
+func restrictResources(target *prog.Target, calls map[*prog.Syscall]bool,
+	allowed string) (map[*prog.Syscall]bool, error) {
+	kinds := make(map[string]bool)
+	for _, name := range strings.Split(allowed, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			kinds[name] = true
+		}
+	}
+	for name := range kinds {
+		known := false
+		for _, res := range target.Resources {
+			if res.Name == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown resource type %q in -resource-types", name)
+		}
+	}
+	for c := range calls {
+		if res := disallowedResource(c, kinds); res != "" {
+			log.Logf(1, "disabled by -resource-types: %v: creates %v", c.Name, res)
+			delete(calls, c)
+		}
+	}
+	calls, disabled := target.TransitivelyEnabledCalls(calls)
+	for c, reason := range disabled {
+		log.Logf(0, "transitively disabled by -resource-types: %v: %v", c.Name, reason)
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("-resource-types %v leaves no enabled syscalls", allowed)
+	}
+	return calls, nil
+}
+
+// disallowedResource returns the name of the first resource created by c
+// that is not allowed by kinds, or "" if there is no such resource.
+func disallowedResource(c *prog.Syscall, kinds map[string]bool) string {
+	res := ""
+	prog.ForeachType(c, func(typ prog.Type) {
+		rt, ok := typ.(*prog.ResourceType)
+		if !ok || res != "" || typ.Dir() == prog.DirIn {
+			return
+		}
+		for _, kind := range rt.Desc.Kind {
+			if kinds[kind] {
+				return
+			}
+		}
+		res = rt.Desc.Name
+	})
+	return res
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var (
+	flagMaxCrashLogs = flag.Int("max-crash-logs-per-title", 0, "max number of artifacts kept per crash title, "+
+		"at least 2 as the first and the last ones are always kept (0 - unlimited)")
+	flagMaxCrashdirSize = flag.String("max-crashdir-size", "", "prune artifacts when total crashdir size exceeds this (e.g. 10G)")
+
+	maxCrashdirSize uint64
+)
+
+// crashIndex describes artifacts in crashdir, it's stored in index.json.
+// Artifacts are ordered by the time they were saved.
+type crashIndex struct {
+	Artifacts []*artifact
+}
+
+type artifact struct {
+	Title    string
+	Category string // crash category, see triageCrash
+	Name     string // base file name of the artifact files
+	Size     int
+	Time     time.Time
+	Pruned   bool   `json:",omitempty"`
+	Shard    string `json:",omitempty"`
+	Vuln     string `json:",omitempty"`
+	Module   uint64 `json:",omitempty"` // recent -cycle-module transition, see recentModuleTransition
+	Timewarp uint64 `json:",omitempty"` // recent -timewarp event, see recentTimewarp
+	Hash     string // hash scheme used in Name, see -hash
+	RunID    string `json:",omitempty"`
+}
+
+var artifactExts = []string{".prog", ".log", ".annotated", ".lineage", ".args", ".targets", ".concurrent", ".oob"}
+
+// lockCrashdir takes an exclusive lock on crashdir
+// that coordinates all syz-stress instances sharing the directory.
+func lockCrashdir() (func(), error) {
+	f, err := os.OpenFile(filepath.Join(*flagCrashdir, "index.lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// checkRetention checks the retention flags.
+func checkRetention() error {
+	if *flagMaxCrashLogs < 0 || *flagMaxCrashLogs == 1 {
+		return fmt.Errorf("-max-crash-logs-per-title must be 0 or at least 2, " +
+			"the first and the last artifact of a title are always kept")
+	}
+	if *flagMaxCrashdirSize != "" {
+		var err error
+		if maxCrashdirSize, err = parseSize(*flagMaxCrashdirSize); err != nil {
+			return fmt.Errorf("bad -max-crashdir-size: %v", err)
+		}
+	}
+	return nil
+}
+
+// addArtifact records a new artifact in the index and prunes old ones according to the limits.
+// Must be called with crashdir locked.
+func addArtifact(title, category, name string, size int) error {
+	file := filepath.Join(*flagCrashdir, "index.json")
+	idx := new(crashIndex)
+	if data, err := ioutil.ReadFile(file); err == nil {
+		if err := json.Unmarshal(data, idx); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	idx.Artifacts = append(idx.Artifacts, &artifact{
+		Title:    title,
+		Category: category,
+		Name:     name,
+		Size:     size,
+		Time:     time.Now(),
+		Shard:    shardName(),
+		Vuln:     vulnID,
+		Module:   recentModuleTransition(),
+		Timewarp: recentTimewarp(),
+		Hash:     *flagHash,
+		RunID:    runID,
+	})
+	for _, name := range idx.prune(*flagMaxCrashLogs, maxCrashdirSize) {
+		for _, ext := range artifactExts {
+			os.Remove(filepath.Join(*flagCrashdir, name+ext))
+			os.Remove(filepath.Join(*flagCrashdir, name+ext+".gz"))
+		}
+		os.RemoveAll(filepath.Join(*flagCrashdir, name))
+		os.RemoveAll(filepath.Join(*flagCrashdir, name+".images"))
+		if dir := filepath.Dir(name); dir != "." {
+			// Remove the -crashdir-rotate subdirectory once it's empty, fails otherwise.
+			os.Remove(filepath.Join(*flagCrashdir, dir))
+		}
+	}
+	data, err := json.MarshalIndent(idx, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := osutil.WriteFile(tmp, data); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// prune marks artifacts as pruned to satisfy the per-title and total size limits
+// and returns names of the files that can be removed.
+// The first and the last artifact for each title are never pruned,
+// so maxPerTitle must be 0 (unlimited) or at least 2.
+func (idx *crashIndex) prune(maxPerTitle int, maxSize uint64) []string {
+	byTitle := make(map[string][]*artifact)
+	totalSize := uint64(0)
+	for _, a := range idx.Artifacts {
+		if !a.Pruned {
+			byTitle[a.Title] = append(byTitle[a.Title], a)
+			totalSize += uint64(a.Size)
+		}
+	}
+	var pruned []*artifact
+	prune := func(a *artifact) {
+		a.Pruned = true
+		totalSize -= uint64(a.Size)
+		pruned = append(pruned, a)
+	}
+	if maxPerTitle > 0 {
+		for _, arts := range byTitle {
+			excess := len(arts) - maxPerTitle
+			for i := 1; excess > 0 && i < len(arts)-1; i++ {
+				prune(arts[i])
+				excess--
+			}
+		}
+	}
+	if maxSize != 0 {
+		for _, a := range idx.Artifacts {
+			if totalSize <= maxSize {
+				break
+			}
+			arts := byTitle[a.Title]
+			if a.Pruned || a == arts[0] || a == arts[len(arts)-1] {
+				continue
+			}
+			prune(a)
+		}
+	}
+	// Several artifacts may share the same files (same program with a different title),
+	// files are removed only when no remaining artifact refers to them.
+	live := make(map[string]bool)
+	for _, a := range idx.Artifacts {
+		if !a.Pruned {
+			live[a.Name] = true
+		}
+	}
+	var names []string
+	for _, a := range pruned {
+		if !live[a.Name] {
+			live[a.Name] = true
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		// Artifacts as title:name:size, in the order they were saved.
+		artifacts   string
+		maxPerTitle int
+		maxSize     uint64
+		removed     string
+		kept        string
+	}{
+		{
+			artifacts:   "A:a0:1 A:a1:1 A:a2:1 A:a3:1",
+			maxPerTitle: 2,
+			removed:     "a1 a2",
+			kept:        "a0 a3",
+		},
+		{
+			artifacts:   "A:a0:1 B:b0:1 A:a1:1 A:a2:1 B:b1:1 A:a3:1",
+			maxPerTitle: 3,
+			removed:     "a1",
+			kept:        "a0 b0 a2 b1 a3",
+		},
+		{
+			// Not above the limit.
+			artifacts:   "A:a0:1 A:a1:1",
+			maxPerTitle: 2,
+			kept:        "a0 a1",
+		},
+		{
+			// The middle artifacts are pruned from the oldest until the size fits.
+			artifacts: "A:a0:10 A:a1:10 A:a2:10 A:a3:10 B:b0:10",
+			maxSize:   35,
+			removed:   "a1 a2",
+			kept:      "a0 a3 b0",
+		},
+		{
+			// The first and the last artifacts are kept even if the size does not fit.
+			artifacts: "A:a0:10 A:a1:10 B:b0:10",
+			maxSize:   5,
+			kept:      "a0 a1 b0",
+		},
+		{
+			// Files shared with a kept artifact are not removed.
+			artifacts:   "A:a0:1 A:x:1 A:a2:1 B:x:1",
+			maxPerTitle: 2,
+			kept:        "a0 a2 x",
+		},
+	}
+	for i, test := range tests {
+		idx := new(crashIndex)
+		for _, desc := range strings.Fields(test.artifacts) {
+			parts := strings.Split(desc, ":")
+			size, err := strconv.Atoi(parts[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			idx.Artifacts = append(idx.Artifacts, &artifact{Title: parts[0], Name: parts[1], Size: size})
+		}
+		removed := strings.Join(idx.prune(test.maxPerTitle, test.maxSize), " ")
+		if removed != test.removed {
+			t.Errorf("test #%v: removed %q, want %q", i, removed, test.removed)
+		}
+		var kept []string
+		seen := make(map[string]bool)
+		for _, a := range idx.Artifacts {
+			if !a.Pruned && !seen[a.Name] {
+				seen[a.Name] = true
+				kept = append(kept, a.Name)
+			}
+		}
+		if got := strings.Join(kept, " "); got != test.kept {
+			t.Errorf("test #%v: kept %q, want %q", i, kept, test.kept)
+		}
+	}
+}
+
+func TestCheckRetention(t *testing.T) {
+	defer func(v int) { *flagMaxCrashLogs = v }(*flagMaxCrashLogs)
+	for _, max := range []int{-1, 1} {
+		*flagMaxCrashLogs = max
+		if err := checkRetention(); err == nil {
+			t.Errorf("-max-crash-logs-per-title=%v is accepted", max)
+		}
+	}
+	for _, max := range []int{0, 2, 10} {
+		*flagMaxCrashLogs = max
+		if err := checkRetention(); err != nil {
+			t.Errorf("-max-crash-logs-per-title=%v: %v", max, err)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+var flagCrashdirRotate = flag.String("crashdir-rotate", "",
+	"save crashes into hourly or daily subdirectories of crashdir (hourly, daily)")
+
+func checkCrashdirRotate() error {
+	switch *flagCrashdirRotate {
+	case "", "hourly", "daily":
+		return nil
+	}
+	return fmt.Errorf("bad -crashdir-rotate %q, want hourly or daily", *flagCrashdirRotate)
+}
+
+// rotateName returns the crashdir-relative name for artifacts of a crash saved now:
+// with -crashdir-rotate all files of the crash are placed into the subdirectory
+// for the current time window, e.g. 2020-03-15-14/oob-write-<hash>.
+// The crashdir index stays at the top level and refers to artifacts by these names.
+func rotateName(name string) string {
+	var layout string
+	switch *flagCrashdirRotate {
+	case "hourly":
+		layout = "2006-01-02-15"
+	case "daily":
+		layout = "2006-01-02"
+	default:
+		return name
+	}
+	return filepath.Join(time.Now().Format(layout), name)
+}
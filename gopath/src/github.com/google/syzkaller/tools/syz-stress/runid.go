@@ -0,0 +1,58 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagRunID = flag.String("run-id", "", "identifier of this run used in log lines, crashdir file names and metrics "+
+		"(time, host name and a random suffix by default)")
+	flagRunIDAlias = flag.String("runid", "", "alias of -run-id")
+)
+
+// runID identifies this syz-stress instance.
+var runID string
+
+// initRunID sets runID and tags all log output of the process with it.
+func initRunID() {
+	runID = *flagRunID
+	if runID == "" {
+		runID = *flagRunIDAlias
+	}
+	if runID == "" {
+		runID = generateRunID()
+	}
+	log.SetTag(runID)
+	log.Logf(0, "starting syz-stress run %v", runID)
+}
+
+// generateRunID returns an id that is unique across a fleet of machines,
+// e.g. 20200315-142501-host1-9f3a61c2.
+func generateRunID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	// Host names are safe to use in file names, but may be long.
+	host = strings.SplitN(host, ".", 2)[0]
+	var buf [4]byte
+	rand.Read(buf[:])
+	return fmt.Sprintf("%v-%v-%v", time.Now().Format("20060102-150405"), host, hex.EncodeToString(buf[:]))
+}
+
+// runIDComment returns a program comment line with the run id,
+// it's ignored when the program is deserialized.
+func runIDComment() []byte {
+	return []byte(fmt.Sprintf("# run %v\n", runID))
+}
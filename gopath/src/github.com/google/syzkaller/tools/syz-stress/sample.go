@@ -0,0 +1,140 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var (
+	flagSample = flag.String("sample", "", "periodically sample stacks of all goroutines and write them "+
+		"to this file in folded format for flamegraph.pl (the file is rewritten as samples accumulate)")
+	flagSampleInterval = flag.Duration("sample-interval", 100*time.Millisecond, "-sample sampling interval")
+
+	sampleStack = make(map[string]int) // folded stack -> number of samples, used only by the sampler
+	sampleDone  chan bool
+)
+
+// The folded stacks file is rewritten this often, so it's usable while the run continues.
+const sampleFlushInterval = 10 * time.Second
+
+// startSampling samples goroutine stacks until finishSampling. Unlike CPU profiles,
+// the samples include blocked goroutines, the goroutine state (e.g. [chan receive])
+// is the leaf frame of each stack, so blocking in the proc loops is visible.
+func startSampling(file string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("bad -sample-interval %v", interval)
+	}
+	if err := osutil.WriteFile(file, nil); err != nil {
+		return fmt.Errorf("failed to create -sample file: %v", err)
+	}
+	sampleDone = make(chan bool)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastFlush := time.Now()
+		buf := make([]byte, 1<<20)
+		for {
+			select {
+			case <-ticker.C:
+			case <-sampleDone:
+				writeSamples(file)
+				sampleDone <- true
+				return
+			}
+			for {
+				n := runtime.Stack(buf, true)
+				if n < len(buf) {
+					addSample(buf[:n])
+					break
+				}
+				buf = make([]byte, 2*len(buf))
+			}
+			if time.Since(lastFlush) >= sampleFlushInterval {
+				writeSamples(file)
+				lastFlush = time.Now()
+			}
+		}
+	}()
+	return nil
+}
+
+// addSample folds stacks of all goroutines in a runtime.Stack dump.
+func addSample(dump []byte) {
+	for _, g := range bytes.Split(dump, []byte("\n\n")) {
+		if stack := foldStack(string(g)); stack != "" {
+			sampleStack[stack]++
+		}
+	}
+}
+
+// foldStack converts a single goroutine of a runtime.Stack dump into
+// root;...;leaf;[state] form. The sampler goroutine itself is skipped.
+func foldStack(g string) string {
+	lines := strings.Split(strings.TrimSpace(g), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "goroutine ") {
+		return ""
+	}
+	state := lines[0]
+	if i, j := strings.IndexByte(state, '['), strings.IndexByte(state, ']'); i != -1 && j > i {
+		// Drop the wait duration, e.g. [chan receive, 5 minutes].
+		state = strings.SplitN(state[i+1:j], ",", 2)[0]
+	}
+	frames := []string{"[" + state + "]"}
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "created by ") {
+			continue
+		}
+		if paren := strings.LastIndexByte(line, '('); paren > 0 && strings.HasSuffix(line, ")") {
+			line = line[:paren]
+		}
+		if strings.HasSuffix(line, ".startSampling.func1") {
+			return ""
+		}
+		frames = append(frames, line)
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return strings.Join(frames, ";")
+}
+
+func writeSamples(file string) {
+	var stacks []string
+	for stack := range sampleStack {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	buf := new(bytes.Buffer)
+	for _, stack := range stacks {
+		fmt.Fprintf(buf, "%v %v\n", stack, sampleStack[stack])
+	}
+	tmp := file + ".tmp"
+	if err := osutil.WriteFile(tmp, buf.Bytes()); err != nil {
+		log.Logf(0, "failed to write stack samples: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		log.Logf(0, "failed to write stack samples: %v", err)
+	}
+}
+
+// finishSampling writes the final samples.
+func finishSampling() {
+	if sampleDone == nil {
+		return
+	}
+	sampleDone <- true
+	<-sampleDone
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagSanitizeCorpus = flag.String("sanitize-corpus", "",
+	"check round trips of all -corpus programs, write the clean ones to this database and exit")
+
+// sanitizeCorpus deserializes, validates and re-serializes every corpus record
+// and writes records that survive the round trip unchanged to a new database.
+func sanitizeCorpus(target *prog.Target, file string) {
+	if *flagCorpus == "" {
+		log.Fatalf("-sanitize-corpus requires -corpus")
+	}
+	corpusDB, err := db.Open(*flagCorpus)
+	if err != nil {
+		log.Fatalf("failed to open corpus database: %v", err)
+	}
+	outDB, err := db.Open(file)
+	if err != nil {
+		log.Fatalf("failed to open output database: %v", err)
+	}
+	var keys []string
+	for key := range corpusDB.Records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	bad, saved := 0, 0
+	renamed := make(map[string]int)
+	for _, key := range keys {
+		rec := corpusDB.Records[key]
+		variants := [][]byte{rec.Val}
+		if migration != nil {
+			progs, counts, err := migrateProg(fixupRecord(rec.Val))
+			if err != nil {
+				log.Logf(0, "record %v: failed to deserialize: %v", key, err)
+				bad++
+				continue
+			}
+			for old, n := range counts {
+				renamed[old] += n
+			}
+			if len(progs) == 0 {
+				log.Logf(0, "record %v: dropped by -migrate-policy", key)
+				bad++
+			}
+			variants = nil
+			for _, p := range progs {
+				variants = append(variants, p.Serialize())
+			}
+		}
+		for _, data := range variants {
+			data, err := sanitizeRecord(target, data)
+			if err != nil {
+				log.Logf(0, "record %v: %v", key, err)
+				bad++
+				continue
+			}
+			outDB.Save(hash.String(data), data, rec.Seq)
+			saved++
+		}
+	}
+	if err := outDB.Flush(); err != nil {
+		log.Fatalf("failed to write output database: %v", err)
+	}
+	log.Logf(0, "sanitized %v records: %v programs saved, %v dropped", len(keys), saved, bad)
+	if len(renamed) != 0 {
+		log.Logf(0, "renamed calls: %v", migrationCounts(renamed))
+	}
+}
+
+// sanitizeRecord returns the canonical serialization of a corpus record,
+// or an error if the record does not survive a serialization round trip.
+// Panics in the prog package are reported as errors.
+func sanitizeRecord(target *prog.Target, data []byte) (res []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	p, err := target.Deserialize(fixupRecord(data), prog.NonStrict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize: %v", err)
+	}
+	if err := validateProg(p); err != nil {
+		return nil, fmt.Errorf("invalid program: %v", err)
+	}
+	data1 := p.Serialize()
+	p1, err := target.Deserialize(data1, prog.Strict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize serialized program: %v", err)
+	}
+	if data2 := p1.Serialize(); !bytes.Equal(data1, data2) {
+		return nil, fmt.Errorf("serialization is not stable:\n%s\nvs:\n%s", data1, data2)
+	}
+	return data1, nil
+}
+
+// fixupRecord fixes format quirks seen in old corpora:
+// CRLF line endings and trailing NUL padding.
+func fixupRecord(data []byte) []byte {
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	return bytes.TrimRight(data, "\x00")
+}
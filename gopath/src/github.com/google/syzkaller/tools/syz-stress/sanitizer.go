@@ -0,0 +1,26 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	sanitizerBugRe = regexp.MustCompile(`BUG: (K[AC]SAN: [^\r\n]*)`)
+	sanitizerOffRe = regexp.MustCompile(`\+0x[0-9a-f]+/0x[0-9a-f]+`)
+)
+
+// sanitizerTitle returns the title of the first KASAN/KCSAN report in output,
+// e.g. "KASAN: slab-out-of-bounds in foo" for "BUG: KASAN: slab-out-of-bounds in foo+0x12/0x40".
+// It's used when the reporter is not available or does not recognize the report,
+// so that sanitizer-detected bugs are not lost if the executor itself survives them.
+func sanitizerTitle(output []byte) string {
+	m := sanitizerBugRe.FindSubmatch(output)
+	if m == nil {
+		return ""
+	}
+	return strings.TrimSpace(sanitizerOffRe.ReplaceAllString(string(m[1]), ""))
+}
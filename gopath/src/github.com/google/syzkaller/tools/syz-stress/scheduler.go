@@ -0,0 +1,98 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"math"
+	"math/rand"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+var flagScheduler = flag.String("scheduler", "uniform", "corpus program selection: uniform or bandit (requires -cover)")
+
+const (
+	schedDecayPeriod = 10 * time.Second
+	schedDecay       = 0.9
+)
+
+// banditScheduler selects corpus programs for mutation proportionally to the new signal
+// recently found by their descendants. Rewards are updated with atomics by workers,
+// and a background goroutine periodically decays them and rebuilds selection weights.
+type banditScheduler struct {
+	rewards    []uint64     // float64 bits of the decayed reward of each corpus program
+	totals     []uint64     // total new signal found by descendants of each corpus program
+	cumulative atomic.Value // []float64 with prefix sums of selection weights
+}
+
+func newBanditScheduler(n int) *banditScheduler {
+	s := &banditScheduler{
+		rewards: make([]uint64, n),
+		totals:  make([]uint64, n),
+	}
+	s.rebuild()
+	go func() {
+		for range time.NewTicker(schedDecayPeriod).C {
+			for i := range s.rewards {
+				s.update(i, func(r float64) float64 { return r * schedDecay })
+			}
+			s.rebuild()
+		}
+	}()
+	return s
+}
+
+func (s *banditScheduler) choose(rnd *rand.Rand) int {
+	cumulative := s.cumulative.Load().([]float64)
+	x := rnd.Float64() * cumulative[len(cumulative)-1]
+	return sort.SearchFloat64s(cumulative, x)
+}
+
+func (s *banditScheduler) reward(idx, signal int) {
+	if signal == 0 {
+		return
+	}
+	atomic.AddUint64(&s.totals[idx], uint64(signal))
+	s.update(idx, func(r float64) float64 { return r + float64(signal) })
+}
+
+func (s *banditScheduler) update(idx int, f func(float64) float64) {
+	for {
+		old := atomic.LoadUint64(&s.rewards[idx])
+		val := math.Float64bits(f(math.Float64frombits(old)))
+		if atomic.CompareAndSwapUint64(&s.rewards[idx], old, val) {
+			return
+		}
+	}
+}
+
+func (s *banditScheduler) rebuild() {
+	cumulative := make([]float64, len(s.rewards))
+	sum := 0.0
+	for i := range s.rewards {
+		// Every program has a base weight of 1 so that unproductive programs are still explored.
+		sum += 1 + math.Float64frombits(atomic.LoadUint64(&s.rewards[i]))
+		cumulative[i] = sum
+	}
+	s.cumulative.Store(cumulative)
+}
+
+// top returns indices of at most n corpus programs with the most new signal found by descendants.
+func (s *banditScheduler) top(n int) []int {
+	var idx []int
+	for i := range s.totals {
+		if atomic.LoadUint64(&s.totals[i]) != 0 {
+			idx = append(idx, i)
+		}
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		return atomic.LoadUint64(&s.totals[idx[i]]) > atomic.LoadUint64(&s.totals[idx[j]])
+	})
+	if len(idx) > n {
+		idx = idx[:n]
+	}
+	return idx
+}
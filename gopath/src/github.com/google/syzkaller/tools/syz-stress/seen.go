@@ -0,0 +1,96 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/bloom"
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagSeenFilter = flag.String("seen-filter", "", "file with a bloom filter of generated programs executed "+
+		"in previous runs, such programs are skipped (created if it does not exist, updated on exit)")
+	flagSeenFilterSize = flag.Uint64("seen-filter-size", 10000000, "number of programs a new -seen-filter is sized for")
+	flagSeenFilterFP   = flag.Float64("seen-filter-fp", 0.001, "false positive rate of a new -seen-filter")
+	flagSeenReplayRate = flag.Float64("seen-replay-rate", 0, "fraction of -seen-filter hits that are executed anyway")
+
+	seenMu     sync.Mutex
+	seenFilter *bloom.Filter
+
+	statSeenSkips   uint64
+	statSeenReplays uint64
+)
+
+// The filter is also saved periodically, so that a killed run does not lose it.
+const seenSaveInterval = 5 * time.Minute
+
+// loadSeenFilter loads -seen-filter or creates a new one.
+// Skipping is lossy by design: a false positive skips a program that was never executed,
+// so the false positive rate of the filter is logged and printed in the summary.
+func loadSeenFilter(file string) error {
+	if *flagSeenReplayRate < 0 || *flagSeenReplayRate > 1 {
+		return fmt.Errorf("bad -seen-replay-rate %v", *flagSeenReplayRate)
+	}
+	f, err := bloom.ReadFile(file)
+	if os.IsNotExist(err) {
+		if f, err = bloom.New(*flagSeenFilterSize, *flagSeenFilterFP); err != nil {
+			return err
+		}
+		log.Logf(0, "created program filter %v for %v programs", file, *flagSeenFilterSize)
+	} else if err != nil {
+		return fmt.Errorf("failed to load -seen-filter: %v", err)
+	} else {
+		log.Logf(0, "loaded program filter %v: %v programs, false positive rate %.2g",
+			file, f.Items(), f.FalsePositiveRate())
+	}
+	seenFilter = f
+	go func() {
+		for range time.NewTicker(seenSaveInterval).C {
+			saveSeenFilter(file)
+		}
+	}()
+	return nil
+}
+
+// seenBefore adds p to the filter and returns true if it needs to be skipped
+// because it was (probably) executed before, in this or an earlier run.
+func seenBefore(p *prog.Prog, rnd *rand.Rand) bool {
+	sig := hash.Hash(p.Serialize())
+	seenMu.Lock()
+	seen := seenFilter.TestAndAdd(sig[:])
+	seenMu.Unlock()
+	if !seen {
+		return false
+	}
+	if *flagSeenReplayRate != 0 && rnd.Float64() < *flagSeenReplayRate {
+		atomic.AddUint64(&statSeenReplays, 1)
+		return false
+	}
+	atomic.AddUint64(&statSeenSkips, 1)
+	return true
+}
+
+func saveSeenFilter(file string) {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	if err := seenFilter.WriteFile(file); err != nil {
+		log.Logf(0, "failed to save -seen-filter: %v", err)
+	}
+}
+
+func seenFalsePositiveRate() float64 {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+	return seenFilter.FalsePositiveRate()
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagRecord        = flag.String("record", "", "append every executed program to this file in execution order")
+	flagReplaySession = flag.String("replay-session", "", "execute programs recorded with -record in order and exit")
+)
+
+// Session files contain serialized programs separated by empty lines,
+// serialized programs never contain empty lines themselves.
+var (
+	recordMu   sync.Mutex
+	recordFile *os.File
+)
+
+func initRecord(file string) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Fatalf("failed to open session record: %v", err)
+	}
+	recordFile = f
+}
+
+// recordProg appends p to the session record if -record is given.
+// Programs are written unbuffered so that the record survives a kernel crash.
+func recordProg(p *prog.Prog) {
+	if recordFile == nil {
+		return
+	}
+	data := append(p.Serialize(), '\n')
+	recordMu.Lock()
+	defer recordMu.Unlock()
+	if _, err := recordFile.Write(data); err != nil {
+		log.Fatalf("failed to write session record: %v", err)
+	}
+}
+
+// runReplaySession executes recorded programs one by one in the recorded order.
+// Programs that no longer parse or use syscalls that are not enabled are skipped.
+func runReplaySession(ft *fuzzTarget, file string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("failed to read session record: %v", err)
+	}
+	gate = ipc.NewGate(2, nil)
+	proc := newProc(ft, 0)
+	executed, skipped, crashed := 0, 0, 0
+	for i, data := range bytes.Split(data, []byte("\n\n")) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		p, err := ft.target.Deserialize(data, prog.NonStrict)
+		if err != nil {
+			log.Logf(0, "program %v: skipping, failed to deserialize: %v", i, err)
+			skipped++
+			continue
+		}
+		if c := disabledCall(ft, p); c != "" {
+			log.Logf(0, "program %v: skipping, uses disabled syscall %v", i, c)
+			skipped++
+			continue
+		}
+		atomic.AddUint64(&statExec, 1)
+		executed++
+		output, _, hanged, err := proc.env.Exec(ft.execOpts, p)
+		if handleResult(p, output, hanged, err) {
+			crashed++
+			fmt.Fprintf(progOutput, "program %v crashed:\n%s\n", i, p.Serialize())
+			progOutput.Write(output)
+		}
+		if err != nil || hanged {
+			proc.recycleEnv()
+		}
+	}
+	fmt.Printf("replayed %v programs, skipped %v, %v crashed\n", executed, skipped, crashed)
+}
+
+// disabledCall returns name of the first call of p that is not enabled, or "".
+func disabledCall(ft *fuzzTarget, p *prog.Prog) string {
+	for _, c := range p.Calls {
+		if !ft.calls[c.Meta] {
+			return c.Meta.Name
+		}
+	}
+	return ""
+}
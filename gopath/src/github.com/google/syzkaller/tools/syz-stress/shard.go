@@ -0,0 +1,64 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var flagShard = flag.String("shard", "",
+	"i/n: mutate only shard i of n of the corpus and use shard-specific generation seeds")
+
+// Shard index and number of shards, shardCount is 0 if sharding is disabled.
+var shardIdx, shardCount int
+
+func parseShard(s string) error {
+	if s == "" {
+		return nil
+	}
+	if _, err := fmt.Sscanf(s, "%d/%d", &shardIdx, &shardCount); err != nil {
+		return fmt.Errorf("bad shard %q, want i/n: %v", s, err)
+	}
+	if shardCount <= 0 || shardIdx < 0 || shardIdx >= shardCount {
+		return fmt.Errorf("bad shard %q, want 0 <= i < n", s)
+	}
+	return nil
+}
+
+// shardName returns the shard id for stats and artifacts, or "" if sharding is disabled.
+func shardName() string {
+	if shardCount == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%v/%v", shardIdx, shardCount)
+}
+
+// shardCorpus returns programs that belong to the current shard.
+// Programs are assigned by the hash of their serialized form,
+// so assignment of existing programs does not change when the corpus grows.
+func shardCorpus(corpus []*prog.Prog) []*prog.Prog {
+	var res []*prog.Prog
+	for _, p := range corpus {
+		h := fnv.New64a()
+		h.Write(p.Serialize())
+		if h.Sum64()%uint64(shardCount) == uint64(shardIdx) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// shardSeed maps seed to the current shard's residue class modulo the number of shards,
+// so that different shards never use the same generation seed.
+func shardSeed(seed int64) int64 {
+	if shardCount == 0 {
+		return seed
+	}
+	n := int64(shardCount)
+	return seed - seed%n + int64(shardIdx)
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/sigfile"
+)
+
+var (
+	flagBaselineSignal = flag.String("baseline-signal", "",
+		"signal file (e.g. exported by syz-manager) with signal that is not counted as new")
+	flagExportSignal = flag.String("export-signal", "", "write the final signal, including the baseline, to this file")
+
+	signalMu  sync.Mutex
+	maxSignal = make(map[uint32]struct{})
+	// baselineSize is the number of signal values loaded with -baseline-signal.
+	baselineSize int
+)
+
+// loadBaselineSignal adds signal from file to the global signal set,
+// so that only signal beyond it is reported as new.
+func loadBaselineSignal(file string) error {
+	signal, err := sigfile.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read -baseline-signal: %v", err)
+	}
+	signalMu.Lock()
+	defer signalMu.Unlock()
+	for _, s := range signal {
+		maxSignal[s] = struct{}{}
+	}
+	baselineSize = len(maxSignal)
+	log.Logf(0, "loaded %v baseline signal", baselineSize)
+	return nil
+}
+
+// exportSignal writes the global signal set into file.
+func exportSignal(file string) error {
+	signalMu.Lock()
+	signal := make([]uint32, 0, len(maxSignal))
+	for s := range maxSignal {
+		signal = append(signal, s)
+	}
+	signalMu.Unlock()
+	return sigfile.WriteFile(file, signal)
+}
+
+// addSignal merges signal from info into the global signal set
+// and returns the amount of signal that was not seen before.
+func addSignal(info *ipc.ProgInfo) int {
+	if info == nil {
+		return 0
+	}
+	signalMu.Lock()
+	defer signalMu.Unlock()
+	n := 0
+	add := func(signal []uint32) {
+		for _, s := range signal {
+			if _, ok := maxSignal[s]; !ok {
+				maxSignal[s] = struct{}{}
+				n++
+			}
+		}
+	}
+	for _, c := range info.Calls {
+		add(c.Signal)
+	}
+	add(info.Extra.Signal)
+	if n != 0 {
+		noteNewSignal()
+	}
+	return n
+}
+
+func signalSize() int {
+	signalMu.Lock()
+	defer signalMu.Unlock()
+	return len(maxSignal)
+}
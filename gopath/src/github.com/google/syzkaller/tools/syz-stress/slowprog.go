@@ -0,0 +1,23 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagSlowProg = flag.Duration("slow-prog-threshold", 0, "log programs whose execution takes longer than this")
+
+// checkSlowProg logs p if its execution took longer than -slow-prog-threshold.
+// The executor does not report durations of individual calls, so only whole programs
+// are timed. Execution time statistics are in the execution time by program length table.
+func checkSlowProg(p *prog.Prog, d time.Duration) {
+	if *flagSlowProg != 0 && d > *flagSlowProg {
+		log.Logf(0, "program took %v:\n%s", d, p.Serialize())
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagSplice = flag.Float64("splice", 0, "fraction of corpus mutations that instead splice a prefix "+
+		"of the program with a suffix of another corpus program")
+	flagSpliceResources = flag.String("splice-resources", "drop", "handling of resources in the spliced suffix: "+
+		"renumber (shift resource IDs, unresolved uses get default values), "+
+		"drop (also remove calls that use resources the prefix does not create, and validate), "+
+		"regenerate (renumber, then mutate to fill the gaps)")
+
+	statSplices     uint64
+	statSpliceFails uint64
+)
+
+func checkSpliceFlags() error {
+	if *flagSplice < 0 || *flagSplice > 1 {
+		return fmt.Errorf("bad -splice %v", *flagSplice)
+	}
+	switch *flagSpliceResources {
+	case "renumber", "drop", "regenerate":
+	default:
+		return fmt.Errorf("unknown -splice-resources %q", *flagSpliceResources)
+	}
+	return nil
+}
+
+// spliceProgs returns a random prefix of p1 followed by a random suffix of p2.
+// Programs are spliced in serialized form, where every call is a line and resources
+// are variables rN defined with "rN = call(...)" or "<rN=>" and used as "rN".
+// It returns nil if the result does not deserialize (or validate with -splice-resources=drop).
+// With -splice-resources=regenerate the caller mutates the result.
+func (ft *fuzzTarget) spliceProgs(p1, p2 *prog.Prog, rnd *rand.Rand) *prog.Prog {
+	prefix := callLines(p1.Serialize())
+	suffix := callLines(p2.Serialize())
+	prefix = prefix[:rnd.Intn(len(prefix)+1)]
+	suffix = suffix[rnd.Intn(len(suffix)+1):]
+	defined := make(map[int]bool)
+	next := 0
+	for _, line := range prefix {
+		forEachVar(line, func(id int, def bool) string {
+			if def {
+				defined[id] = true
+				if id >= next {
+					next = id + 1
+				}
+			}
+			return ""
+		})
+	}
+	// IDs defined by the suffix are shifted past the prefix ones, uses of resources
+	// defined in the cut-off part of p2 are left pointing to IDs that are not defined.
+	shift := make(map[int]int)
+	buf := new(bytes.Buffer)
+	for _, line := range prefix {
+		buf.WriteString(line + "\n")
+	}
+	for _, line := range suffix {
+		unresolved := false
+		var defs []int
+		line = forEachVar(line, func(id int, def bool) string {
+			if def {
+				shift[id] = next
+				defs = append(defs, next)
+				next++
+				return fmt.Sprintf("r%v", shift[id])
+			}
+			if newID, ok := shift[id]; ok && defined[newID] {
+				return fmt.Sprintf("r%v", newID)
+			}
+			unresolved = true
+			return fmt.Sprintf("r%v", next+1000+id)
+		})
+		if unresolved && *flagSpliceResources == "drop" {
+			// Resources defined by the dropped call become unresolved for later calls as well.
+			continue
+		}
+		for _, id := range defs {
+			defined[id] = true
+		}
+		buf.WriteString(line + "\n")
+	}
+	p, err := ft.target.Deserialize(buf.Bytes(), prog.NonStrict)
+	if err == nil && *flagSpliceResources == "drop" {
+		err = validateProg(p)
+	}
+	if err != nil || len(p.Calls) == 0 {
+		atomic.AddUint64(&statSpliceFails, 1)
+		return nil
+	}
+	atomic.AddUint64(&statSplices, 1)
+	return p
+}
+
+// callLines returns the call lines of a serialized program, comments are dropped.
+func callLines(data []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// forEachVar calls f for every resource variable in a serialized call line outside of
+// string literals, def is set for definitions. A non-empty result of f replaces the variable.
+func forEachVar(line string, f func(id int, def bool) string) string {
+	res := new(strings.Builder)
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(line) {
+				res.WriteByte(c)
+				i++
+				c = line[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == 'r' && (i == 0 || !isIdentChar(line[i-1])):
+			j := i + 1
+			for j < len(line) && line[j] >= '0' && line[j] <= '9' {
+				j++
+			}
+			if j == i+1 || j < len(line) && isIdentChar(line[j]) {
+				break
+			}
+			id, err := strconv.Atoi(line[i+1 : j])
+			if err != nil {
+				break
+			}
+			rest := line[j:]
+			def := i == 0 && strings.HasPrefix(rest, " = ") || strings.HasPrefix(rest, "=>")
+			if repl := f(id, def); repl != "" {
+				res.WriteString(repl)
+				i = j - 1
+				continue
+			}
+		}
+		res.WriteByte(c)
+	}
+	return res.String()
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$'
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+// Procs are considered oversubscribed when there are this many times more procs than CPUs.
+const oversubscriptionFactor = 4
+
+// oversubscribed is set when procs heavily exceed the number of CPUs,
+// in such case stats include Go scheduler metrics.
+var oversubscribed bool
+
+func checkOversubscription(procs int) {
+	if procs < oversubscriptionFactor*runtime.NumCPU() {
+		return
+	}
+	oversubscribed = true
+	log.Logf(0, "running %v procs on %v CPUs, stats include scheduler metrics", procs, runtime.NumCPU())
+}
+
+// statsLine returns the periodically printed stats.
+func statsLine() string {
+	buf := new(strings.Builder)
+	if shard := shardName(); shard != "" {
+		fmt.Fprintf(buf, "shard %v: ", shard)
+	}
+	fmt.Fprintf(buf, "executed %v programs", atomic.LoadUint64(&statExec))
+	if oversubscribed {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		fmt.Fprintf(buf, ", %v goroutines, %v GCs, last GC pause %v", runtime.NumGoroutine(), ms.NumGC,
+			time.Duration(ms.PauseNs[(ms.NumGC+255)%256]))
+	}
+	if *flagLenHistogram {
+		fmt.Fprintf(buf, ", length %v", lenPercentiles())
+	}
+	if n := atomic.LoadUint64(&statDedupLookups); n != 0 {
+		fmt.Fprintf(buf, ", dedup hit rate %.1f%%", 100*float64(atomic.LoadUint64(&statDedupHits))/float64(n))
+	}
+	if seenFilter != nil {
+		fmt.Fprintf(buf, ", %v seen before", atomic.LoadUint64(&statSeenSkips))
+	}
+	if *flagValidate {
+		fmt.Fprintf(buf, ", %v invalid", atomic.LoadUint64(&statInvalid))
+	}
+	if n := atomic.LoadUint64(&statGenFail); n != 0 {
+		fmt.Fprintf(buf, ", %v generation failures", n)
+	}
+	if n := atomic.LoadUint64(&statTooLarge); n != 0 {
+		fmt.Fprintf(buf, ", %v too large", n)
+	}
+	if *flagSaveCorpus {
+		fmt.Fprintf(buf, ", %v added to corpus", atomic.LoadUint64(&statCorpusAdded))
+	}
+	if n := atomic.LoadUint64(&statTruncated); n != 0 {
+		fmt.Fprintf(buf, ", %v truncated", n)
+	}
+	if *flagAvoidHangs {
+		fmt.Fprintf(buf, ", %v hangs, %v hang fix-ups", atomic.LoadUint64(&statHangs), hangFixes.total())
+	}
+	if *flagStream != "" {
+		fmt.Fprintf(buf, ", %v stream events dropped", atomic.LoadUint64(&statStreamDrops))
+	}
+	if *flagOOB {
+		fmt.Fprintf(buf, ", %v OOB sites", oobSiteCount())
+	}
+	if *flagWorkerTimeout != 0 {
+		fmt.Fprintf(buf, ", %v stuck", atomic.LoadUint64(&statStuck))
+	}
+	if *flagHotArgs != 0 {
+		fmt.Fprintf(buf, ", %v hot-arg mutations (%v signal, %v crashes)", atomic.LoadUint64(&statHotMutations),
+			atomic.LoadUint64(&statHotSignal), atomic.LoadUint64(&statHotCrashes))
+	}
+	if *flagMemCap != "" {
+		fmt.Fprintf(buf, ", %v waited for memory", atomic.LoadUint64(&statMemWait))
+	}
+	if *flagBurst != "" {
+		state := "idle"
+		if atomic.LoadUint32(&burstOn) != 0 {
+			state = "on"
+		}
+		fmt.Fprintf(buf, ", burst %v, average %.1f programs/sec", state,
+			float64(atomic.LoadUint64(&statExec))/time.Since(startTime).Seconds())
+	}
+	if *flagFlushBetween {
+		total, _ := flushOverhead()
+		fmt.Fprintf(buf, ", %v flushes (%v)", atomic.LoadUint64(&statFlushes), total.Round(time.Millisecond))
+	}
+	if *flagDiffOpts != "" {
+		fmt.Fprintf(buf, ", %v diverging with %v", atomic.LoadUint64(&statDiffDiverged), *flagDiffOpts)
+	}
+	if *flagCycleModule != "" {
+		fmt.Fprintf(buf, ", %v module cycles (%v busy)", atomic.LoadUint64(&statModuleCycles),
+			atomic.LoadUint64(&statModuleUnloadFail))
+	}
+	if *flagWorkdirQuota != "" || *flagDiskMinFree != "" {
+		fmt.Fprintf(buf, ", %v workdir cleanups, %v disk pauses", atomic.LoadUint64(&statWorkdirCleanups),
+			atomic.LoadUint64(&statDiskPauses))
+		if atomic.LoadUint32(&diskPaused) != 0 {
+			fmt.Fprintf(buf, " (paused)")
+		}
+	}
+	if *flagLoadLimit != 0 {
+		fmt.Fprintf(buf, ", load %.2f, %v procs paused",
+			math.Float64frombits(atomic.LoadUint64(&statLoad)), atomic.LoadUint64(&statThrottled))
+	}
+	return buf.String()
+}
+
+const (
+	lenBucketSize = 10
+	numLenBuckets = 10 // the last bucket also collects all longer programs
+)
+
+type lenBucket struct {
+	count uint64
+	nsec  uint64
+}
+
+// execTimeByLen accumulates execution time of programs bucketed by program length.
+var execTimeByLen [numLenBuckets]lenBucket
+
+func lenBucketIndex(ncalls int) int {
+	idx := 0
+	if ncalls > 0 {
+		idx = (ncalls - 1) / lenBucketSize
+	}
+	if idx >= numLenBuckets {
+		idx = numLenBuckets - 1
+	}
+	return idx
+}
+
+func recordExecTime(ncalls int, d time.Duration) {
+	b := &execTimeByLen[lenBucketIndex(ncalls)]
+	atomic.AddUint64(&b.count, 1)
+	atomic.AddUint64(&b.nsec, uint64(d))
+}
+
+func execTimeTable() string {
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "%-10v %10v %12v\n", "length", "programs", "avg exec ms")
+	for i := range execTimeByLen {
+		b := &execTimeByLen[i]
+		count := atomic.LoadUint64(&b.count)
+		if count == 0 {
+			continue
+		}
+		avg := float64(atomic.LoadUint64(&b.nsec)) / float64(count) / float64(time.Millisecond)
+		fmt.Fprintf(buf, "%-10v %10v %12.2f\n", lenBucketName(i), count, avg)
+	}
+	return buf.String()
+}
+
+func lenBucketName(idx int) string {
+	if idx == numLenBuckets-1 {
+		return fmt.Sprintf("%v+", idx*lenBucketSize+1)
+	}
+	return fmt.Sprintf("%v-%v", idx*lenBucketSize+1, (idx+1)*lenBucketSize)
+}
+
+// accountCalls updates per-syscall stats with results of an execution of p.
+func (ft *fuzzTarget) accountCalls(p *prog.Prog, info *ipc.ProgInfo) {
+	for i, c := range p.Calls {
+		atomic.AddUint64(&ft.callExecs[c.Meta.ID], 1)
+		if info != nil && i < len(info.Calls) {
+			atomic.AddUint64(&ft.callSignal[c.Meta.ID], uint64(len(info.Calls[i].Signal)))
+			if ft.learn != nil {
+				ft.learn.add(c.Meta, &info.Calls[i])
+			}
+		}
+	}
+}
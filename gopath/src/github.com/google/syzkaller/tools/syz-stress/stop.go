@@ -0,0 +1,60 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	flagStopAfterCrashes = flag.Int("stop-after-crashes", 0, "stop after this many crashes")
+	flagStopAfterUnique  = flag.Int("stop-after-unique", 0, "stop after this many unique crash titles")
+	flagStopOnPlateau    = flag.Duration("stop-on-plateau", 0, "stop if no new coverage signal appeared for this long")
+
+	// stopped is closed when one of the stop conditions fires, stopReason describes it.
+	stopped    = make(chan struct{})
+	stopOnce   sync.Once
+	stopReason string
+	// lastNewSignal is the time new signal was last seen (UnixNano).
+	lastNewSignal = time.Now().UnixNano()
+)
+
+// Exit status if the run was stopped by a stop condition.
+const exitStopCondition = 2
+
+func stop(reason string) {
+	stopOnce.Do(func() {
+		stopReason = reason
+		close(stopped)
+	})
+}
+
+// checkCrashStop is called after every crash and checks crash stop conditions.
+func checkCrashStop() {
+	if n := crashes.total(); *flagStopAfterCrashes != 0 && n >= *flagStopAfterCrashes {
+		stop(fmt.Sprintf("-stop-after-crashes: %v crashes", n))
+	}
+	if n := len(crashes.sorted()); *flagStopAfterUnique != 0 && n >= *flagStopAfterUnique {
+		stop(fmt.Sprintf("-stop-after-unique: %v unique crashes", n))
+	}
+}
+
+// noteNewSignal records that new coverage signal was found.
+func noteNewSignal() {
+	atomic.StoreInt64(&lastNewSignal, time.Now().UnixNano())
+}
+
+// checkPlateau is called periodically and checks the coverage plateau stop condition.
+func checkPlateau() {
+	if *flagStopOnPlateau == 0 {
+		return
+	}
+	if since := time.Since(time.Unix(0, atomic.LoadInt64(&lastNewSignal))); since >= *flagStopOnPlateau {
+		stop(fmt.Sprintf("-stop-on-plateau: no new signal for %v", since.Round(time.Second)))
+	}
+}
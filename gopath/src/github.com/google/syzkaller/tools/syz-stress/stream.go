@@ -0,0 +1,168 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagStream = flag.String("stream", "",
+		"listen on this UNIX socket and stream executed programs and their results as JSON lines")
+	flagStreamBuffer = flag.Int("stream-buffer", 1024,
+		"number of -stream events buffered per client, events are dropped for clients that fall behind")
+
+	streamListener   net.Listener
+	streamMu         sync.Mutex
+	streamClients    = make(map[*streamClient]bool)
+	statStreamDrops  uint64
+	statStreamEvents uint64
+)
+
+// streamEvent is sent to -stream clients for every executed program, one JSON object per line.
+// The simplest client is socat - UNIX-CONNECT:/path/to.sock
+type streamEvent struct {
+	Time   time.Time
+	Pid    int
+	Prog   string
+	Result string // ok, warning, crash, hang or error
+	Title  string `json:",omitempty"` // crash or kernel warning title
+}
+
+type streamClient struct {
+	conn    net.Conn
+	events  chan []byte
+	dropped uint64
+}
+
+func initStream(file string) error {
+	if *flagStreamBuffer <= 0 {
+		return fmt.Errorf("-stream-buffer must be positive")
+	}
+	// Remove the socket left by a previous run, the path must not be a regular file.
+	if st, err := os.Lstat(file); err == nil {
+		if st.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("-stream %v exists and is not a socket", file)
+		}
+		os.Remove(file)
+	}
+	ln, err := net.Listen("unix", file)
+	if err != nil {
+		return fmt.Errorf("failed to listen on -stream socket: %v", err)
+	}
+	streamListener = ln
+	go acceptStreamClients(ln)
+	return nil
+}
+
+func acceptStreamClients(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			// The listener is closed by finishStream.
+			return
+		}
+		client := &streamClient{
+			conn:   conn,
+			events: make(chan []byte, *flagStreamBuffer),
+		}
+		streamMu.Lock()
+		streamClients[client] = true
+		streamMu.Unlock()
+		go client.loop()
+	}
+}
+
+// loop writes events to the client until it disconnects or the stream is closed.
+func (client *streamClient) loop() {
+	defer client.conn.Close()
+	for data := range client.events {
+		if _, err := client.conn.Write(data); err != nil {
+			break
+		}
+	}
+	streamMu.Lock()
+	if streamClients[client] {
+		delete(streamClients, client)
+		close(client.events)
+	}
+	streamMu.Unlock()
+	if n := atomic.LoadUint64(&client.dropped); n != 0 {
+		log.Logf(0, "stream client disconnected, %v events were dropped", n)
+	}
+}
+
+// streamResult sends the execution result of a program to all -stream clients.
+// It never blocks, events are dropped for clients whose buffer is full.
+func streamResult(pid int, p *prog.Prog, crashed, hanged bool, err error, title string) {
+	streamMu.Lock()
+	nclients := len(streamClients)
+	streamMu.Unlock()
+	if nclients == 0 {
+		return
+	}
+	ev := &streamEvent{
+		Time:   time.Now(),
+		Pid:    pid,
+		Prog:   string(p.Serialize()),
+		Result: resultName(crashed, hanged, err, title),
+		Title:  title,
+	}
+	line, jerr := json.Marshal(ev)
+	if jerr != nil {
+		log.Fatalf("failed to marshal stream event: %v", jerr)
+	}
+	line = append(line, '\n')
+	atomic.AddUint64(&statStreamEvents, 1)
+	streamMu.Lock()
+	defer streamMu.Unlock()
+	for client := range streamClients {
+		select {
+		case client.events <- line:
+		default:
+			atomic.AddUint64(&client.dropped, 1)
+			atomic.AddUint64(&statStreamDrops, 1)
+		}
+	}
+}
+
+func resultName(crashed, hanged bool, err error, title string) string {
+	switch {
+	case hanged:
+		return "hang"
+	case crashed:
+		return "crash"
+	case title != "":
+		return "warning"
+	case err != nil:
+		return "error"
+	default:
+		return "ok"
+	}
+}
+
+// finishStream stops accepting clients, removes the socket and lets connected clients
+// exit once they have written out their buffered events.
+func finishStream() {
+	if streamListener == nil {
+		return
+	}
+	streamListener.Close()
+	streamMu.Lock()
+	for client := range streamClients {
+		delete(streamClients, client)
+		close(client.events)
+	}
+	streamMu.Unlock()
+}
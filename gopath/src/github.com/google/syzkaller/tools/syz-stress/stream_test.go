@@ -0,0 +1,201 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/prog"
+)
+
+// streamReader is a reference -stream client: it connects to the socket
+// and decodes events until syz-stress closes the connection.
+type streamReader struct {
+	conn   net.Conn
+	events chan streamEvent
+	err    error
+}
+
+func dialStream(t *testing.T, file string) *streamReader {
+	conn, err := net.Dial("unix", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &streamReader{conn: conn, events: make(chan streamEvent, 1<<16)}
+}
+
+// run reads events, it returns at the end of the stream.
+func (r *streamReader) run() {
+	defer close(r.events)
+	defer r.conn.Close()
+	s := bufio.NewScanner(r.conn)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var ev streamEvent
+		if err := json.Unmarshal(s.Bytes(), &ev); err != nil {
+			r.err = err
+			return
+		}
+		r.events <- ev
+	}
+	r.err = s.Err()
+}
+
+// waitStreamClients waits until syz-stress has accepted n clients.
+func waitStreamClients(t *testing.T, n int) {
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		streamMu.Lock()
+		got := len(streamClients)
+		streamMu.Unlock()
+		if got == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v stream clients connected, want %v", got, n)
+		}
+	}
+}
+
+func startTestStream(t *testing.T, buffer int) (string, func()) {
+	dir, err := ioutil.TempDir("", "syz-stress-stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore := setFlags(t, map[string]string{"stream-buffer": fmt.Sprint(buffer)})
+	file := filepath.Join(dir, "stream.sock")
+	if err := initStream(file); err != nil {
+		t.Fatal(err)
+	}
+	return file, func() {
+		finishStream()
+		streamListener = nil
+		restore()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStream(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := target.Generate(rand.NewSource(0), 5, target.DefaultChoiceTable())
+	file, stop := startTestStream(t, 100)
+	defer stop()
+	r1, r2 := dialStream(t, file), dialStream(t, file)
+	go r1.run()
+	go r2.run()
+	waitStreamClients(t, 2)
+	results := []struct {
+		crashed, hanged bool
+		err             error
+		title           string
+		want            string
+	}{
+		{want: "ok"},
+		{crashed: true, title: "KASAN: slab-out-of-bounds Write in foo", want: "crash"},
+		{crashed: true, hanged: true, want: "hang"},
+		{title: "WARNING in bar", want: "warning"},
+		{err: errors.New("executor failed"), want: "error"},
+	}
+	for pid, res := range results {
+		streamResult(pid, p, res.crashed, res.hanged, res.err, res.title)
+	}
+	// A client connected later gets only the later events.
+	r3 := dialStream(t, file)
+	go r3.run()
+	waitStreamClients(t, 3)
+	streamResult(100, p, false, false, nil, "")
+	stop()
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("the socket is not removed: %v", err)
+	}
+	for i, r := range []*streamReader{r1, r2, r3} {
+		var got []streamEvent
+		for ev := range r.events {
+			got = append(got, ev)
+		}
+		if r.err != nil {
+			t.Fatalf("client %v: %v", i, r.err)
+		}
+		want := len(results) + 1
+		if i == 2 {
+			want = 1
+		}
+		if len(got) != want {
+			t.Fatalf("client %v got %v events, want %v", i, len(got), want)
+		}
+		for j, ev := range got {
+			pid := 100
+			res := results[0]
+			if i != 2 && j < len(results) {
+				pid, res = j, results[j]
+			}
+			if ev.Pid != pid || ev.Result != res.want || ev.Title != res.title ||
+				ev.Prog != string(p.Serialize()) || ev.Time.IsZero() {
+				t.Errorf("client %v: event %v: got %+v, want pid %v, result %v, title %q",
+					i, j, ev, pid, res.want, res.title)
+			}
+		}
+	}
+}
+
+// TestStreamSlowClient checks that a client that does not read does not block execution,
+// and that it later gets the buffered events while the rest are counted as dropped.
+func TestStreamSlowClient(t *testing.T) {
+	const (
+		buffer = 10
+		events = 10000
+	)
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := target.Generate(rand.NewSource(0), 30, target.DefaultChoiceTable())
+	file, stop := startTestStream(t, buffer)
+	defer stop()
+	r := dialStream(t, file)
+	waitStreamClients(t, 1)
+	var client *streamClient
+	streamMu.Lock()
+	for c := range streamClients {
+		client = c
+	}
+	streamMu.Unlock()
+	drops := atomic.LoadUint64(&statStreamDrops)
+	start := time.Now()
+	for i := 0; i < events; i++ {
+		streamResult(0, p, false, false, nil, "")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("streaming took %v", d)
+	}
+	dropped := atomic.LoadUint64(&client.dropped)
+	if dropped == 0 || atomic.LoadUint64(&statStreamDrops)-drops != dropped {
+		t.Fatalf("dropped %v events, counted %v", dropped, atomic.LoadUint64(&statStreamDrops)-drops)
+	}
+	go r.run()
+	stop()
+	received := uint64(0)
+	for range r.events {
+		received++
+	}
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if received+dropped != events || received < buffer {
+		t.Fatalf("received %v events, dropped %v, sent %v", received, dropped, events)
+	}
+}
@@ -6,12 +6,16 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"os/signal"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/google/syzkaller/pkg/csource"
@@ -21,34 +25,119 @@ import (
 	"github.com/google/syzkaller/pkg/ipc/ipcconfig"
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/google/syzkaller/prog"
 	_ "github.com/google/syzkaller/sys"
 )
 
 var (
-	flagOS       = flag.String("os", runtime.GOOS, "target os")
-	flagArch     = flag.String("arch", runtime.GOARCH, "target arch")
-	flagCorpus   = flag.String("corpus", "", "corpus database")
-	flagOutput   = flag.Bool("output", false, "print executor output to console")
-	flagProcs    = flag.Int("procs", 2*runtime.NumCPU(), "number of parallel processes")
-	flagLogProg  = flag.Bool("logprog", false, "print programs before execution")
-	flagGenerate = flag.Bool("generate", true, "generate new programs, otherwise only mutate corpus")
-	flagSyscalls = flag.String("syscalls", "", "comma-separated list of enabled syscalls")
-	flagEnable   = flag.String("enable", "none", "enable only listed additional features")
-	flagDisable  = flag.String("disable", "none", "enable all additional features except listed")
-
-	statExec uint64
-	gate     *ipc.Gate
+	flagOS        = flag.String("os", runtime.GOOS, "target os")
+	flagArch      = flag.String("arch", runtime.GOARCH, "target arch")
+	flagArch2     = flag.String("arch2", "", "second target arch to fuzz simultaneously (e.g. 386 for compat syscalls)")
+	flagExecutor2 = flag.String("executor2", "", "path to executor binary for -arch2")
+	flagCorpus    = flag.String("corpus", "", "corpus database")
+	flagOutput    = flag.Bool("output", false, "print executor output to console")
+	flagProcs     = flag.Int("procs", 2*runtime.NumCPU(), "number of parallel processes")
+	flagLogProg   = flag.Bool("logprog", false, "print programs before execution")
+	flagGenerate  = flag.Bool("generate", true, "generate new programs, otherwise only mutate corpus")
+	flagSyscalls  = flag.String("syscalls", "", "comma-separated list of enabled syscalls")
+	flagEnable    = flag.String("enable", "none", "enable only listed additional features")
+	flagDisable   = flag.String("disable", "none", "enable all additional features except listed")
+	flagCrashdir  = flag.String("crashdir", "", "directory to save programs that hang or fail to execute")
+	flagAnnotate  = flag.Bool("annotate", false, "also save annotated programs to crashdir")
+	flagDumpCT    = flag.String("dump-choicetable", "", "write choice table weights to this file (csv or json)")
+	flagDryRun    = flag.Bool("dryrun", false, "set up fuzzing and exit without executing programs")
+	flagQuiet     = flag.Bool("quiet", false, "print only crashes, exit with non-zero status if any crashes occurred")
+	flagSeedProg  = flag.String("seedprog", "", "file with a single program, all executed programs are its mutants")
+	flagValidate  = flag.Bool("validate", false, "validate programs before execution and skip invalid ones")
+	flagMinCorpus = flag.Int("min-corpus", 10, "minimum number of corpus programs for -generate=false")
+
+	statExec    uint64
+	statInvalid uint64
+	statGenFail uint64
+	gate        *ipc.Gate
 )
 
 const programLength = 30
 
 func main() {
+	if size := os.Getenv(balloonEnv); size != "" {
+		os.Exit(runBalloon(size))
+	}
 	flag.Usage = func() {
 		flag.PrintDefaults()
 		csource.PrintAvailableFeaturesFlags()
+		fmt.Fprintf(flag.CommandLine.Output(), "any flag can also be set with %vFLAG_NAME environment variable,\n"+
+			"e.g. %v for -max-crashdir-size\n", envPrefix, flagEnvName("max-crashdir-size"))
+	}
+	if err := setFlagsFromEnv(flag.CommandLine); err != nil {
+		log.Fatalf("%v", err)
 	}
+	// Go ignores SIGPIPE for writes to pipes other than stdout/stderr, but a broken stdout
+	// (e.g. output piped to head) would kill the process on the next executor output dump.
+	// With SIGPIPE ignored, such writes fail with EPIPE instead.
+	signal.Ignore(syscall.SIGPIPE)
 	flag.Parse()
+	if *flagConfig != "" {
+		if err := loadConfig(flag.CommandLine, *flagConfig); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagPrintConfig {
+		if err := printConfig(os.Stdout, flag.CommandLine); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+	os.Exit(Run(defaultRunConfig()))
+}
+
+// RunConfig holds the dependencies of a run on the host and the executor,
+// tests replace them with fakes.
+type RunConfig struct {
+	// MakeEnv creates the execution environment of a proc.
+	MakeEnv func(config *ipc.Config, pid int) (executor, error)
+	// SetupHost checks the host features and sets the host up for fuzzing target.
+	SetupHost func(target *prog.Target) (*host.Features, error)
+	// LoadCorpus returns the programs of -corpus.
+	LoadCorpus func(target *prog.Target) []*prog.Prog
+	// Shutdown is closed to stop fuzzing. If it's nil, fuzzing is stopped by SIGINT.
+	Shutdown <-chan struct{}
+}
+
+func defaultRunConfig() *RunConfig {
+	return &RunConfig{
+		MakeEnv:    makeIPCEnv,
+		SetupHost:  setupHost,
+		LoadCorpus: readCorpus,
+	}
+}
+
+func setupHost(target *prog.Target) (*host.Features, error) {
+	features, err := host.Check(target)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := host.Setup(target, features); err != nil {
+		return nil, err
+	}
+	return features, nil
+}
+
+// Run runs syz-stress with the parsed flags and returns the exit status.
+func Run(cfg *RunConfig) int {
+	makeEnv = cfg.MakeEnv
+	initRunID()
+	if err := initOutput(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *flagCompare != "" {
+		if flag.NArg() != 1 {
+			log.Fatalf("usage: -compare crashdirA crashdirB")
+		}
+		runCompare(*flagCompare, flag.Arg(0))
+		return 0
+	}
 	featuresFlags, err := csource.ParseFeaturesFlags(*flagEnable, *flagDisable, true)
 	if err != nil {
 		log.Fatalf("%v", err)
@@ -57,23 +146,429 @@ func main() {
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
-	corpus := readCorpus(target)
-	log.Logf(0, "parsed %v programs", len(corpus))
-	if !*flagGenerate && len(corpus) == 0 {
-		log.Fatalf("nothing to mutate (-generate=false and no corpus)")
+	if *flagMigrate != "" {
+		if err := loadMigrations(target, *flagMigrate); err != nil {
+			log.Fatalf("failed to load syscall renames: %v", err)
+		}
 	}
-
-	features, err := host.Check(target)
+	if *flagSanitizeCorpus != "" {
+		sanitizeCorpus(target, *flagSanitizeCorpus)
+		return 0
+	}
+	if *flagCorpusConstants != "" {
+		writeCorpusConstants(target, *flagCorpusConstants)
+		return 0
+	}
+	initCrashes(target)
+	initCrashTypes()
+	if *flagAvoidHangs {
+		initAvoidHangs(target)
+	}
+	if *flagUploadCmd != "" {
+		if *flagCrashdir == "" {
+			log.Fatalf("-upload-cmd requires -crashdir")
+		}
+		startUploads(target)
+	}
+	features, err := cfg.SetupHost(target)
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
-	if _, err = host.Setup(target, features); err != nil {
+
+	if err := parseShard(*flagShard); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *flagAdaptiveLen != "" {
+		if err := initAdaptiveLen(*flagAdaptiveLen); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagTemperature <= 0 {
+		log.Fatalf("-temperature must be positive")
+	}
+	if err := checkNgramFlag(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkSpliceFlags(); err != nil {
 		log.Fatalf("%v", err)
 	}
+	if err := checkShmemSize(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkSaveCorpus(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	corpus := cfg.LoadCorpus(target)
+	if *flagMinKernel != "" {
+		if corpus, err = filterKernelVersion(target, corpus); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if shardCount != 0 {
+		all := len(corpus)
+		corpus = shardCorpus(corpus)
+		log.Logf(0, "shard %v: using %v/%v corpus programs", shardName(), len(corpus), all)
+	}
+	if *flagSeedProg != "" {
+		if *flagCorpus != "" {
+			log.Fatalf("-seedprog and -corpus are mutually exclusive")
+		}
+		corpus = []*prog.Prog{readProgFile(target, *flagSeedProg)}
+	}
+	targets := []*fuzzTarget{setupTarget(target, corpus, featuresFlags, features)}
+	checkFeatureConflicts(featuresFlags, features, targets[0].calls)
+	if err := checkTimeoutJitter(targets[0].config); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := checkHooks(targets[0].config); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *flagInitPrograms != "" {
+		if targets[0].initProgs, err = loadInitPrograms(target, *flagInitPrograms); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagPair != "" {
+		data, err := ioutil.ReadFile(*flagPair)
+		if err != nil {
+			log.Fatalf("failed to read program group: %v", err)
+		}
+		if targets[0].pair, err = target.DeserializeGroup(data, prog.NonStrict); err != nil {
+			log.Fatalf("failed to parse program group: %v", err)
+		}
+	}
+	if *flagSeedProg != "" {
+		targets[0].mutateOnly = true
+		for _, c := range corpus[0].Calls {
+			if !targets[0].calls[c.Meta] {
+				log.Logf(0, "warning: seed program uses disabled syscall %v", c.Meta.Name)
+			}
+		}
+	}
+	if *flagVuln != "" {
+		applyVuln(targets[0], *flagVuln)
+	}
+	if *flagReproBundle {
+		if *flagCrashdir == "" {
+			log.Fatalf("-repro-bundle requires -crashdir")
+		}
+		initReproOpts(targets[0])
+	}
+	if *flagArch2 != "" {
+		if !*flagGenerate {
+			log.Fatalf("-arch2 requires -generate (the corpus is loaded only for -arch)")
+		}
+		target2, err := prog.GetTarget(*flagOS, *flagArch2)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		ft := setupTarget(target2, nil, featuresFlags, features)
+		if *flagExecutor2 != "" {
+			ft.config.Executor = *flagExecutor2
+		}
+		targets = append(targets, ft)
+	}
+	if *flagPrintEnabled != "" {
+		if err := writeEnabledCalls(*flagPrintEnabled, targets[0].calls); err != nil {
+			log.Fatalf("failed to write enabled syscalls: %v", err)
+		}
+	}
+	if *flagDumpCT != "" {
+		if err := dumpChoiceTable(*flagDumpCT, target, targets[0].choiceTable()); err != nil {
+			log.Fatalf("failed to dump choice table: %v", err)
+		}
+	}
+	if *flagDryRun {
+		return 0
+	}
+	if *flagEnumerate != "" {
+		if *flagSeedProg == "" {
+			log.Fatalf("-enumerate requires -seedprog")
+		}
+		return runEnumerate(targets[0], corpus[0], *flagEnumerate)
+	}
+	if *flagReplaySession != "" {
+		runReplaySession(targets[0], *flagReplaySession)
+		return 0
+	}
+	if *flagReplayConcurrent != "" {
+		runReplayConcurrent(targets[0], *flagReplayConcurrent)
+		return 0
+	}
+	if *flagREPL {
+		var p *prog.Prog
+		if *flagSeedProg != "" {
+			p = corpus[0]
+		}
+		runREPL(targets[0], p)
+		return 0
+	}
+	if *flagCorpusRegression {
+		if len(corpus) == 0 {
+			log.Fatalf("-corpus-regression requires a non-empty -corpus")
+		}
+		return runCorpusRegression(targets[0])
+	}
+	if *flagRecord != "" {
+		initRecord(*flagRecord)
+	}
+	procs := numExecProcs() * len(targets)
+	checkOversubscription(procs)
+	initInflight(procs)
+	if *flagProgressTimeout != 0 {
+		startProgressWatchdog(procs, *flagProgressTimeout)
+	}
+	if *flagWorkerTimeout != 0 {
+		startWorkerWatchdog(procs, *flagWorkerTimeout)
+	}
+	if *flagLoadLimit != 0 {
+		startThrottle(procs, *flagLoadLimit)
+	}
+	if *flagMemCap != "" {
+		initMemCap()
+	}
+	if *flagBurst != "" {
+		if err := startBurst(*flagBurst); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	initDedup()
+	if *flagCollectCores != "" {
+		if err := initCores(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagReapInterval != 0 {
+		if err := startReaper(*flagReapInterval); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagStream != "" {
+		if err := initStream(*flagStream); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagSeenFilter != "" {
+		if err := loadSeenFilter(*flagSeenFilter); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagSample != "" {
+		if err := startSampling(*flagSample, *flagSampleInterval); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if err := initPreopen(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if *flagWatchCall != "" {
+		if err := initWatchCalls(target); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagFlushBetween {
+		if err := initFlush(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagDiffOpts != "" {
+		if err := initDiff(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagWorkdirQuota != "" || *flagDiskMinFree != "" {
+		if err := startWorkspace(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagTimewarp != "" {
+		if err := startTimewarp(*flagTimewarp); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagCycleModule != "" {
+		if err := startModuleCycle(*flagCycleModule); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if *flagReprioritize != 0 {
+		for _, ft := range targets {
+			startReprioritize(ft, *flagReprioritize)
+		}
+	}
+	if *flagBaselineSignal != "" {
+		if err := loadBaselineSignal(*flagBaselineSignal); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	initCollapse(procs)
+	if *flagPrewarm {
+		for _, ft := range targets {
+			prewarmExecutor(ft.config.Executor)
+		}
+	}
+	if *flagBalloon != "" {
+		if err := startBalloons(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	gate = ipc.NewGate(2*procs, nil)
+	for i, ft := range targets {
+		startProcs(ft, i*numExecProcs(), numExecProcs())
+	}
+	if *flagHTTP != "" {
+		serveMetrics(*flagHTTP)
+	}
+	shutdown := cfg.Shutdown
+	if shutdown == nil {
+		interrupts := make(chan struct{})
+		osutil.HandleInterrupts(interrupts)
+		shutdown = interrupts
+	}
+	ticker := time.NewTicker(5 * time.Second)
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			recordSample()
+			if !*flagQuiet {
+				log.Logf(0, "%v", statsLine())
+			}
+			checkPlateau()
+		case <-shutdown:
+			break loop
+		case <-stopped:
+			break loop
+		}
+	}
+	drain(*flagDrainTimeout)
+	finishBalloons()
+	finishCores()
+	finishStream()
+	finishTimewarp()
+	finishSampling()
+	if seenFilter != nil {
+		saveSeenFilter(*flagSeenFilter)
+	}
+	printSummary(targets)
+	if *flagReport != "" {
+		if err := writeReport(*flagReport, targets); err != nil {
+			log.Logf(0, "failed to write report: %v", err)
+		}
+	}
+	if *flagCoverageMatrix != "" {
+		if err := writeCallMatrix(*flagCoverageMatrix); err != nil {
+			log.Logf(0, "failed to write coverage matrix: %v", err)
+		}
+	}
+	if *flagExportSignal != "" {
+		if err := exportSignal(*flagExportSignal); err != nil {
+			log.Logf(0, "failed to export signal: %v", err)
+		}
+	}
+	finishUploads()
+	if stopReason != "" {
+		fmt.Printf("stopped by %v\n", stopReason)
+		return exitStopCondition
+	}
+	if *flagQuiet && crashes.total() != 0 {
+		return 1
+	}
+	return 0
+}
 
-	calls := buildCallList(target, strings.Split(*flagSyscalls, ","))
-	prios := target.CalculatePriorities(corpus)
-	ct := target.BuildChoiceTable(prios, calls)
+// fuzzTarget holds the generation pipeline for a single target.
+type fuzzTarget struct {
+	target   *prog.Target
+	corpus   []*prog.Prog
+	calls    map[*prog.Syscall]bool
+	weights  map[int]float32 // -call-weights indexed by syscall ID
+	boost    map[int]float32 // -boost-calls indexed by syscall ID
+	prios    [][]float32
+	ct       atomic.Value // *prog.ChoiceTable, replaced by reprioritization
+	ngrams   atomic.Value // *ngramTable the choice table was built with, only with -ngram
+	config   *ipc.Config
+	execOpts *ipc.ExecOpts
+	tmpl     *prog.Template
+	// Per-syscall number of executions and signal, indexed by syscall ID.
+	callExecs  []uint64
+	callSignal []uint64
+	sched      *banditScheduler
+	pair       *prog.Group
+	// mutateOnly disables generation, all programs are mutants of corpus programs.
+	mutateOnly bool
+	// corpusMu protects corpus, which grows with -savecorpus.
+	corpusMu sync.RWMutex
+	// corpusVersion is incremented under corpusMu whenever corpus changes, it's read atomically.
+	corpusVersion uint64
+	// initProgs are executed on every new executor before fuzzing.
+	initProgs []*prog.Prog
+	// callsMu protects replacement of calls while fuzzing.
+	callsMu sync.Mutex
+	learn   *callLearner
+}
+
+func (ft *fuzzTarget) choiceTable() *prog.ChoiceTable {
+	return ft.ct.Load().(*prog.ChoiceTable)
+}
+
+func setupTarget(target *prog.Target, corpus []*prog.Prog, featuresFlags csource.Features,
+	features *host.Features) *fuzzTarget {
+	log.Logf(0, "%v/%v: parsed %v programs", target.OS, target.Arch, len(corpus))
+	if !*flagGenerate && len(corpus) == 0 {
+		log.Fatalf("nothing to mutate (-generate=false and no corpus)")
+	}
+	// Mutating a handful of programs only overfits to them. -seedprog asks for that explicitly.
+	if !*flagGenerate && *flagSeedProg == "" && len(corpus) < *flagMinCorpus {
+		log.Fatalf("corpus is too small for mutation only: %v programs, -min-corpus is %v;"+
+			" enable -generate, provide a larger -corpus or lower -min-corpus", len(corpus), *flagMinCorpus)
+	}
+	ft := &fuzzTarget{
+		target:     target,
+		corpus:     corpus,
+		calls:      buildCallList(target, strings.Split(*flagSyscalls, ",")),
+		callExecs:  make([]uint64, len(target.Syscalls)),
+		callSignal: make([]uint64, len(target.Syscalls)),
+	}
+	if *flagLearnFile != "" && !*flagNoLearn {
+		ft.calls = disableLearned(target, ft.calls, *flagLearnFile)
+	}
+	if *flagCallWeights != "" {
+		weights, err := loadCallWeights(target, *flagCallWeights)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		ft.weights = weights
+		ft.calls = disableZeroWeightCalls(target, ft.calls, weights)
+	}
+	if *flagResourceTypes != "" {
+		calls, err := restrictResources(target, ft.calls, *flagResourceTypes)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		ft.calls = calls
+	}
+	if *flagBoostCalls != "" {
+		boost, err := loadBoost(target, *flagBoostCalls, ft.calls)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		ft.boost = boost
+	}
+	if !*flagNoLearn {
+		ft.learn = newCallLearner(ft)
+	}
+	ft.prios = ft.calculatePriorities()
+	ft.ct.Store(target.BuildChoiceTable(ft.prios, ft.calls))
+	if *flagTemplate != "" {
+		data, err := ioutil.ReadFile(*flagTemplate)
+		if err != nil {
+			log.Fatalf("failed to read template: %v", err)
+		}
+		if ft.tmpl, err = target.ParseTemplate(data); err != nil {
+			log.Fatalf("failed to parse template: %v", err)
+		}
+	}
 
 	config, execOpts, err := ipcconfig.Default(target)
 	if err != nil {
@@ -97,59 +592,181 @@ func main() {
 	if featuresFlags["close_fds"].Enabled {
 		config.Flags |= ipc.FlagEnableCloseFds
 	}
-	gate = ipc.NewGate(2**flagProcs, nil)
-	for pid := 0; pid < *flagProcs; pid++ {
-		pid := pid
-		go func() {
-			env, err := ipc.MakeEnv(config, pid)
-			if err != nil {
-				log.Fatalf("failed to create execution environment: %v", err)
-			}
-			rs := rand.NewSource(time.Now().UnixNano() + int64(pid)*1e12)
-			rnd := rand.New(rs)
-			for i := 0; ; i++ {
-				var p *prog.Prog
-				if *flagGenerate && len(corpus) == 0 || i%4 != 0 {
-					p = target.Generate(rs, programLength, ct)
-					execute(pid, env, execOpts, p)
-					p.Mutate(rs, programLength, ct, corpus)
-					execute(pid, env, execOpts, p)
-				} else {
-					p = corpus[rnd.Intn(len(corpus))].Clone()
-					p.Mutate(rs, programLength, ct, corpus)
-					execute(pid, env, execOpts, p)
-					p.Mutate(rs, programLength, ct, corpus)
-					execute(pid, env, execOpts, p)
-				}
-			}
-		}()
+	ft.config = config
+	ft.execOpts = execOpts
+	switch *flagScheduler {
+	case "uniform":
+	case "bandit":
+		if config.Flags&ipc.FlagSignal == 0 {
+			log.Fatalf("-scheduler=bandit requires coverage (-cover)")
+		}
+		if len(corpus) != 0 {
+			ft.sched = newBanditScheduler(len(corpus))
+		}
+	default:
+		log.Fatalf("unknown -scheduler %q", *flagScheduler)
 	}
-	for range time.NewTicker(5 * time.Second).C {
-		log.Logf(0, "executed %v programs", atomic.LoadUint64(&statExec))
+	return ft
+}
+
+// chooseCorpus returns the index of a program in corpus, a result of getCorpus.
+func (ft *fuzzTarget) chooseCorpus(rnd *rand.Rand, corpus []*prog.Prog) int {
+	if ft.sched != nil {
+		return ft.sched.choose(rnd)
 	}
+	return rnd.Intn(len(corpus))
 }
 
-var outMu sync.Mutex
+func (ft *fuzzTarget) generate(rs rand.Source) *prog.Prog {
+	if ft.tmpl == nil {
+		return ft.target.Generate(rs, progLen(), ft.choiceTable())
+	}
+	return prog.FillTemplate(ft.target, ft.tmpl, rs, ft.choiceTable())
+}
 
-func execute(pid int, env *ipc.Env, execOpts *ipc.ExecOpts, p *prog.Prog) {
-	atomic.AddUint64(&statExec, 1)
-	if *flagLogProg {
-		ticket := gate.Enter()
-		defer gate.Leave(ticket)
-		outMu.Lock()
-		fmt.Printf("executing program %v\n%s\n", pid, p.Serialize())
-		outMu.Unlock()
+func printSummary(targets []*fuzzTarget) {
+	fmt.Printf("run %v\n", runID)
+	fmt.Printf("executed %v programs\n", atomic.LoadUint64(&statExec))
+	if n := signalSize(); n != 0 {
+		fmt.Printf("signal: %v\n", n)
+		if baselineSize != 0 {
+			fmt.Printf("signal beyond baseline: %v\n", n-baselineSize)
+		}
 	}
-	output, _, hanged, err := env.Exec(execOpts, p)
-	if err != nil {
-		fmt.Printf("failed to execute executor: %v\n", err)
+	fmt.Printf("crashes: %v\n%v", crashes.total(), crashes)
+	if exec := atomic.LoadUint64(&statExec); exec != 0 {
+		fmt.Printf("crash yield: %.2f per 1M executions (mutate-with-corpus=%v)\n",
+			float64(crashes.total())*1e6/float64(exec), *flagMutateWithCorpus)
+	}
+	if crashes.total() != 0 {
+		fmt.Printf("crash categories:\n%v", crashTypes)
+	}
+	fmt.Printf("kernel warnings: %v\n%v", warnings.total(), warnings)
+	if n := ignoredCrashes.total(); n != 0 {
+		fmt.Printf("crashes ignored by -ignore-output-regex: %v\n%v", n, ignoredCrashes)
+	}
+	if *flagOOB {
+		fmt.Printf("OOB sites: %v\n", oobSiteCount())
+	}
+	if n := atomic.LoadUint64(&statInvalid); n != 0 {
+		fmt.Printf("invalid programs skipped: %v\n", n)
+	}
+	if n := atomic.LoadUint64(&statGenFail); n != 0 {
+		fmt.Printf("generation/mutation failures: %v\n", n)
+	}
+	if n := atomic.LoadUint64(&statTooLarge); n != 0 {
+		fmt.Printf("programs too large to execute: %v\n", n)
+	}
+	if n := atomic.LoadUint64(&statTruncated); n != 0 {
+		fmt.Printf("programs truncated to fit execution limits: %v\n", n)
+	}
+	if n := atomic.LoadUint64(&statHotMutations); n != 0 {
+		fmt.Printf("hot-arg mutations: %v, new signal: %v, crashes: %v\n",
+			n, atomic.LoadUint64(&statHotSignal), atomic.LoadUint64(&statHotCrashes))
+	}
+	if n := atomic.LoadUint64(&statHookFail); n != 0 {
+		fmt.Printf("hook failures: %v\n", n)
+	}
+	if n := atomic.LoadUint64(&statRecycle); n != 0 {
+		fmt.Printf("executor recycles on coverage collapse: %v\n", n)
+	}
+	if seenFilter != nil {
+		fmt.Printf("generated programs skipped by -seen-filter: %v, replayed: %v, false positive rate %.2g\n",
+			atomic.LoadUint64(&statSeenSkips), atomic.LoadUint64(&statSeenReplays), seenFalsePositiveRate())
+	}
+	if *flagSplice != 0 {
+		fmt.Printf("spliced programs (-splice-resources=%v): %v, failed: %v\n", *flagSpliceResources,
+			atomic.LoadUint64(&statSplices), atomic.LoadUint64(&statSpliceFails))
+	}
+	if n := atomic.LoadUint64(&statDedupLookups); n != 0 {
+		fmt.Printf("programs skipped as recently executed: %v/%v\n", atomic.LoadUint64(&statDedupHits), n)
+	}
+	if n := atomic.LoadUint64(&statInitFail); n != 0 {
+		fmt.Printf("failed init program executions: %v\n", n)
+	}
+	if *flagTimeoutJitter != 0 {
+		fmt.Printf("crash yield by executor timeout:\n%v", jitterSummary())
+	}
+	if n := atomic.LoadUint64(&statTransientHangs); n != 0 {
+		fmt.Printf("hangs that did not reproduce: %v\n", n)
+	}
+	if n := atomic.LoadUint64(&statCores); n != 0 {
+		fmt.Printf("executor core dumps: %v\n", n)
+	}
+	if *flagStream != "" {
+		fmt.Printf("stream events: %v, dropped for slow clients: %v\n",
+			atomic.LoadUint64(&statStreamEvents), atomic.LoadUint64(&statStreamDrops))
+	}
+	if n := hangFixes.total(); n != 0 {
+		fmt.Printf("hang avoidance fix-ups: %v\n%v", n, hangFixes)
+	}
+	if n := atomic.LoadUint64(&statStuck); n != 0 {
+		fmt.Printf("executor recycles of stuck procs: %v\n", n)
+	}
+	if *flagFlushBetween {
+		total, avg := flushOverhead()
+		fmt.Printf("quarantine flushes: %v, total %v, average %v\n", atomic.LoadUint64(&statFlushes),
+			total.Round(time.Millisecond), avg)
+	}
+	if *flagDiffOpts != "" {
+		fmt.Printf("programs diverging with %v: %v/%v\n", *flagDiffOpts,
+			atomic.LoadUint64(&statDiffDiverged), atomic.LoadUint64(&statDiffExec))
 	}
-	if hanged || err != nil || *flagOutput {
-		fmt.Printf("PROGRAM:\n%s\n", p.Serialize())
+	if *flagWorkdirQuota != "" || *flagDiskMinFree != "" {
+		fmt.Printf("working directory cleanups: %v, pauses on low disk space: %v\n",
+			atomic.LoadUint64(&statWorkdirCleanups), atomic.LoadUint64(&statDiskPauses))
 	}
-	if hanged || err != nil || *flagOutput {
-		os.Stdout.Write(output)
+	if *flagReapInterval != 0 {
+		fmt.Printf("reaped leaked resources: %v mounts, %v loop devices, %v processes\n",
+			atomic.LoadUint64(&statReapedMounts), atomic.LoadUint64(&statReapedLoops),
+			atomic.LoadUint64(&statReapedProcs))
 	}
+	if n := atomic.LoadUint64(&statModuleCycles); n != 0 {
+		fmt.Printf("module cycles: %v, failed to unload: %v\n", n, atomic.LoadUint64(&statModuleUnloadFail))
+	}
+	fmt.Printf("%v", progStatsSummary())
+	fmt.Printf("execution time by program length:\n%v", execTimeTable())
+	if table := lenHistTable(); table != "" {
+		fmt.Printf("executed program lengths (%v):\n%v", lenPercentiles(), table)
+	}
+	if adaptive != nil {
+		fmt.Printf("program length over time:\n%v", adaptive.trajectory())
+	}
+	for _, ft := range targets {
+		if t, ok := ft.ngrams.Load().(*ngramTable); ok {
+			fmt.Printf("most frequent corpus n-grams:\n%v", t.top(10))
+		}
+	}
+	for _, ft := range targets {
+		if ft.sched == nil {
+			continue
+		}
+		fmt.Printf("most productive corpus programs:\n")
+		for _, idx := range ft.sched.top(10) {
+			fmt.Printf("%6v new signal: #%v %v\n", atomic.LoadUint64(&ft.sched.totals[idx]), idx,
+				callNames(ft.corpus[idx]))
+		}
+	}
+}
+
+func callNames(p *prog.Prog) string {
+	var names []string
+	for _, c := range p.Calls {
+		names = append(names, c.Meta.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// validateProg checks that p is a valid program. Deserialize always validates
+// the resulting program, so a strict round trip catches malformed programs.
+func validateProg(p *prog.Prog) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	_, err = p.Target.Deserialize(p.Serialize(), prog.Strict)
+	return err
 }
 
 func readCorpus(target *prog.Target) []*prog.Prog {
@@ -160,17 +777,63 @@ func readCorpus(target *prog.Target) []*prog.Prog {
 	if err != nil {
 		log.Fatalf("failed to open corpus database: %v", err)
 	}
+	var keys []string
+	for key := range db.Records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 	var progs []*prog.Prog
-	for _, rec := range db.Records {
-		p, err := target.Deserialize(rec.Val, prog.NonStrict)
+	migrated, dropped := 0, 0
+	renamed := make(map[string]int)
+	for _, key := range keys {
+		data := db.Records[key].Val
+		var variants []*prog.Prog
+		if migration != nil {
+			var counts map[string]int
+			variants, counts, err = migrateProg(data)
+			if len(counts) != 0 {
+				migrated++
+				if len(variants) == 0 {
+					dropped++
+				}
+			}
+			for old, n := range counts {
+				renamed[old] += n
+			}
+		} else {
+			var p *prog.Prog
+			p, err = target.Deserialize(data, prog.NonStrict)
+			variants = append(variants, p)
+		}
 		if err != nil {
 			log.Fatalf("failed to deserialize corpus program: %v", err)
 		}
-		progs = append(progs, p)
+		for _, p := range variants {
+			if *flagLineage {
+				corpusKeys[p] = key
+			}
+			progs = append(progs, p)
+		}
+	}
+	if migrated != 0 {
+		log.Logf(0, "migrated %v corpus programs (%v dropped), renamed calls: %v",
+			migrated, dropped, migrationCounts(renamed))
 	}
 	return progs
 }
 
+func readProgFile(target *prog.Target, file string) *prog.Prog {
+	data, err := readArtifact(file)
+	if err != nil {
+		log.Fatalf("failed to read program: %v", err)
+	}
+	p, err := target.Deserialize(data, prog.NonStrict)
+	if err != nil {
+		log.Fatalf("failed to deserialize program %v: %v", file, err)
+	}
+	return p
+}
+
 func buildCallList(target *prog.Target, enabled []string) map[*prog.Syscall]bool {
 	if *flagOS != runtime.GOOS {
 		// This is currently used on akaros, where syz-stress runs on host.
@@ -0,0 +1,27 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"math"
+)
+
+// Temperature T raises every call priority to the power of 1/T. T=1 keeps priorities as is.
+// With T>1 priorities get closer to each other, so generation explores rarely related calls
+// (broader coverage); with T<1 the highest priorities dominate, so generation concentrates
+// on call sequences known to be related (deeper coverage of fewer calls).
+var flagTemperature = flag.Float64("temperature", 1, "choice table temperature: >1 flattens call priorities "+
+	"for broader exploration, <1 concentrates on top priority calls")
+
+func applyTemperature(prios [][]float32, temp float64) {
+	if temp == 1 {
+		return
+	}
+	for i := range prios {
+		for j, prio := range prios[i] {
+			prios[i][j] = float32(math.Pow(float64(prio), 1/temp))
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+)
+
+var flagTemplate = flag.String("template", "", "file with a program template, all generated programs are its instances")
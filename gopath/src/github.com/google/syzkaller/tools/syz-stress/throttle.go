@@ -0,0 +1,87 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagLoadLimit = flag.Float64("loadlimit", 0, "pause half of procs while 1-minute load average exceeds this value")
+
+	// execSem limits the number of concurrently executing procs, nil if there is no limit.
+	execSem chan struct{}
+	// Number of procs paused due to high load and the last seen load average (float bits).
+	statThrottled uint64
+	statLoad      uint64
+)
+
+// startThrottle periodically checks the load average and takes half of procs' execution
+// slots away while the load exceeds limit.
+func startThrottle(procs int, limit float64) {
+	execSem = make(chan struct{}, procs)
+	for i := 0; i < procs; i++ {
+		execSem <- struct{}{}
+	}
+	go func() {
+		pause := procs / 2
+		taken := 0
+		for range time.NewTicker(5 * time.Second).C {
+			load, err := loadAverage()
+			if err != nil {
+				log.Logf(0, "failed to read load average: %v", err)
+				continue
+			}
+			atomic.StoreUint64(&statLoad, math.Float64bits(load))
+			switch {
+			case load > limit && taken == 0 && pause != 0:
+				log.Logf(0, "load average %.2f exceeds %v, pausing %v procs", load, limit, pause)
+				for ; taken < pause; taken++ {
+					<-execSem
+				}
+			case load <= limit && taken != 0:
+				log.Logf(0, "load average %.2f is below %v, resuming %v procs", load, limit, taken)
+				for ; taken > 0; taken-- {
+					execSem <- struct{}{}
+				}
+			}
+			atomic.StoreUint64(&statThrottled, uint64(taken))
+		}
+	}()
+}
+
+// acquireExec blocks while the proc is paused due to high load.
+func acquireExec() {
+	if execSem != nil {
+		<-execSem
+	}
+}
+
+func releaseExec() {
+	if execSem != nil {
+		execSem <- struct{}{}
+	}
+}
+
+// loadAverage returns the 1-minute load average.
+func loadAverage() (float64, error) {
+	data, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty /proc/loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
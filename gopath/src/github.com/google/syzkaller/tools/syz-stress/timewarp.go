@@ -0,0 +1,187 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagTimewarp = flag.String("timewarp", "", "periodically jump and slew the system clock between executions, "+
+		"e.g. jump:1h,slew:500ppm,interval:30s (requires CAP_SYS_TIME, the clock is restored on exit)")
+
+	// timewarpSeq is the sequence number of the last warp event, timewarpTime is its time (UnixNano).
+	timewarpSeq  uint64
+	timewarpTime int64
+	// timewarpOffset is the sum of all jumps, it's undone on exit.
+	timewarpOffset time.Duration
+	timewarpFreq   int64 // frequency before the first slew, restored on exit
+	timewarpSlewed bool
+	// timewarpStop is closed by finishTimewarp. timewarpMu serializes warps with
+	// the restore, the controller may still be waiting for executions to pause then.
+	timewarpStop chan struct{}
+	timewarpMu   sync.Mutex
+)
+
+// Crashes saved within this time after a warp event reference the event.
+const timewarpCrashWindow = 10 * time.Second
+
+// The kernel accepts frequency adjustments up to 500ppm.
+const maxSlewPPM = 500
+
+type timewarpSpec struct {
+	jump     time.Duration
+	slew     int64 // ppm
+	interval time.Duration
+}
+
+func parseTimewarp(spec string) (*timewarpSpec, error) {
+	tw := &timewarpSpec{interval: 30 * time.Second}
+	for _, part := range strings.Split(spec, ",") {
+		kv := strings.SplitN(part, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad -timewarp %q: want key:value", part)
+		}
+		var err error
+		switch kv[0] {
+		case "jump":
+			tw.jump, err = time.ParseDuration(kv[1])
+			if err == nil && tw.jump <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "slew":
+			tw.slew, err = strconv.ParseInt(strings.TrimSuffix(kv[1], "ppm"), 10, 64)
+			if err == nil && (tw.slew <= 0 || tw.slew > maxSlewPPM) {
+				err = fmt.Errorf("must be in (0, %v]", maxSlewPPM)
+			}
+		case "interval":
+			tw.interval, err = time.ParseDuration(kv[1])
+			if err == nil && tw.interval <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+		default:
+			return nil, fmt.Errorf("bad -timewarp: unknown key %q", kv[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad -timewarp %v %q: %v", kv[0], kv[1], err)
+		}
+	}
+	if tw.jump == 0 && tw.slew == 0 {
+		return nil, fmt.Errorf("bad -timewarp %q: neither jump nor slew given", spec)
+	}
+	return tw, nil
+}
+
+// startTimewarp checks that the clock can be changed and starts the warp controller.
+// Every event alternates the direction of the jump and toggles the slew,
+// so the clock oscillates around the real time instead of drifting away.
+func startTimewarp(spec string) error {
+	tw, err := parseTimewarp(spec)
+	if err != nil {
+		return err
+	}
+	if err := checkTimewarp(); err != nil {
+		return fmt.Errorf("-timewarp: %v", err)
+	}
+	if tw.slew != 0 {
+		if timewarpFreq, err = clockFreq(); err != nil {
+			return fmt.Errorf("-timewarp: %v", err)
+		}
+	}
+	timewarpStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(tw.interval)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-ticker.C:
+			case <-timewarpStop:
+				return
+			}
+			betweenExecs(func() {
+				timewarpMu.Lock()
+				defer timewarpMu.Unlock()
+				select {
+				case <-timewarpStop:
+				default:
+					warp(tw, i)
+				}
+			})
+		}
+	}()
+	return nil
+}
+
+func warp(tw *timewarpSpec, i int) {
+	var events []string
+	if tw.jump != 0 {
+		jump := tw.jump
+		if i%2 == 1 {
+			jump = -jump
+		}
+		if err := clockJump(jump); err != nil {
+			log.Logf(0, "timewarp: failed to jump the clock: %v", err)
+		} else {
+			timewarpOffset += jump
+			events = append(events, fmt.Sprintf("jumped %+v", jump))
+		}
+	}
+	if tw.slew != 0 {
+		freq, desc := timewarpFreq+tw.slew<<16, fmt.Sprintf("slewing %+vppm", tw.slew)
+		if timewarpSlewed {
+			freq, desc = timewarpFreq, "slew stopped"
+		}
+		if err := setClockFreq(freq); err != nil {
+			log.Logf(0, "timewarp: failed to adjust the clock frequency: %v", err)
+		} else {
+			timewarpSlewed = !timewarpSlewed
+			events = append(events, desc)
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+	atomic.StoreInt64(&timewarpTime, time.Now().UnixNano())
+	log.Logf(0, "timewarp %v: %v", atomic.AddUint64(&timewarpSeq, 1), strings.Join(events, ", "))
+}
+
+// finishTimewarp stops the controller and undoes all jumps and the slew.
+// It does not wait for the controller: after a drain timeout executions may never
+// pause, and the controller does not warp the clock once it's stopped.
+func finishTimewarp() {
+	if timewarpStop == nil {
+		return
+	}
+	timewarpMu.Lock()
+	defer timewarpMu.Unlock()
+	close(timewarpStop)
+	if timewarpOffset != 0 {
+		if err := clockJump(-timewarpOffset); err != nil {
+			log.Logf(0, "timewarp: failed to restore the clock, it's off by %v: %v", timewarpOffset, err)
+		}
+	}
+	if timewarpSlewed {
+		if err := setClockFreq(timewarpFreq); err != nil {
+			log.Logf(0, "timewarp: failed to restore the clock frequency: %v", err)
+		}
+	}
+	log.Logf(0, "timewarp: restored the clock after %v events", atomic.LoadUint64(&timewarpSeq))
+}
+
+// recentTimewarp returns the sequence number of the last warp event if it happened recently, or 0.
+func recentTimewarp() uint64 {
+	t := atomic.LoadInt64(&timewarpTime)
+	if t == 0 || time.Since(time.Unix(0, t)) > timewarpCrashWindow {
+		return 0
+	}
+	return atomic.LoadUint64(&timewarpSeq)
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	capSysTime   = 25     // CAP_SYS_TIME
+	adjFrequency = 0x0002 // ADJ_FREQUENCY
+)
+
+// checkTimewarp returns an error if the process can't change the system clock.
+// A frequency adjustment to the current value is a no-op that requires the same privileges,
+// it also catches sandboxes that filter clock syscalls.
+func checkTimewarp() error {
+	caps, err := effectiveCaps()
+	if err != nil {
+		return err
+	}
+	if caps&(1<<capSysTime) == 0 {
+		return fmt.Errorf("changing the clock requires CAP_SYS_TIME")
+	}
+	freq, err := clockFreq()
+	if err != nil {
+		return err
+	}
+	if err := setClockFreq(freq); err != nil {
+		return fmt.Errorf("the clock can't be changed in this sandbox: %v", err)
+	}
+	return nil
+}
+
+func effectiveCaps() (uint64, error) {
+	data, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		if caps := strings.TrimPrefix(s.Text(), "CapEff:"); caps != s.Text() {
+			return strconv.ParseUint(strings.TrimSpace(caps), 16, 64)
+		}
+	}
+	return 0, fmt.Errorf("no CapEff in /proc/self/status")
+}
+
+func clockJump(d time.Duration) error {
+	var tv syscall.Timeval
+	if err := syscall.Gettimeofday(&tv); err != nil {
+		return err
+	}
+	tv = syscall.NsecToTimeval(tv.Nano() + d.Nanoseconds())
+	return syscall.Settimeofday(&tv)
+}
+
+// Timex fields are int32 on 32-bit arches, so Freq is accessed with reflect.
+
+func clockFreq() (int64, error) {
+	var tx syscall.Timex
+	if _, err := syscall.Adjtimex(&tx); err != nil {
+		return 0, err
+	}
+	return reflect.ValueOf(tx.Freq).Int(), nil
+}
+
+func setClockFreq(freq int64) error {
+	tx := syscall.Timex{Modes: adjFrequency}
+	reflect.ValueOf(&tx.Freq).Elem().SetInt(freq)
+	_, err := syscall.Adjtimex(&tx)
+	return err
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func checkTimewarp() error {
+	return fmt.Errorf("supported only on linux")
+}
+
+func clockJump(d time.Duration) error {
+	return fmt.Errorf("not supported")
+}
+
+func clockFreq() (int64, error) {
+	return 0, fmt.Errorf("not supported")
+}
+
+func setClockFreq(freq int64) error {
+	return fmt.Errorf("not supported")
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagOnlyCrashTypes = flag.String("only-crash-types", "",
+		"comma-separated crash categories to save (oob-write, oob-read, oob, uaf, other), others are only counted")
+
+	// onlyCrashTypes holds categories of crashes to save, nil if all are saved.
+	onlyCrashTypes map[string]bool
+	crashTypes     = newTitleStats()
+
+	triageBugRe = regexp.MustCompile(`BUG: (?:KASAN|KMSAN): `)
+	// triageTitleRe matches titles of KASAN reports, e.g. "KASAN: slab-out-of-bounds Write in foo",
+	// and titles of OOB sites saved with -oob, e.g. "OOB: slab-out-of-bounds Write of size 8 in foo (kmalloc-64)".
+	triageTitleRe = regexp.MustCompile(`^(?:KASAN|OOB): ([a-z-]+)(?: (Read|Write)\b)?`)
+	// triageReportRe matches the first line of a KASAN report in console output.
+	triageReportRe = regexp.MustCompile(`^BUG: KASAN: ([a-z-]+)`)
+	// triageToolRe matches titles of reports of other tools, e.g. "UBSAN: array-index-out-of-bounds in foo".
+	triageToolRe = regexp.MustCompile(`^[A-Z]+: `)
+)
+
+// Crash categories.
+const (
+	crashOOBWrite = "oob-write"
+	crashOOBRead  = "oob-read"
+	crashOOB      = "oob" // out-of-bounds access of unknown type
+	crashUAF      = "uaf"
+	crashOther    = "other"
+)
+
+func initCrashTypes() {
+	if *flagOnlyCrashTypes == "" {
+		return
+	}
+	onlyCrashTypes = make(map[string]bool)
+	for _, typ := range strings.Split(*flagOnlyCrashTypes, ",") {
+		switch typ {
+		case crashOOBWrite, crashOOBRead, crashOOB, crashUAF, crashOther:
+			onlyCrashTypes[typ] = true
+		default:
+			log.Fatalf("unknown crash type %q in -only-crash-types", typ)
+		}
+	}
+}
+
+// triageCrash returns the category of a crash with the given title and console output.
+// Only KASAN reports are memory accesses: e.g. UBSAN array-index-out-of-bounds reports
+// an invalid index without any access, so it's "other". The bug type and the access type
+// are taken from the title (e.g. "KASAN: slab-out-of-bounds Write in foo"), and the access
+// type is taken from the access line of the first report in output if the title doesn't have it.
+// Titles that are not report titles (e.g. "hang" or custom -classify tags) are categorized
+// by the first report in output, so that a second report after it doesn't affect the category.
+func triageCrash(title string, output []byte) string {
+	rep := firstMemReport(output)
+	var bug, access string
+	if m := triageTitleRe.FindStringSubmatch(title); m != nil {
+		bug, access = m[1], m[2]
+	} else if triageToolRe.MatchString(title) {
+		return crashOther
+	} else if m := triageReportRe.FindSubmatch(rep); m != nil {
+		bug = string(m[1])
+	}
+	switch {
+	case strings.HasSuffix(bug, "out-of-bounds"):
+	case strings.Contains(bug, "use-after-free"):
+		return crashUAF
+	default:
+		return crashOther
+	}
+	if access == "" && rep != nil {
+		if m := oobAccessRe.FindSubmatch(rep); m != nil {
+			access = string(m[1])
+		}
+	}
+	switch access {
+	case "Write":
+		return crashOOBWrite
+	case "Read":
+		return crashOOBRead
+	}
+	return crashOOB
+}
+
+// firstMemReport returns the first KASAN/KMSAN report in output, or nil.
+func firstMemReport(output []byte) []byte {
+	loc := triageBugRe.FindIndex(output)
+	if loc == nil {
+		return nil
+	}
+	rep := output[loc[0]:]
+	if next := triageBugRe.FindIndex(rep[loc[1]-loc[0]:]); next != nil {
+		rep = rep[:loc[1]-loc[0]+next[0]]
+	}
+	return rep
+}
+
+// saveCrashType returns true if crashes of the category need to be saved.
+func saveCrashType(category string) bool {
+	return onlyCrashTypes == nil || onlyCrashTypes[category]
+}
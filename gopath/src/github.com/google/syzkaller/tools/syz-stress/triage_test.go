@@ -0,0 +1,70 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Files in testdata/triage start with "TITLE: <crash title>" and "CATEGORY: <expected category>"
+// lines followed by an empty line and the console output.
+func TestTriageCrash(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "triage", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no test files")
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		title, category, output := parseTriageTest(t, file, data)
+		if got := triageCrash(title, output); got != category {
+			t.Errorf("%v: title %q: got category %q, want %q", file, title, got, category)
+		}
+	}
+}
+
+func parseTriageTest(t *testing.T, file string, data []byte) (title, category string, output []byte) {
+	const (
+		titlePrefix    = "TITLE: "
+		categoryPrefix = "CATEGORY: "
+	)
+	parts := bytes.SplitN(data, []byte("\n\n"), 2)
+	if len(parts) != 2 {
+		t.Fatalf("%v: no empty line after the header", file)
+	}
+	for _, line := range bytes.Split(parts[0], []byte("\n")) {
+		switch {
+		case bytes.HasPrefix(line, []byte(titlePrefix)):
+			title = string(line[len(titlePrefix):])
+		case bytes.HasPrefix(line, []byte(categoryPrefix)):
+			category = string(line[len(categoryPrefix):])
+		default:
+			t.Fatalf("%v: unknown header line %q", file, line)
+		}
+	}
+	if title == "" || category == "" {
+		t.Fatalf("%v: missing TITLE or CATEGORY", file)
+	}
+	return title, category, parts[1]
+}
+
+func TestFirstMemReport(t *testing.T) {
+	output := []byte("foo\nBUG: KASAN: use-after-free in a\nRead of size 8\n" +
+		"BUG: KASAN: slab-out-of-bounds in b\nWrite of size 4\n")
+	want := "BUG: KASAN: use-after-free in a\nRead of size 8\n"
+	if got := string(firstMemReport(output)); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if got := firstMemReport([]byte("UBSAN: array-index-out-of-bounds in a\n")); got != nil {
+		t.Fatalf("got %q for output without KASAN reports", got)
+	}
+}
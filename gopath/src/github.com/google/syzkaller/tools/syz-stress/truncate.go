@@ -0,0 +1,80 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagMaxCalls  = flag.Int("max-calls", 0, "truncate programs with more calls than this before execution (0 - no limit)")
+	flagShmemSize = flag.String("shmem-size", "", "lower the limit on the exec encoding size of programs, e.g. 512K; "+
+		"the executor input region itself stays prog.ExecBufferSize, which is also the maximum")
+
+	// execLimit is the size programs are truncated to in the exec encoding.
+	execLimit = prog.ExecBufferSize
+
+	statTruncated uint64
+	// statTooLarge is the number of programs that did not fit into the executor input
+	// region even with a single call and were not executed.
+	statTooLarge uint64
+)
+
+// checkShmemSize parses -shmem-size. It's only a client-side limit used by truncate:
+// ipc maps the input region with the fixed size prog.ExecBufferSize and the executor
+// reads at most that much. Growing the region would need the size to be passed in
+// ipc.Config and negotiated with the executor at handshake, which is not implemented,
+// so -shmem-size can only reduce the limit.
+func checkShmemSize() error {
+	if *flagShmemSize == "" {
+		return nil
+	}
+	size, err := parseSize(*flagShmemSize)
+	if err != nil {
+		return fmt.Errorf("bad -shmem-size: %v", err)
+	}
+	if size == 0 || size > prog.ExecBufferSize {
+		return fmt.Errorf("-shmem-size must be between 1 and %v", prog.ExecBufferSize)
+	}
+	execLimit = int(size)
+	return nil
+}
+
+// truncate drops trailing calls of p until it has at most -max-calls calls and
+// fits into the executor input region, so that oversized programs are not sent
+// to the executor. Results of a call are only used by subsequent calls,
+// so removing calls from the end keeps the program valid.
+// It returns an error matching prog.ErrProgramTooLarge if the first call alone does not fit.
+func (proc *proc) truncate(p *prog.Prog) error {
+	truncated := false
+	for *flagMaxCalls > 0 && len(p.Calls) > *flagMaxCalls {
+		p.RemoveCall(len(p.Calls) - 1)
+		truncated = true
+	}
+	if proc.execBuf == nil {
+		proc.execBuf = make([]byte, execLimit)
+	}
+	// SerializeForExecLimit computes the required size on failure, which is expensive,
+	// so it's used only to produce the error.
+	var err error
+	for {
+		if _, err = p.SerializeForExec(proc.execBuf); err == nil {
+			break
+		}
+		if len(p.Calls) <= 1 {
+			_, err = p.SerializeForExecLimit(proc.execBuf)
+			break
+		}
+		p.RemoveCall(len(p.Calls) - 1)
+		truncated = true
+	}
+	if truncated {
+		atomic.AddUint64(&statTruncated, 1)
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+)
+
+// longProg returns a program with exactly n calls made of copies of generated programs.
+func longProg(target *prog.Target, rs rand.Source, n int) *prog.Prog {
+	p0 := target.Generate(rs, 10, target.DefaultChoiceTable())
+	p := p0.Clone()
+	for len(p.Calls) < n {
+		p.Calls = append(p.Calls, p0.Clone().Calls...)
+	}
+	for len(p.Calls) > n {
+		p.RemoveCall(len(p.Calls) - 1)
+	}
+	return p
+}
+
+// prefixSize returns the exec size of the first n calls of p.
+func prefixSize(p *prog.Prog, n int) int {
+	p = p.Clone()
+	for len(p.Calls) > n {
+		p.RemoveCall(len(p.Calls) - 1)
+	}
+	return p.ExecSize()
+}
+
+func TestTruncate(t *testing.T) {
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(limit int) { execLimit = limit }(execLimit)
+	p0 := longProg(target, rand.NewSource(0), 50)
+	tests := []struct {
+		calls     int
+		maxCalls  int
+		limit     int
+		wantCalls int
+		truncated bool
+		tooLarge  bool
+	}{
+		{calls: 50, wantCalls: 50},
+		{calls: 5, maxCalls: 10, wantCalls: 5},
+		{calls: 10, maxCalls: 10, wantCalls: 10},
+		{calls: 11, maxCalls: 10, wantCalls: 10, truncated: true},
+		{calls: 50, maxCalls: 10, wantCalls: 10, truncated: true},
+		// Right at the boundary and just below it.
+		{calls: 50, limit: prefixSize(p0, 50), wantCalls: 50},
+		{calls: 50, limit: prefixSize(p0, 50) - 1, wantCalls: 49, truncated: true},
+		{calls: 50, limit: prefixSize(p0, 7), wantCalls: 7, truncated: true},
+		{calls: 50, limit: prefixSize(p0, 8) - 1, wantCalls: 7, truncated: true},
+		{calls: 50, maxCalls: 5, limit: prefixSize(p0, 7), wantCalls: 5, truncated: true},
+		{calls: 50, maxCalls: 20, limit: prefixSize(p0, 7), wantCalls: 7, truncated: true},
+		// Even the first call does not fit.
+		{calls: 1, limit: prefixSize(p0, 1) - 1, wantCalls: 1, tooLarge: true},
+		{calls: 50, limit: prefixSize(p0, 1) - 1, wantCalls: 1, truncated: true, tooLarge: true},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			defer setFlags(t, map[string]string{"max-calls": fmt.Sprint(test.maxCalls)})()
+			execLimit = prog.ExecBufferSize
+			if test.limit != 0 {
+				execLimit = test.limit
+			}
+			p := p0.Clone()
+			for len(p.Calls) > test.calls {
+				p.RemoveCall(len(p.Calls) - 1)
+			}
+			truncated := atomic.LoadUint64(&statTruncated)
+			err := new(proc).truncate(p)
+			if len(p.Calls) != test.wantCalls {
+				t.Errorf("got %v calls, want %v", len(p.Calls), test.wantCalls)
+			}
+			if got := atomic.LoadUint64(&statTruncated) != truncated; got != test.truncated {
+				t.Errorf("truncated %v, want %v", got, test.truncated)
+			}
+			if test.tooLarge {
+				if !errors.Is(err, prog.ErrProgramTooLarge) {
+					t.Fatalf("got error %v, want %v", err, prog.ErrProgramTooLarge)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size := p.ExecSize(); size > execLimit {
+				t.Errorf("exec size %v exceeds the limit %v", size, execLimit)
+			}
+		})
+	}
+}
+
+// TestTruncateMutated mutates long corpus programs and checks that
+// nothing oversized is sent to the executor.
+func TestTruncateMutated(t *testing.T) {
+	const (
+		maxCalls = 20
+		iters    = 5000
+	)
+	defer func(limit int) { execLimit = limit }(execLimit)
+	fe := newFakeEnvs(func(n uint64) fakeResult { return fakeClean })
+	fe.check = func(p *prog.Prog) bool {
+		_, err := p.SerializeForExec(make([]byte, execLimit))
+		return len(p.Calls) <= maxCalls && err == nil
+	}
+	target, err := prog.GetTarget("test", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := rand.NewSource(0)
+	var corpus []*prog.Prog
+	for i := 0; i < 10; i++ {
+		corpus = append(corpus, longProg(target, rs, 40+i))
+	}
+	ft, stop := startFakeTarget(t, fe, map[string]string{
+		"max-calls":  fmt.Sprint(maxCalls),
+		"shmem-size": fmt.Sprint(prefixSize(corpus[0], 10)),
+	})
+	defer stop()
+	if err := checkShmemSize(); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range corpus {
+		ft.addCorpus(p)
+	}
+	ft.mutateOnly = true
+	truncated := atomic.LoadUint64(&statTruncated)
+	proc := newProc(ft, 0)
+	for i := 0; i < iters; i++ {
+		ft.fuzzStep(i, proc.rnd, proc.executeAndReward)
+	}
+	if errs := atomic.LoadUint64(&fe.errors); errs != 0 {
+		t.Fatalf("%v oversized programs reached the executor", errs)
+	}
+	if atomic.LoadUint64(&fe.execs) == 0 {
+		t.Fatalf("no programs were executed")
+	}
+	if atomic.LoadUint64(&statTruncated) == truncated {
+		t.Fatalf("no programs were truncated")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+var (
+	flagUploadCmd = flag.String("upload-cmd", "", "shell command run for each new crashdir file with the file "+
+		"path as argument (gets SYZ_STRESS_TITLE, SYZ_STRESS_RUN_ID and SYZ_STRESS_TARGET in environment)")
+	flagUploadProcs   = flag.Int("upload-procs", 4, "number of concurrent -upload-cmd uploads")
+	flagUploadRetries = flag.Int("upload-retries", 3, "number of times to retry a failed upload")
+)
+
+const (
+	uploadQueueSize = 1000
+	uploadTimeout   = 5 * time.Minute
+	uploadBackoff   = time.Second
+)
+
+type upload struct {
+	file  string
+	title string
+}
+
+var (
+	uploadQueue  chan upload
+	uploadWG     sync.WaitGroup
+	uploadMu     sync.Mutex
+	uploadClosed bool
+	// deadLetters are files that were not uploaded.
+	deadLetters []string
+	uploadEnv   []string
+)
+
+func startUploads(target *prog.Target) {
+	uploadEnv = append(os.Environ(),
+		"SYZ_STRESS_RUN_ID="+runID,
+		fmt.Sprintf("SYZ_STRESS_TARGET=%v/%v", target.OS, target.Arch))
+	uploadQueue = make(chan upload, uploadQueueSize)
+	for i := 0; i < *flagUploadProcs; i++ {
+		uploadWG.Add(1)
+		go func() {
+			defer uploadWG.Done()
+			for u := range uploadQueue {
+				if !u.run() {
+					addDeadLetter(u.file)
+				}
+			}
+		}()
+	}
+}
+
+// uploadArtifact queues upload of all files of the crashdir artifact with the given base path.
+// It never blocks: if the queue is full, the files go straight to the dead letter list.
+func uploadArtifact(title, base string) {
+	if uploadQueue == nil {
+		return
+	}
+	files, _ := filepath.Glob(base + ".*")
+	filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	uploadMu.Lock()
+	defer uploadMu.Unlock()
+	for _, file := range files {
+		if uploadClosed {
+			deadLetters = append(deadLetters, file)
+			continue
+		}
+		select {
+		case uploadQueue <- upload{file, title}:
+		default:
+			deadLetters = append(deadLetters, file)
+		}
+	}
+}
+
+// run runs -upload-cmd for the file retrying with exponential backoff.
+func (u upload) run() bool {
+	backoff := uploadBackoff
+	for try := 0; ; try++ {
+		cmd := exec.Command("sh", "-c", *flagUploadCmd+` "$1"`, "sh", u.file)
+		cmd.Env = append(uploadEnv, "SYZ_STRESS_TITLE="+u.title)
+		_, err := osutil.Run(uploadTimeout, cmd)
+		if err == nil {
+			return true
+		}
+		if try == *flagUploadRetries {
+			log.Logf(0, "failed to upload %v: %v", u.file, err)
+			return false
+		}
+		log.Logf(1, "failed to upload %v, retrying in %v: %v", u.file, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func addDeadLetter(file string) {
+	uploadMu.Lock()
+	deadLetters = append(deadLetters, file)
+	uploadMu.Unlock()
+}
+
+// finishUploads waits for queued uploads, then uploads the crashdir index last,
+// so that the remote side can tell a complete run, and prints files that were not uploaded.
+func finishUploads() {
+	if uploadQueue == nil {
+		return
+	}
+	uploadMu.Lock()
+	uploadClosed = true
+	close(uploadQueue)
+	uploadMu.Unlock()
+	uploadWG.Wait()
+	index := filepath.Join(*flagCrashdir, "index.json")
+	if osutil.IsExist(index) && !(upload{index, ""}).run() {
+		deadLetters = append(deadLetters, index)
+	}
+	if len(deadLetters) != 0 {
+		fmt.Printf("files not uploaded: %v\n", len(deadLetters))
+		for _, file := range deadLetters {
+			fmt.Printf("\t%v\n", file)
+		}
+	}
+}
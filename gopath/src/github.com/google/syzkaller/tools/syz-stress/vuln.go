@@ -0,0 +1,41 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/vuln"
+)
+
+var (
+	flagVuln = flag.String("vuln", "", "json file describing the target vulnerability (see pkg/vuln)")
+
+	// vulnID tags artifacts if -vuln is given.
+	vulnID string
+)
+
+// applyVuln makes every program generated for ft contain the vulnerable syscalls
+// preceded by the prelude, and restricts OOB site collection to reports matching
+// the allocation site.
+func applyVuln(ft *fuzzTarget, file string) {
+	if *flagTemplate != "" {
+		log.Fatalf("-vuln and -template are mutually exclusive")
+	}
+	v, err := vuln.Load(file, ft.target)
+	if err != nil {
+		log.Fatalf("failed to load vulnerability description: %v", err)
+	}
+	holes := programLength - len(v.Prelude) - len(v.Syscalls)
+	if holes < 1 {
+		holes = 1
+	}
+	if ft.tmpl, err = ft.target.ParseTemplate(v.Template(holes)); err != nil {
+		log.Fatalf("failed to create template for %v: %v", v.ID, err)
+	}
+	vulnID = v.ID
+	oobFilter = v.AllocSiteRe
+	log.Logf(0, "steering towards %v", v.ID)
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/syzkaller/prog"
+)
+
+var flagWatchCall = flag.String("watch-call", "", "comma-separated syscalls (e.g. open or open$dir), "+
+	"print programs containing them with executor output")
+
+// watchedCalls contains names of watched syscalls and of their base calls (e.g. open for open$dir).
+var watchedCalls map[string]bool
+
+func initWatchCalls(target *prog.Target) error {
+	watchedCalls = make(map[string]bool)
+	for _, name := range strings.Split(*flagWatchCall, ",") {
+		known := false
+		for _, c := range target.Syscalls {
+			if c.Name == name || c.CallName == name {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown syscall %q in -watch-call", name)
+		}
+		watchedCalls[name] = true
+	}
+	return nil
+}
+
+// watched returns true if p contains a watched syscall.
+func watched(p *prog.Prog) bool {
+	for _, c := range p.Calls {
+		if watchedCalls[c.Meta.Name] || watchedCalls[c.Meta.CallName] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+var (
+	flagProgressTimeout = flag.Duration("progress-timeout", 0, "exit if no programs were executed for this long")
+	flagWorkerTimeout   = flag.Duration("worker-timeout", 0, "recycle executor of a proc that made no progress for this long")
+
+	// currentProgs holds the serialized program that each proc executes at the moment.
+	// It's empty while the proc does not execute anything.
+	currentProgs []atomic.Value
+
+	statStuck uint64
+
+	workersMu sync.Mutex
+	workers   []*proc
+)
+
+func initCurrentProgs(procs int) {
+	if currentProgs == nil {
+		currentProgs = make([]atomic.Value, procs)
+	}
+}
+
+func startProgressWatchdog(procs int, timeout time.Duration) {
+	initCurrentProgs(procs)
+	go func() {
+		lastExec := atomic.LoadUint64(&statExec)
+		lastProgress := time.Now()
+		for range time.NewTicker(time.Second).C {
+			if exec := atomic.LoadUint64(&statExec); exec != lastExec {
+				lastExec = exec
+				lastProgress = time.Now()
+				continue
+			}
+			if time.Since(lastProgress) < timeout {
+				continue
+			}
+			for pid := range currentProgs {
+				if data, ok := currentProgs[pid].Load().([]byte); ok && len(data) != 0 {
+					log.Logf(0, "proc %v is executing:\n%s", pid, data)
+				}
+			}
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			log.Logf(0, "goroutines:\n%s", buf)
+			log.Fatalf("no programs were executed for %v (executed %v in total)", timeout, lastExec)
+		}
+	}()
+}
+
+// beat records that proc starts a new execution.
+func (proc *proc) beat() {
+	atomic.StoreInt64(&proc.heartbeat, time.Now().UnixNano())
+}
+
+// idle records that proc is not executing anything, e.g. it generates a program
+// or is paused due to high load, so the watchdog does not consider it stuck.
+func (proc *proc) idle() {
+	atomic.StoreInt64(&proc.heartbeat, 0)
+}
+
+// registerWorker adds proc to the list of all procs
+// (used by the worker watchdog and for per-proc stats).
+func registerWorker(proc *proc) {
+	workersMu.Lock()
+	workers = append(workers, proc)
+	workersMu.Unlock()
+}
+
+// startWorkerWatchdog periodically checks heartbeats of all procs. A proc that executes
+// a single program for longer than timeout is considered stuck in its executor:
+// the watchdog saves its program and a dump of all goroutines, and kills the executor
+// processes so that the proc can continue with a fresh Env.
+func startWorkerWatchdog(procs int, timeout time.Duration) {
+	initCurrentProgs(procs)
+	period := timeout / 4
+	if period < time.Second {
+		period = time.Second
+	}
+	go func() {
+		for range time.NewTicker(period).C {
+			workersMu.Lock()
+			procs := append([]*proc{}, workers...)
+			workersMu.Unlock()
+			for _, proc := range procs {
+				hb := atomic.LoadInt64(&proc.heartbeat)
+				last := time.Unix(0, hb)
+				if hb == 0 || time.Since(last) < timeout || !atomic.CompareAndSwapUint32(&proc.stuck, 0, 1) {
+					continue
+				}
+				atomic.AddUint64(&statStuck, 1)
+				proc.handleStuck(time.Since(last))
+			}
+		}
+	}()
+}
+
+func (proc *proc) handleStuck(since time.Duration) {
+	var data []byte
+	if v, ok := currentProgs[proc.pid].Load().([]byte); ok {
+		data = v
+	}
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	dir := *flagCrashdir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	file := filepath.Join(dir, fmt.Sprintf("stuck-%v-%v.goroutines", proc.pid, time.Now().Unix()))
+	if err := osutil.WriteFile(file, buf); err != nil {
+		log.Logf(0, "failed to save goroutines: %v", err)
+	}
+	log.Logf(0, "proc %v: no progress for %v, recycling executor, goroutines are saved to %v,"+
+		" last program:\n%s", proc.pid, since, file, data)
+	// Killing the executor unblocks the stuck execution. The Env itself must not be closed here:
+	// Exec is still running and uses its shared memory. The proc recycles it when Exec returns.
+	if proc.killExecutor() == 0 {
+		log.Logf(0, "proc %v: executor process not found, waiting for the execution to finish", proc.pid)
+	}
+}
+
+// killExecutor kills the executor processes of proc and returns their number.
+func (proc *proc) killExecutor() int {
+	procs := proc.executorProcs()
+	for _, ep := range procs {
+		if p, err := os.FindProcess(ep.pid); err == nil {
+			p.Kill()
+		}
+	}
+	return len(procs)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/prog"
+)
+
+var flagCallWeights = flag.String("call-weights", "", "file with name=weight lines scaling the priority of matching "+
+	"syscalls (glob patterns allowed, weight 0 disables the syscall)")
+
+// loadCallWeights reads -call-weights file for target.
+func loadCallWeights(target *prog.Target, file string) (map[int]float32, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read call weights: %v", err)
+	}
+	return parseCallWeights(target, data)
+}
+
+// parseCallWeights parses name=weight lines into weights indexed by syscall ID.
+// Names are glob patterns matched against syscall names, later lines override earlier ones.
+// Empty lines and lines starting with # are ignored.
+func parseCallWeights(target *prog.Target, data []byte) (map[int]float32, error) {
+	weights := make(map[int]float32)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		ln := strings.TrimSpace(s.Text())
+		if ln == "" || ln[0] == '#' {
+			continue
+		}
+		eq := strings.IndexByte(ln, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("line %v: want name=weight, got %q", line, ln)
+		}
+		pattern := strings.TrimSpace(ln[:eq])
+		weight, err := strconv.ParseFloat(strings.TrimSpace(ln[eq+1:]), 32)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("line %v: bad weight %q", line, ln[eq+1:])
+		}
+		calls, err := matchSyscalls(target, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", line, err)
+		}
+		for _, c := range calls {
+			weights[c.ID] = float32(weight)
+		}
+	}
+	return weights, s.Err()
+}
+
+// matchSyscalls returns syscalls of target whose names match the glob pattern.
+// It's an error if the pattern matches nothing.
+func matchSyscalls(target *prog.Target, pattern string) ([]*prog.Syscall, error) {
+	var calls []*prog.Syscall
+	for _, c := range target.Syscalls {
+		ok, err := path.Match(pattern, c.Name)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+		}
+		if ok {
+			calls = append(calls, c)
+		}
+	}
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("%q does not match any syscall", pattern)
+	}
+	return calls, nil
+}
+
+// disableZeroWeightCalls removes calls with zero weight from calls, as if they were not enabled,
+// and returns the remaining transitively enabled calls.
+func disableZeroWeightCalls(target *prog.Target, calls map[*prog.Syscall]bool,
+	weights map[int]float32) map[*prog.Syscall]bool {
+	for c := range calls {
+		if w, ok := weights[c.ID]; ok && w == 0 {
+			delete(calls, c)
+		}
+	}
+	calls, disabled := target.TransitivelyEnabledCalls(calls)
+	for c, reason := range disabled {
+		log.Logf(0, "transitively disabled by zero weight: %v: %v", c.Name, reason)
+	}
+	return calls
+}
+
+// calculatePriorities returns call priorities over the current corpus adjusted
+// with -temperature and -ngram, and then with -call-weights and -boost-calls for the priority of choosing each call.
+func (ft *fuzzTarget) calculatePriorities() [][]float32 {
+	corpus := ft.getCorpus()
+	prios := ft.target.CalculatePriorities(corpus)
+	applyTemperature(prios, *flagTemperature)
+	if *flagNgram != 0 {
+		ngrams := buildNgrams(ft.target, corpus, *flagNgram)
+		ngrams.apply(prios, *flagNgramWeight)
+		ft.ngrams.Store(ngrams)
+	}
+	for _, factors := range []map[int]float32{ft.weights, ft.boost} {
+		for id, f := range factors {
+			for i := range prios {
+				prios[i][id] *= f
+			}
+		}
+	}
+	return prios
+}
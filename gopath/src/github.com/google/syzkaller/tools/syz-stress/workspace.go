@@ -0,0 +1,171 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+var (
+	flagWorkdirQuota = flag.String("workdir-quota", "", "recycle executors and wipe their working directories "+
+		"when one of them grows larger than this (e.g. 1G)")
+	flagDiskMinFree = flag.String("disk-min-free", "", "pause execution while free disk space "+
+		"in the working directory is below this (e.g. 5G)")
+
+	statWorkdirCleanups uint64
+	statDiskPauses      uint64
+
+	// workspaceGen is incremented to ask all procs to recycle their executors,
+	// which removes the executor working directories.
+	workspaceGen uint64
+	// diskGate holds a channel that is closed while there is enough free disk space.
+	diskGate   atomic.Value
+	diskPaused uint32
+)
+
+const (
+	workspaceInterval = 10 * time.Second
+	// ipc creates executor working directories in the current directory with this prefix.
+	workdirPattern = "syzkaller-testdir*"
+)
+
+func startWorkspace() error {
+	var quota, minFree uint64
+	var err error
+	if *flagWorkdirQuota != "" {
+		if quota, err = parseSize(*flagWorkdirQuota); err != nil {
+			return fmt.Errorf("bad -workdir-quota: %v", err)
+		}
+	}
+	if *flagDiskMinFree != "" {
+		if minFree, err = parseSize(*flagDiskMinFree); err != nil {
+			return fmt.Errorf("bad -disk-min-free: %v", err)
+		}
+	}
+	open := make(chan struct{})
+	close(open)
+	diskGate.Store(open)
+	go func() {
+		// Directories that were over quota on the previous check, if they are still there
+		// after their owners recycled, nobody owns them and they are removed directly.
+		var stale map[string]bool
+		for range time.NewTicker(workspaceInterval).C {
+			over := make(map[string]bool)
+			if quota != 0 {
+				dirs, _ := filepath.Glob(workdirPattern)
+				for _, dir := range dirs {
+					if size := dirSize(dir); size > quota {
+						over[dir] = true
+						if stale[dir] {
+							log.Logf(0, "removing stale working directory %v (%v bytes)", dir, size)
+							os.RemoveAll(dir)
+						}
+					}
+				}
+				if len(over) != 0 {
+					atomic.AddUint64(&statWorkdirCleanups, 1)
+					log.Logf(0, "%v executor working directories exceed %v, recycled %v executors",
+						len(over), *flagWorkdirQuota, recycleWorkdirOwners(over))
+				}
+			}
+			stale = over
+			if minFree != 0 {
+				checkDiskFree(minFree)
+			}
+		}
+	}()
+	return nil
+}
+
+// checkDiskFree pauses execution if free space is below minFree and resumes it once
+// there is enough space again. Pausing also recycles all executors to free their directories.
+func checkDiskFree(minFree uint64) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(".", &st); err != nil {
+		log.Logf(0, "failed to check free disk space: %v", err)
+		return
+	}
+	free := uint64(st.Bavail) * uint64(st.Bsize)
+	paused := atomic.LoadUint32(&diskPaused) != 0
+	switch {
+	case free < minFree && !paused:
+		atomic.AddUint64(&statDiskPauses, 1)
+		atomic.StoreUint32(&diskPaused, 1)
+		diskGate.Store(make(chan struct{}))
+		atomic.AddUint64(&workspaceGen, 1)
+		log.Logf(0, "free disk space %v is below %v, pausing execution", free, *flagDiskMinFree)
+	case free >= minFree && paused:
+		atomic.StoreUint32(&diskPaused, 0)
+		close(diskGate.Load().(chan struct{}))
+		log.Logf(0, "free disk space %v, resuming execution", free)
+	}
+}
+
+// recycleWorkdirOwners asks procs whose executors run in one of dirs to recycle them
+// and returns the number of such procs. The executor runs in its working directory
+// (or in a subdirectory with the sandbox), which is how directories are mapped to procs.
+// Directories without an owner are left to the stale check.
+func recycleWorkdirOwners(dirs map[string]bool) int {
+	workersMu.Lock()
+	procs := append([]*proc{}, workers...)
+	workersMu.Unlock()
+	recycled := 0
+	for _, proc := range procs {
+		for dir := range dirs {
+			if workdirOwned(dir, proc.executorProcs()) {
+				atomic.StoreUint32(&proc.recycleWorkdir, 1)
+				recycled++
+				break
+			}
+		}
+	}
+	return recycled
+}
+
+// workdirOwned returns whether one of the executor processes runs inside dir.
+func workdirOwned(dir string, eps []executorProc) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for _, ep := range eps {
+		if ep.cwd == abs || strings.HasPrefix(ep.cwd, abs+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkWorkspace recycles the executor of proc if requested and waits while
+// execution is paused due to low disk space. Crash handling is not affected by the pause.
+func (proc *proc) checkWorkspace() {
+	gen := atomic.LoadUint64(&workspaceGen)
+	if gen != proc.workspaceGen || atomic.CompareAndSwapUint32(&proc.recycleWorkdir, 1, 0) {
+		proc.workspaceGen = gen
+		proc.recycleEnv()
+	}
+	if gate, ok := diskGate.Load().(chan struct{}); ok {
+		<-gate
+	}
+}
+
+func dirSize(dir string) uint64 {
+	size := uint64(0)
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size
+}
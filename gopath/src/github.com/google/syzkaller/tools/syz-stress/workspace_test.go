@@ -0,0 +1,36 @@
+// Copyright 2020 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkdirOwned(t *testing.T) {
+	dir, err := filepath.Abs("syzkaller-testdir123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cwds []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{dir}, true},
+		{[]string{dir + "/syz-tmp"}, true},
+		{[]string{dir + "4"}, false},
+		{[]string{filepath.Dir(dir)}, false},
+		{[]string{"", dir + "4", dir + "/0"}, true},
+	}
+	for i, test := range tests {
+		var eps []executorProc
+		for _, cwd := range test.cwds {
+			eps = append(eps, executorProc{cwd: cwd})
+		}
+		if got := workdirOwned("syzkaller-testdir123", eps); got != test.want {
+			t.Errorf("#%v: workdirOwned(%q) = %v, want %v", i, test.cwds, got, test.want)
+		}
+	}
+}